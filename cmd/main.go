@@ -2,12 +2,17 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -26,6 +31,14 @@ func main() {
 	dsn := "file:saws_world_data/saws.sqlite?_journal=WAL"
 	apiKey, apiKeyOK := os.LookupEnv("MAPS_KEY")
 
+	if len(os.Args) > 1 {
+		err := runCommand(dsn, os.Args[1], os.Args[2:])
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		return
+	}
+
 	port, portOK := os.LookupEnv("PORT")
 	if !portOK {
 		port = "8080"
@@ -72,6 +85,69 @@ func main() {
 		return
 	}
 
+	// unsigned and v2 cursors from pages loaded before the current version
+	// are only accepted until a fixed date, so restarting doesn't extend
+	// the window
+	cursorCfg := db.CursorConfig{}
+	if until, ok := os.LookupEnv("SAWS_LEGACY_CURSORS_UNTIL"); ok {
+		cursorCfg.LegacyUntil, err = time.Parse(time.DateOnly, until)
+		if err != nil {
+			log.Fatalf("could not parse SAWS_LEGACY_CURSORS_UNTIL: %s", err.Error())
+			return
+		}
+	}
+
+	cursorSecret, cursorSecretOK := os.LookupEnv("SAWS_CURSOR_SECRET")
+	if cursorSecretOK {
+		cursorCfg.Secret = []byte(cursorSecret)
+	} else {
+		log.Println("SAWS_CURSOR_SECRET not set, cursors will not work across restarts")
+		cursorCfg.Secret = db.CursorConfiguration().Secret
+	}
+
+	err = db.ConfigureCursors(cursorCfg)
+	if err != nil {
+		log.Fatalf("could not configure cursors: %s", err.Error())
+		return
+	}
+
+	trashRetention := router.DefaultTrashRetention
+	if retentionEnv, ok := os.LookupEnv("SAWS_TRASH_RETENTION"); ok {
+		trashRetention, err = time.ParseDuration(retentionEnv)
+		if err != nil {
+			log.Fatalf("could not parse SAWS_TRASH_RETENTION: %s", err.Error())
+			return
+		}
+	}
+
+	backupDir := os.Getenv("SAWS_BACKUP_DIR")
+	backupInterval := 24 * time.Hour
+	if intervalEnv, ok := os.LookupEnv("SAWS_BACKUP_INTERVAL"); ok {
+		backupInterval, err = time.ParseDuration(intervalEnv)
+		if err != nil {
+			log.Fatalf("could not parse SAWS_BACKUP_INTERVAL: %s", err.Error())
+			return
+		}
+	}
+
+	backupKeep := router.DefaultBackupKeep
+	if keepEnv, ok := os.LookupEnv("SAWS_BACKUP_KEEP"); ok {
+		backupKeep, err = strconv.Atoi(keepEnv)
+		if err != nil || backupKeep < 1 {
+			log.Fatalf("SAWS_BACKUP_KEEP must be a number above 0")
+			return
+		}
+	}
+
+	privacy := router.DefaultPrivacy
+	if privacyEnv, ok := os.LookupEnv("SAWS_PRIVACY"); ok {
+		privacy, err = image.ParsePrivacyPolicy(privacyEnv)
+		if err != nil {
+			log.Fatalf("could not parse SAWS_PRIVACY: %s", err.Error())
+			return
+		}
+	}
+
 	is, err := image.NewImageFileStore(imageDir)
 	if err != nil {
 		log.Fatalf("could not setup image file store: %s", err.Error())
@@ -85,6 +161,14 @@ func main() {
 	}
 	defer table.Close()
 
+	if timeoutEnv, ok := os.LookupEnv("SAWS_QUERY_TIMEOUT"); ok {
+		table.QueryTimeout, err = time.ParseDuration(timeoutEnv)
+		if err != nil {
+			log.Fatalf("could not parse SAWS_QUERY_TIMEOUT: %s", err.Error())
+			return
+		}
+	}
+
 	var client *maps.Client
 	if apiKeyOK {
 		client, err = maps.NewClient(maps.WithAPIKey(apiKey))
@@ -104,6 +188,10 @@ func main() {
 	}, router.Options{
 		IncludeIndexPage: includeIndexPage,
 		Admins:           admins,
+		TrashRetention:   trashRetention,
+		BackupDir:        backupDir,
+		BackupKeep:       backupKeep,
+		Privacy:          privacy,
 	})
 
 	router.HandleFunc("/debug/pprof/", pprof.Index)
@@ -112,12 +200,45 @@ func main() {
 	router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 	router.HandleFunc("/debug/pprof/trace", pprof.Trace)
 
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	defer stopPurge()
+	go router.PurgeTrashEvery(purgeCtx, time.Hour)
+
+	backfillCtx, stopBackfill := context.WithCancel(context.Background())
+	defer stopBackfill()
+	go func() {
+		err := router.BackfillOrientation(backfillCtx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("could not backfill orientation: %s\n", err.Error())
+		}
+		err = router.BackfillDHashes(backfillCtx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("could not backfill dhashes: %s\n", err.Error())
+		}
+	}()
+
+	backupCtx, stopBackups := context.WithCancel(context.Background())
+	defer stopBackups()
+	if len(backupDir) > 0 {
+		go router.BackupEvery(backupCtx, backupInterval)
+	} else {
+		log.Println("SAWS_BACKUP_DIR not set, scheduled backups are off")
+	}
+
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
 
+	// requests are cancelled along with their queries if they're still
+	// running when shutdown gives up waiting for them
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
 	srv := &http.Server{
 		Addr:    addr,
 		Handler: debug(basicAuth(router)),
+		BaseContext: func(net.Listener) context.Context {
+			return requestCtx
+		},
 	}
 
 	go func() {
@@ -130,13 +251,80 @@ func main() {
 
 	sig := <-signalCh
 	log.Printf("received signal: %v\n", sig)
+	stopPurge()
+	stopBackfill()
+	stopBackups()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
+		cancelRequests()
 		log.Fatalf("server shutdown failed: %v\n", err)
 	}
 
 	log.Println("shutting down")
 }
+
+// runCommand runs a subcommand instead of the server:
+//
+//	main export [-format jsonl|csv] [-file path]
+//	main import [-format jsonl|csv] [-file path]
+//
+// The file defaults to stdout for export and stdin for import, import
+// prints what it did as JSON.
+func runCommand(dsn string, name string, args []string) error {
+	if name != "export" && name != "import" {
+		return fmt.Errorf("unknown command %q, expected export or import", name)
+	}
+
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	formatFlag := flags.String("format", string(db.JSONL), "jsonl or csv")
+	fileFlag := flags.String("file", "", "file to "+name+", defaults to stdout for export and stdin for import")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	format, err := db.ParseFormat(*formatFlag)
+	if err != nil {
+		return err
+	}
+
+	table, err := db.NewImageTable(dsn)
+	if err != nil {
+		return fmt.Errorf("could not create image table: %w", err)
+	}
+	defer table.Close()
+
+	ctx := context.Background()
+
+	if name == "export" {
+		out := os.Stdout
+		if len(*fileFlag) > 0 {
+			out, err = os.Create(*fileFlag)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+		}
+		return db.Export(ctx, table, out, format)
+	}
+
+	in := os.Stdin
+	if len(*fileFlag) > 0 {
+		in, err = os.Open(*fileFlag)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+	}
+
+	report, err := db.Import(ctx, table, in, format)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	if encErr := enc.Encode(report); encErr != nil {
+		log.Println(encErr.Error())
+	}
+	return err
+}
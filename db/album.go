@@ -0,0 +1,252 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	sqlite "github.com/mattn/go-sqlite3"
+)
+
+var AlbumNotFound = errors.New("album not found")
+var DuplicateAlbum = errors.New("duplicate album")
+var InvalidSlug = errors.New("slugs must be lowercase letters and numbers separated by hyphens")
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Slug is a name as it would be in a URL, e.g. Valparaíso is valparaiso
+// and Puerto Natales is puerto-natales
+func Slug(name string) string {
+	words := strings.FieldsFunc(diacritics.Replace(strings.ToLower(name)), func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+	})
+	return strings.Join(words, "-")
+}
+
+// Album is a named collection of images, such as a single trip. The slug
+// is used in URLs so it does not change when an album is renamed.
+type Album struct {
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CreateAlbum adds a new album after all existing albums
+func (i *ImageTable) CreateAlbum(slug, name string) (Album, error) {
+	return i.CreateAlbumContext(context.Background(), slug, name)
+}
+
+func (i *ImageTable) CreateAlbumContext(ctx context.Context, slug, name string) (Album, error) {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	if !slugPattern.MatchString(slug) {
+		return Album{}, InvalidSlug
+	}
+
+	_, err := i.DB.ExecContext(ctx, `
+		INSERT INTO album (slug, name, position)
+		VALUES (?, ?, (SELECT COALESCE(MAX(position) + 1, 0) FROM album));`,
+		slug,
+		name,
+	)
+	if sqlErr, ok := err.(sqlite.Error); ok && sqlErr.ExtendedCode == sqlite.ErrConstraintPrimaryKey {
+		return Album{}, DuplicateAlbum
+	}
+	if err != nil {
+		return Album{}, fmt.Errorf("could not create album %s: %w", slug, err)
+	}
+
+	return i.GetAlbumContext(ctx, slug)
+}
+
+func (i *ImageTable) GetAlbum(slug string) (Album, error) {
+	return i.GetAlbumContext(context.Background(), slug)
+}
+
+func (i *ImageTable) GetAlbumContext(ctx context.Context, slug string) (Album, error) {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	row := i.DB.QueryRowContext(ctx, "SELECT slug, name, position, created_at FROM album WHERE slug = (?);", slug)
+
+	a := Album{}
+	err := row.Scan(&a.Slug, &a.Name, &a.Position, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return Album{}, AlbumNotFound
+	}
+	if err != nil {
+		return Album{}, fmt.Errorf("could not get album %s: %w", slug, err)
+	}
+	return a, nil
+}
+
+// ListAlbums returns all albums in their display order
+func (i *ImageTable) ListAlbums() ([]Album, error) {
+	return i.ListAlbumsContext(context.Background())
+}
+
+func (i *ImageTable) ListAlbumsContext(ctx context.Context) ([]Album, error) {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := i.DB.QueryContext(ctx, "SELECT slug, name, position, created_at FROM album ORDER BY position, name;")
+	if err != nil {
+		return nil, fmt.Errorf("could not list albums: %w", err)
+	}
+	defer rows.Close()
+
+	albums := []Album{}
+	for rows.Next() {
+		a := Album{}
+		err = rows.Scan(&a.Slug, &a.Name, &a.Position, &a.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan album: %w", err)
+		}
+		albums = append(albums, a)
+	}
+	return albums, rows.Err()
+}
+
+func (i *ImageTable) RenameAlbum(slug, name string) error {
+	return i.RenameAlbumContext(context.Background(), slug, name)
+}
+
+func (i *ImageTable) RenameAlbumContext(ctx context.Context, slug, name string) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	res, err := i.DB.ExecContext(ctx, "UPDATE album SET name = (?) WHERE slug = (?);", name, slug)
+	if err != nil {
+		return fmt.Errorf("could not rename album %s: %w", slug, err)
+	}
+	return checkAlbumAffected(res)
+}
+
+// ReorderAlbums moves the given albums to the front in the order given,
+// any albums not given keep their relative order after them
+func (i *ImageTable) ReorderAlbums(slugs ...string) error {
+	return i.ReorderAlbumsContext(context.Background(), slugs...)
+}
+
+func (i *ImageTable) ReorderAlbumsContext(ctx context.Context, slugs ...string) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	albums, err := i.ListAlbumsContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	order := make([]string, 0, len(albums))
+	seen := map[string]bool{}
+	for _, s := range slugs {
+		if seen[s] {
+			continue
+		}
+		if !containsAlbum(albums, s) {
+			return fmt.Errorf("could not reorder album %s: %w", s, AlbumNotFound)
+		}
+		seen[s] = true
+		order = append(order, s)
+	}
+	for _, a := range albums {
+		if !seen[a.Slug] {
+			order = append(order, a.Slug)
+		}
+	}
+
+	tx, err := i.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin album reorder: %w", err)
+	}
+	defer tx.Rollback()
+
+	for pos, s := range order {
+		_, err = tx.ExecContext(ctx, "UPDATE album SET position = (?) WHERE slug = (?);", pos, s)
+		if err != nil {
+			return fmt.Errorf("could not set position of album %s: %w", s, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AddToAlbum adds images to an album, images already in the album are left as they are
+func (i *ImageTable) AddToAlbum(slug string, ids ...string) error {
+	return i.AddToAlbumContext(context.Background(), slug, ids...)
+}
+
+func (i *ImageTable) AddToAlbumContext(ctx context.Context, slug string, ids ...string) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	_, err := i.GetAlbumContext(ctx, slug)
+	if err != nil {
+		return err
+	}
+
+	tx, err := i.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin adding to album %s: %w", slug, err)
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		_, err = tx.ExecContext(ctx, "INSERT OR IGNORE INTO album_image (album_slug, image_id) VALUES (?,?);", slug, id)
+		if err != nil {
+			return fmt.Errorf("could not add image %s to album %s: %w", id, slug, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (i *ImageTable) RemoveFromAlbum(slug string, ids ...string) error {
+	return i.RemoveFromAlbumContext(context.Background(), slug, ids...)
+}
+
+func (i *ImageTable) RemoveFromAlbumContext(ctx context.Context, slug string, ids ...string) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := i.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin removing from album %s: %w", slug, err)
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		_, err = tx.ExecContext(ctx, "DELETE FROM album_image WHERE album_slug = (?) AND image_id = (?);", slug, id)
+		if err != nil {
+			return fmt.Errorf("could not remove image %s from album %s: %w", id, slug, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func checkAlbumAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return AlbumNotFound
+	}
+	return nil
+}
+
+func containsAlbum(albums []Album, slug string) bool {
+	for _, a := range albums {
+		if a.Slug == slug {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wobwainwwight/sa-photos/db"
+	"github.com/wobwainwwight/sa-photos/db/dbtest"
+)
+
+func TestAlbums(t *testing.T) {
+
+	t.Run("should start with the south america album", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		albums, err := table.ListAlbums()
+		require.NoError(t, err)
+		require.Len(t, albums, 1)
+		assert.Equal(t, "south-america", albums[0].Slug)
+		assert.Equal(t, "South America", albums[0].Name)
+	})
+
+	t.Run("should create albums after existing ones", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		_, err := table.CreateAlbum("europe-2025", "Europe 2025")
+		require.NoError(t, err)
+		_, err = table.CreateAlbum("wales", "Wales")
+		require.NoError(t, err)
+
+		assertAlbumOrder(t, table, "south-america", "europe-2025", "wales")
+	})
+
+	t.Run("should not create duplicate album", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		_, err := table.CreateAlbum("south-america", "South America Again")
+		assert.Equal(t, db.DuplicateAlbum, err)
+	})
+
+	t.Run("should only create albums with valid slugs", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		for _, slug := range []string{"", "Europe", "europe 2025", "-europe", "europe-", "europe/2025"} {
+			_, err := table.CreateAlbum(slug, "Europe")
+			assert.Equalf(t, db.InvalidSlug, err, "slug %q", slug)
+		}
+	})
+
+	t.Run("should rename album", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		require.NoError(t, table.RenameAlbum("south-america", "Sudamérica"))
+
+		album, err := table.GetAlbum("south-america")
+		require.NoError(t, err)
+		assert.Equal(t, "Sudamérica", album.Name)
+
+		assert.Equal(t, db.AlbumNotFound, table.RenameAlbum("not-here", "Not Here"))
+	})
+
+	t.Run("should reorder albums", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		for _, slug := range []string{"a", "b", "c", "d"} {
+			_, err := table.CreateAlbum(slug, slug)
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, table.ReorderAlbums("c", "a"))
+		assertAlbumOrder(t, table, "c", "a", "south-america", "b", "d")
+
+		err := table.ReorderAlbums("b", "not-here")
+		assert.ErrorIs(t, err, db.AlbumNotFound)
+		assertAlbumOrder(t, table, "c", "a", "south-america", "b", "d")
+	})
+
+	t.Run("should list images in album", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		imgs := dbtest.GivenSaved(t, table, dbtest.SpaceByHour([]db.Image{
+			dbtest.GivenImage(t),
+			dbtest.GivenImage(t),
+			dbtest.GivenImage(t),
+			dbtest.GivenImage(t),
+			dbtest.GivenImage(t),
+		})...)
+
+		_, err := table.CreateAlbum("wales", "Wales")
+		require.NoError(t, err)
+		dbtest.GivenInAlbum(t, table, "wales", imgs[1], imgs[3], imgs[4])
+
+		list, err := table.GetList(db.WithAlbum("wales"), db.WithLimit(2))
+		require.NoError(t, err)
+		require.Len(t, list.Images, 2)
+		assert.Equal(t, imgs[1].ID, list.Images[0].ID)
+		assert.Equal(t, imgs[3].ID, list.Images[1].ID)
+
+		list, err = table.GetList(db.WithCursorStr(list.Cursor.EncodedString()))
+		require.NoError(t, err)
+		require.Len(t, list.Images, 1)
+		assert.Equal(t, imgs[4].ID, list.Images[0].ID)
+
+		require.NoError(t, table.RemoveFromAlbum("wales", imgs[3].ID))
+		require.NoError(t, table.Delete(imgs[4].ID))
+
+		list, err = table.GetList(db.WithAlbum("wales"))
+		require.NoError(t, err)
+		require.Len(t, list.Images, 1)
+		assert.Equal(t, imgs[1].ID, list.Images[0].ID)
+	})
+
+	t.Run("should not add to album that does not exist", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		img := dbtest.GivenSaved(t, table, dbtest.GivenImage(t))[0]
+		assert.Equal(t, db.AlbumNotFound, table.AddToAlbum("not-here", img.ID))
+	})
+
+}
+
+func assertAlbumOrder(t *testing.T, table dbtest.TestTable, slugs ...string) {
+	albums, err := table.ListAlbums()
+	require.NoError(t, err)
+
+	actual := make([]string, len(albums))
+	for i, a := range albums {
+		actual[i] = a.Slug
+	}
+	assert.Equal(t, slugs, actual)
+}
+
+func TestSlug(t *testing.T) {
+	for name, slug := range map[string]string{
+		"Chile":                "chile",
+		"Puerto Natales":       "puerto-natales",
+		"Valparaíso":           "valparaiso",
+		"San Pedro de Atacama": "san-pedro-de-atacama",
+		" Cusco (Old Town) ":   "cusco-old-town",
+	} {
+		assert.Equal(t, slug, db.Slug(name))
+	}
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The actions recorded in the audit log
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+)
+
+// AuditEvent is a change made to an image and who made it. Before and
+// After are the image as JSON either side of the change, they're null
+// when the image didn't exist or was deleted.
+type AuditEvent struct {
+	ID        int64           `json:"id"`
+	Username  string          `json:"username"`
+	Action    string          `json:"action"`
+	ImageID   string          `json:"imageId"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+type AuditList struct {
+	Events []AuditEvent
+	Cursor *Cursor
+}
+
+// AddAuditEvent records a change to an image, before and after are
+// marshalled to JSON and either can be nil
+func (i *ImageTable) AddAuditEvent(username, action, imageID string, before, after *Image) error {
+	return i.AddAuditEventContext(context.Background(), username, action, imageID, before, after)
+}
+
+func (i *ImageTable) AddAuditEventContext(ctx context.Context, username, action, imageID string, before, after *Image) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	beforeJSON, err := auditJSON(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := auditJSON(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = i.DB.ExecContext(ctx, `INSERT INTO audit_event (username, action, image_id, before, after, created_at)
+		VALUES (?, ?, ?, ?, ?, ?);`,
+		username, action, imageID, beforeJSON, afterJSON, time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("could not add %s audit event for %s: %w", action, imageID, err)
+	}
+	return nil
+}
+
+func auditJSON(img *Image) (any, error) {
+	if img == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(img)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal image %s for audit: %w", img.ID, err)
+	}
+	return string(b), nil
+}
+
+// GetAuditEvents pages through the audit log, newest first unless the
+// opts say otherwise. Only the order, limit and start key of the opts
+// are used, the start key being the ID of the last event of the
+// previous page.
+func (i *ImageTable) GetAuditEvents(opts ...GetListOptsFn) (AuditList, error) {
+	return i.GetAuditEventsContext(context.Background(), opts...)
+}
+
+func (i *ImageTable) GetAuditEventsContext(ctx context.Context, opts ...GetListOptsFn) (AuditList, error) {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	opt, err := auditOpts(opts)
+	if err != nil {
+		return AuditList{}, err
+	}
+
+	w := where{}
+	if len(opt.ExclStartKey) > 0 {
+		startID, err := strconv.ParseInt(opt.ExclStartKey, 10, 64)
+		if err != nil {
+			return AuditList{}, fmt.Errorf("%w: audit start key must be a number", InvalidCursor)
+		}
+		if opt.Order == ASC {
+			w.add("id > (?)", startID)
+		} else {
+			w.add("id < (?)", startID)
+		}
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("SELECT id, username, action, image_id, COALESCE(before, 'null'), COALESCE(after, 'null'), created_at FROM audit_event")
+	sb.WriteString(w.String())
+	if opt.Order == ASC {
+		sb.WriteString(" ORDER BY id ASC")
+	} else {
+		sb.WriteString(" ORDER BY id DESC")
+	}
+	sb.WriteString(" LIMIT (?);")
+
+	rows, err := i.DB.QueryContext(ctx, sb.String(), append(w.args, opt.Limit)...)
+	if err != nil {
+		return AuditList{}, fmt.Errorf("could not get audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []AuditEvent{}
+	for rows.Next() {
+		e := AuditEvent{}
+		before, after := "", ""
+		err = rows.Scan(&e.ID, &e.Username, &e.Action, &e.ImageID, &before, &after, &e.CreatedAt)
+		if err != nil {
+			return AuditList{}, fmt.Errorf("could not scan audit event: %w", err)
+		}
+		e.Before = json.RawMessage(before)
+		e.After = json.RawMessage(after)
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		return AuditList{}, fmt.Errorf("could not get audit events: %w", err)
+	}
+
+	return newAuditList(opt, events)
+}
+
+// auditOpts applies the options of a GetAuditEvents over the defaults of
+// the newest 50 events
+func auditOpts(opts []GetListOptsFn) (GetListOpts, error) {
+	opt := GetListOpts{Order: DESC, Limit: 50}
+	for _, option := range opts {
+		err := option(&opt)
+		if err != nil {
+			return GetListOpts{}, err
+		}
+	}
+	return opt, nil
+}
+
+// newAuditList is a page of events with the cursor for the next page,
+// only the order, start key and limit are kept in the cursor
+func newAuditList(opt GetListOpts, events []AuditEvent) (AuditList, error) {
+	if len(events) > 0 {
+		opt.ExclStartKey = strconv.FormatInt(events[len(events)-1].ID, 10)
+	}
+
+	cursor, err := NewCursor(GetListOpts{
+		Order:        opt.Order,
+		ExclStartKey: opt.ExclStartKey,
+		Limit:        opt.Limit,
+	})
+	if err != nil {
+		return AuditList{}, fmt.Errorf("could not create cursor on GetAuditEvents: %w", err)
+	}
+
+	return AuditList{
+		Events: events,
+		Cursor: cursor,
+	}, nil
+}
@@ -0,0 +1,88 @@
+package db_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wobwainwwight/sa-photos/db"
+	"github.com/wobwainwwight/sa-photos/db/dbtest"
+)
+
+func TestAudit(t *testing.T) {
+
+	t.Run("should record before and after", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		img := dbtest.GivenImage(t)
+		updated := img
+		updated.Title = "Torres del Paine"
+
+		require.NoError(t, table.AddAuditEvent("wob", db.AuditUpdate, img.ID, &img, &updated))
+		require.NoError(t, table.AddAuditEvent("saw", db.AuditDelete, img.ID, &updated, nil))
+
+		list, err := table.GetAuditEvents()
+		require.NoError(t, err)
+		require.Len(t, list.Events, 2)
+
+		deleted := list.Events[0]
+		assert.Equal(t, "saw", deleted.Username)
+		assert.Equal(t, db.AuditDelete, deleted.Action)
+		assert.Equal(t, img.ID, deleted.ImageID)
+		assert.JSONEq(t, "null", string(deleted.After))
+
+		update := list.Events[1]
+		assert.Equal(t, "wob", update.Username)
+		assert.Equal(t, db.AuditUpdate, update.Action)
+
+		before, after := db.Image{}, db.Image{}
+		require.NoError(t, json.Unmarshal(update.Before, &before))
+		require.NoError(t, json.Unmarshal(update.After, &after))
+		assert.Equal(t, "", before.Title)
+		assert.Equal(t, "Torres del Paine", after.Title)
+	})
+
+	t.Run("should page through events with cursor", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		ids := []string{}
+		for range 7 {
+			img := dbtest.GivenImage(t)
+			ids = append(ids, img.ID)
+			require.NoError(t, table.AddAuditEvent("wob", db.AuditCreate, img.ID, nil, &img))
+		}
+
+		pageThrough := func(t *testing.T, opts ...db.GetListOptsFn) []string {
+			found := []string{}
+			list, err := table.GetAuditEvents(opts...)
+			require.NoError(t, err)
+			for len(list.Events) > 0 {
+				assert.LessOrEqual(t, len(list.Events), 3)
+				for _, e := range list.Events {
+					found = append(found, e.ImageID)
+				}
+				list, err = table.GetAuditEvents(db.WithCursorStr(list.Cursor.EncodedString()))
+				require.NoError(t, err)
+			}
+			return found
+		}
+
+		newest := []string{}
+		for i := len(ids) - 1; i >= 0; i-- {
+			newest = append(newest, ids[i])
+		}
+		assert.Equal(t, newest, pageThrough(t, db.WithLimit(3)))
+		assert.Equal(t, ids, pageThrough(t, db.WithLimit(3), db.WithAscOrder()))
+	})
+
+	t.Run("should not accept cursors of image lists", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		_, err := table.GetAuditEvents(db.WithExclStartKey("not-a-number"))
+		assert.ErrorIs(t, err, db.InvalidCursor)
+	})
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// snapshotPrefix, snapshotSuffix and snapshotLayout name snapshots so that they sort
+// oldest first, e.g. saws-20240301T150405Z.sqlite
+const snapshotPrefix = "saws-"
+const snapshotSuffix = ".sqlite"
+const snapshotLayout = "20060102T150405Z"
+
+// Backup writes a consistent copy of the database to path with VACUUM
+// INTO, it can be done while the database is in use. The path must not
+// already exist.
+func (i *ImageTable) Backup(path string) error {
+	return i.BackupContext(context.Background(), path)
+}
+
+// BackupContext is not given the QueryTimeout as copying the whole
+// database takes longer than a query should
+func (i *ImageTable) BackupContext(ctx context.Context, path string) error {
+	_, err := i.DB.ExecContext(ctx, "VACUUM INTO (?);", path)
+	if err != nil {
+		return fmt.Errorf("could not backup to %s: %w", path, err)
+	}
+	return nil
+}
+
+// SnapshotPath is where a snapshot taken at t goes in dir
+func SnapshotPath(dir string, t time.Time) string {
+	return filepath.Join(dir, snapshotPrefix+t.UTC().Format(snapshotLayout)+snapshotSuffix)
+}
+
+// Snapshots are the paths of the snapshots in dir, oldest first. Other
+// files in dir are left out.
+func Snapshots(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read snapshots in %s: %w", dir, err)
+	}
+
+	paths := []string{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+		_, err = time.Parse(snapshotLayout, strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix))
+		if err != nil {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+// Snapshot backs up the catalogue into dir with the time in its name, then
+// removes all but the newest keep snapshots. It returns the path of the
+// new snapshot.
+func Snapshot(ctx context.Context, bc BackupCatalogue, dir string, now time.Time, keep int) (string, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return "", fmt.Errorf("could not create backup dir %s: %w", dir, err)
+	}
+
+	path := SnapshotPath(dir, now)
+	err = bc.BackupContext(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	return path, PruneSnapshots(dir, keep)
+}
+
+// PruneSnapshots removes all but the newest keep snapshots in dir
+func PruneSnapshots(dir string, keep int) error {
+	paths, err := Snapshots(dir)
+	if err != nil {
+		return err
+	}
+
+	for len(paths) > keep {
+		err = os.Remove(paths[0])
+		if err != nil {
+			return fmt.Errorf("could not remove old snapshot: %w", err)
+		}
+		paths = paths[1:]
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package db_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wobwainwwight/sa-photos/db"
+	"github.com/wobwainwwight/sa-photos/db/dbtest"
+)
+
+func TestBackup(t *testing.T) {
+
+	t.Run("should backup to a database with the same images", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		imgs := dbtest.GivenSaved(t, table, dbtest.SpaceByHour([]db.Image{dbtest.GivenImage(t), dbtest.GivenImage(t)})...)
+
+		path := filepath.Join(t.TempDir(), "backup.sqlite")
+		require.NoError(t, table.Backup(path))
+
+		backup, err := db.NewImageTable("file:" + path)
+		require.NoError(t, err)
+		defer backup.Close()
+
+		list, err := backup.GetList(db.WithLimit(10))
+		require.NoError(t, err)
+		require.Len(t, list.Images, 2)
+		assert.Equal(t, imgs[0].ID, list.Images[0].ID)
+		assert.Equal(t, imgs[1].ID, list.Images[1].ID)
+
+		assert.Error(t, table.Backup(path), "should not overwrite backups")
+	})
+
+	t.Run("should keep the newest snapshots", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a snapshot"), 0o644))
+
+		start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		paths := []string{}
+		for i := 0; i < 4; i++ {
+			path, err := db.Snapshot(context.Background(), table, dir, start.AddDate(0, 0, i), 2)
+			require.NoError(t, err)
+			assert.Equal(t, db.SnapshotPath(dir, start.AddDate(0, 0, i)), path)
+			paths = append(paths, path)
+		}
+
+		snapshots, err := db.Snapshots(dir)
+		require.NoError(t, err)
+		assert.Equal(t, paths[2:], snapshots)
+		assert.FileExists(t, filepath.Join(dir, "notes.txt"))
+		assert.Equal(t, filepath.Join(dir, "saws-20240304T120000Z.sqlite"), paths[3])
+	})
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Catalogue is where the details of images are kept. ImageTable keeps
+// them in SQLite and MemoryCatalogue keeps them in memory, GetList pages
+// through both with the same cursors. The Context variants of the methods
+// give up once the context is done.
+type Catalogue interface {
+	Save(img Image) error
+	Insert(img Image) error
+	Update(img Image) error
+	GetByID(id string) (Image, error)
+	GetList(opts ...GetListOptsFn) (ImageList, error)
+	Delete(id string) error
+	GetLocalities() ([]Locality, error)
+	Facets(opts ...GetListOptsFn) (Facets, error)
+	GetStats(opts ...GetListOptsFn) (Stats, error)
+
+	SaveContext(ctx context.Context, img Image) error
+	InsertContext(ctx context.Context, img Image) error
+	UpdateContext(ctx context.Context, img Image) error
+	GetByIDContext(ctx context.Context, id string) (Image, error)
+	GetListContext(ctx context.Context, opts ...GetListOptsFn) (ImageList, error)
+	DeleteContext(ctx context.Context, id string) error
+	GetLocalitiesContext(ctx context.Context) ([]Locality, error)
+	FacetsContext(ctx context.Context, opts ...GetListOptsFn) (Facets, error)
+	GetStatsContext(ctx context.Context, opts ...GetListOptsFn) (Stats, error)
+}
+
+type TagCatalogue interface {
+	AddTags(id string, tags ...string) error
+	RemoveTags(id string, tags ...string) error
+	SetTags(id string, tags ...string) error
+	UpdateWithTags(img Image, tags ...string) error
+	GetTags() ([]string, error)
+
+	AddTagsContext(ctx context.Context, id string, tags ...string) error
+	RemoveTagsContext(ctx context.Context, id string, tags ...string) error
+	SetTagsContext(ctx context.Context, id string, tags ...string) error
+	UpdateWithTagsContext(ctx context.Context, img Image, tags ...string) error
+	GetTagsContext(ctx context.Context) ([]string, error)
+}
+
+type AlbumCatalogue interface {
+	CreateAlbum(slug, name string) (Album, error)
+	GetAlbum(slug string) (Album, error)
+	ListAlbums() ([]Album, error)
+	RenameAlbum(slug, name string) error
+	ReorderAlbums(slugs ...string) error
+	AddToAlbum(slug string, ids ...string) error
+	RemoveFromAlbum(slug string, ids ...string) error
+
+	CreateAlbumContext(ctx context.Context, slug, name string) (Album, error)
+	GetAlbumContext(ctx context.Context, slug string) (Album, error)
+	ListAlbumsContext(ctx context.Context) ([]Album, error)
+	RenameAlbumContext(ctx context.Context, slug, name string) error
+	ReorderAlbumsContext(ctx context.Context, slugs ...string) error
+	AddToAlbumContext(ctx context.Context, slug string, ids ...string) error
+	RemoveFromAlbumContext(ctx context.Context, slug string, ids ...string) error
+}
+
+type TrashCatalogue interface {
+	Trash(id string) error
+	Restore(id string) error
+	GetTrash() ([]Image, error)
+	GetTrashedBefore(before time.Time) ([]Image, error)
+	Purge(id string, before time.Time) error
+
+	TrashContext(ctx context.Context, id string) error
+	RestoreContext(ctx context.Context, id string) error
+	GetTrashContext(ctx context.Context) ([]Image, error)
+	GetTrashedBeforeContext(ctx context.Context, before time.Time) ([]Image, error)
+	PurgeContext(ctx context.Context, id string, before time.Time) error
+}
+
+type AuditLog interface {
+	AddAuditEvent(username, action, imageID string, before, after *Image) error
+	GetAuditEvents(opts ...GetListOptsFn) (AuditList, error)
+
+	AddAuditEventContext(ctx context.Context, username, action, imageID string, before, after *Image) error
+	GetAuditEventsContext(ctx context.Context, opts ...GetListOptsFn) (AuditList, error)
+}
+
+// DuplicateCatalogue finds images that look like the same photo by the
+// Hamming distance between their DHashes
+type DuplicateCatalogue interface {
+	GetDuplicates(maxDistance int) ([]DuplicatePair, error)
+	KeepBoth(id, otherID string) error
+	SetDHash(id, dhash string) error
+	GetUnhashed() ([]string, error)
+
+	GetDuplicatesContext(ctx context.Context, maxDistance int) ([]DuplicatePair, error)
+	KeepBothContext(ctx context.Context, id, otherID string) error
+	SetDHashContext(ctx context.Context, id, dhash string) error
+	GetUnhashedContext(ctx context.Context) ([]string, error)
+}
+
+// OrientationCatalogue finds the images saved before they were turned
+// the right way up so that they can be measured again
+type OrientationCatalogue interface {
+	GetUnoriented() ([]string, error)
+	SetOriented(img Image) error
+
+	GetUnorientedContext(ctx context.Context) ([]string, error)
+	SetOrientedContext(ctx context.Context, img Image) error
+}
+
+// BackupCatalogue can copy itself to a file while it is in use, only
+// ImageTable can as MemoryCatalogue has nothing to copy
+type BackupCatalogue interface {
+	Backup(path string) error
+	BackupContext(ctx context.Context, path string) error
+}
+
+// FullCatalogue is a catalogue of images along with their tags, albums,
+// trash, duplicates, orientation and audit log
+type FullCatalogue interface {
+	Catalogue
+	TagCatalogue
+	AlbumCatalogue
+	TrashCatalogue
+	DuplicateCatalogue
+	OrientationCatalogue
+	AuditLog
+}
+
+var _ FullCatalogue = (*ImageTable)(nil)
+var _ FullCatalogue = (*MemoryCatalogue)(nil)
+var _ BackupCatalogue = (*ImageTable)(nil)
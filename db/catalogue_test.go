@@ -0,0 +1,53 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wobwainwwight/sa-photos/db"
+	"github.com/wobwainwwight/sa-photos/db/dbtest"
+)
+
+func TestImageTableCatalogue(t *testing.T) {
+	dbtest.TestCatalogue(t, func(t *testing.T) db.Catalogue {
+		table := dbtest.NewTestTable(t)
+		t.Cleanup(func() { table.Close() })
+		return table.ImageTable
+	})
+}
+
+func TestMemoryCatalogue(t *testing.T) {
+	dbtest.TestCatalogue(t, func(t *testing.T) db.Catalogue {
+		return db.NewMemoryCatalogue()
+	})
+}
+
+func TestCataloguesShareCursors(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+	memory := db.NewMemoryCatalogue()
+
+	imgs := dbtest.SpaceByHour([]db.Image{
+		dbtest.GivenImage(t), dbtest.GivenImage(t), dbtest.GivenImage(t),
+		dbtest.GivenImage(t), dbtest.GivenImage(t), dbtest.GivenImage(t),
+	})
+	dbtest.GivenSaved(t, table, imgs...)
+	dbtest.GivenSaved(t, memory, imgs...)
+
+	// each page is got from one catalogue with the cursor of the other
+	catalogues := []db.Catalogue{table.ImageTable, memory}
+	list, err := catalogues[0].GetList(db.WithDescOrder(), db.WithLimit(2))
+	require.NoError(t, err)
+
+	found := []string{}
+	for i := 1; len(list.Images) > 0; i++ {
+		for _, img := range list.Images {
+			found = append(found, img.ID)
+		}
+		list, err = catalogues[i%2].GetList(db.WithCursorStr(list.Cursor.EncodedString()))
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{imgs[5].ID, imgs[4].ID, imgs[3].ID, imgs[2].ID, imgs[1].ID, imgs[0].ID}, found)
+}
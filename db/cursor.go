@@ -2,18 +2,94 @@ package db
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
+var InvalidCursor = errors.New("invalid cursor")
+
+// cursorVersion is the prefix of encoded cursors. Cursors from before
+// they were versioned are unsigned base64 and are treated as version 1.
+// Version 3 stores localities as country and locality pairs.
+const cursorVersion = "v3"
+
+// legacyCursorVersion is the last version with bare locality names, it's
+// accepted until CursorConfig.LegacyUntil like unversioned cursors
+const legacyCursorVersion = "v2"
+
+var versionPattern = regexp.MustCompile(`^v[0-9]+\.`)
+
+// CursorConfig is how encoded cursors are signed and checked
+type CursorConfig struct {
+	// Secret is the HMAC key cursors are signed with, it must be at least
+	// 16 bytes and be the same across restarts for cursors to survive them
+	Secret []byte
+	// LegacyUntil is when unsigned and v2 cursors stop being accepted,
+	// the zero time never accepts them
+	LegacyUntil time.Time
+}
+
+// cursorConfig defaults to a random secret so that cursors are always
+// signed, ConfigureCursors should be called to keep it between restarts
+var cursorConfig = CursorConfig{Secret: randomSecret()}
+
+func ConfigureCursors(cfg CursorConfig) error {
+	if len(cfg.Secret) < 16 {
+		return errors.New("cursor secret must be at least 16 bytes")
+	}
+	cursorConfig = cfg
+	return nil
+}
+
+// CursorConfiguration returns the config cursors are currently signed with
+func CursorConfiguration() CursorConfig {
+	return cursorConfig
+}
+
+func randomSecret() []byte {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		panic("could not generate cursor secret: " + err.Error())
+	}
+	return secret
+}
+
+func signCursor(s string) []byte {
+	mac := hmac.New(sha256.New, cursorConfig.Secret)
+	mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
+
+// escapeValue stops values containing the characters that separate
+// them from breaking the cursor, e.g. a country with a comma in it
+var escapeValue = strings.NewReplacer("%", "%25", string(divider), "%7C", string(arrSep), "%2C").Replace
+var unescapeValue = strings.NewReplacer("%25", "%", "%7C", string(divider), "%2C", string(arrSep)).Replace
+
 const orderKey = rune('o')
 const countriesKey = rune('c')
+const localitiesKey = rune('n')
 const pageKey = rune('p')
 const eskKey = rune('e')
+const eskCreatedAtKey = rune('s')
 const limitKey = rune('l')
+const albumKey = rune('a')
+const tagsKey = rune('t')
+const tagMatchKey = rune('m')
+const queryKey = rune('q')
+const fromKey = rune('f')
+const toKey = rune('u')
+const boundsKey = rune('b')
+const radiusKey = rune('r')
 
 const divider = rune('|')
 const arrSep = rune(',')
@@ -25,9 +101,19 @@ func NewCursor(opts GetListOpts) (*Cursor, error) {
 	keys := []rune{
 		orderKey,
 		countriesKey,
+		localitiesKey,
 		pageKey,
 		eskKey,
+		eskCreatedAtKey,
 		limitKey,
+		albumKey,
+		tagsKey,
+		tagMatchKey,
+		queryKey,
+		fromKey,
+		toKey,
+		boundsKey,
+		radiusKey,
 	}
 
 	var err error
@@ -49,6 +135,14 @@ func NewCursor(opts GetListOpts) (*Cursor, error) {
 					return nil, fmt.Errorf("could not write divider for cursor: %w", err)
 				}
 			}
+		case localitiesKey:
+			if len(opts.Localities) > 0 {
+				err = writeKV(&sb, writeRune(k), writeStringSlice(flattenPlaces(opts.Localities)))
+				_, err = sb.WriteRune(divider)
+				if err != nil {
+					return nil, fmt.Errorf("could not write divider for cursor: %w", err)
+				}
+			}
 		case pageKey:
 			if opts.Page > 0 {
 				err = writeKV(&sb, writeRune(k), writeInt(opts.Page))
@@ -65,6 +159,14 @@ func NewCursor(opts GetListOpts) (*Cursor, error) {
 					return nil, fmt.Errorf("could not write divider for cursor: %w", err)
 				}
 			}
+		case eskCreatedAtKey:
+			if !opts.ExclStartCreatedAt.IsZero() {
+				err = writeKV(&sb, writeRune(k), writeString(opts.ExclStartCreatedAt.Format(time.RFC3339Nano)))
+				_, err = sb.WriteRune(divider)
+				if err != nil {
+					return nil, fmt.Errorf("could not write divider for cursor: %w", err)
+				}
+			}
 		case limitKey:
 			if opts.Limit > 0 {
 				err = writeKV(&sb, writeRune(k), writeInt(opts.Limit))
@@ -73,6 +175,72 @@ func NewCursor(opts GetListOpts) (*Cursor, error) {
 					return nil, fmt.Errorf("could not write divider for cursor: %w", err)
 				}
 			}
+		case albumKey:
+			if len(opts.Album) > 0 {
+				err = writeKV(&sb, writeRune(k), writeString(opts.Album))
+				_, err = sb.WriteRune(divider)
+				if err != nil {
+					return nil, fmt.Errorf("could not write divider for cursor: %w", err)
+				}
+			}
+		case tagsKey:
+			if len(opts.Tags) > 0 {
+				err = writeKV(&sb, writeRune(k), writeStringSlice(opts.Tags))
+				_, err = sb.WriteRune(divider)
+				if err != nil {
+					return nil, fmt.Errorf("could not write divider for cursor: %w", err)
+				}
+			}
+		case tagMatchKey:
+			if len(opts.TagMatch) > 0 {
+				err = writeKV(&sb, writeRune(k), writeString(string(opts.TagMatch)))
+				_, err = sb.WriteRune(divider)
+				if err != nil {
+					return nil, fmt.Errorf("could not write divider for cursor: %w", err)
+				}
+			}
+		case queryKey:
+			if len(opts.Query) > 0 {
+				err = writeKV(&sb, writeRune(k), writeString(opts.Query))
+				_, err = sb.WriteRune(divider)
+				if err != nil {
+					return nil, fmt.Errorf("could not write divider for cursor: %w", err)
+				}
+			}
+		case fromKey:
+			if !opts.From.IsZero() {
+				err = writeKV(&sb, writeRune(k), writeString(opts.From.Format(time.RFC3339Nano)))
+				_, err = sb.WriteRune(divider)
+				if err != nil {
+					return nil, fmt.Errorf("could not write divider for cursor: %w", err)
+				}
+			}
+		case toKey:
+			if !opts.To.IsZero() {
+				err = writeKV(&sb, writeRune(k), writeString(opts.To.Format(time.RFC3339Nano)))
+				_, err = sb.WriteRune(divider)
+				if err != nil {
+					return nil, fmt.Errorf("could not write divider for cursor: %w", err)
+				}
+			}
+		case boundsKey:
+			if !opts.Bounds.IsZero() {
+				b := opts.Bounds
+				err = writeKV(&sb, writeRune(k), writeFloats(b.South, b.West, b.North, b.East))
+				_, err = sb.WriteRune(divider)
+				if err != nil {
+					return nil, fmt.Errorf("could not write divider for cursor: %w", err)
+				}
+			}
+		case radiusKey:
+			if !opts.Radius.IsZero() {
+				r := opts.Radius
+				err = writeKV(&sb, writeRune(k), writeFloats(r.Lat, r.Long, r.Km))
+				_, err = sb.WriteRune(divider)
+				if err != nil {
+					return nil, fmt.Errorf("could not write divider for cursor: %w", err)
+				}
+			}
 		}
 
 		if err != nil {
@@ -86,8 +254,9 @@ func NewCursor(opts GetListOpts) (*Cursor, error) {
 	str = strings.TrimLeftFunc(str, func(r rune) bool { return r == divider })
 
 	return &Cursor{
-		str:  str,
-		opts: opts,
+		str:     str,
+		opts:    opts,
+		escaped: true,
 	}, nil
 }
 
@@ -120,7 +289,7 @@ func writeRune(r rune) sbWriter {
 
 func writeString(s string) sbWriter {
 	return func(b *strings.Builder) error {
-		_, err := b.WriteString(s)
+		_, err := b.WriteString(escapeValue(s))
 		return err
 	}
 }
@@ -132,10 +301,45 @@ func writeInt(i int) sbWriter {
 	}
 }
 
+// flattenPlaces writes places as country, locality, country, locality...
+// so they can be stored as a string slice
+func flattenPlaces(places []Place) []string {
+	ss := make([]string, 0, len(places)*2)
+	for _, p := range places {
+		ss = append(ss, p.Country, p.Locality)
+	}
+	return ss
+}
+
+// scopePlaces reads the bare locality names of older cursors as places in
+// each of the countries, which is how they were filtered. Without
+// countries they can't be scoped so they're ignored, as in links.
+func scopePlaces(countries []string, localities []string) []Place {
+	var places []Place
+	for _, country := range countries {
+		for _, locality := range localities {
+			places = append(places, Place{Country: country, Locality: locality})
+		}
+	}
+	return places
+}
+
+// pairPlaces reads places back from flattenPlaces
+func pairPlaces(ss []string) ([]Place, error) {
+	if len(ss)%2 != 0 {
+		return nil, errors.New("localities must be country and locality pairs")
+	}
+	places := make([]Place, 0, len(ss)/2)
+	for i := 0; i < len(ss); i += 2 {
+		places = append(places, Place{Country: ss[i], Locality: ss[i+1]})
+	}
+	return places, nil
+}
+
 func writeStringSlice(ss []string) sbWriter {
 	return func(b *strings.Builder) error {
 		for i, s := range ss {
-			_, err := b.WriteString(s)
+			_, err := b.WriteString(escapeValue(s))
 			if err != nil {
 				return err
 			}
@@ -149,6 +353,14 @@ func writeStringSlice(ss []string) sbWriter {
 
 }
 
+func writeFloats(fs ...float64) sbWriter {
+	ss := make([]string, len(fs))
+	for i, f := range fs {
+		ss[i] = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return writeStringSlice(ss)
+}
+
 func ParseCursor(cursorStr string) (*Cursor, error) {
 	cursor := Cursor{}
 	err := cursor.Parse(cursorStr)
@@ -164,10 +376,14 @@ func MustParseCursor(cursorStr string) *Cursor {
 }
 
 type Cursor struct {
-	Debug  bool
-	opts   GetListOpts
-	str    string
-	reader *bytes.Reader
+	Debug   bool
+	opts    GetListOpts
+	str     string
+	reader  *bytes.Reader
+	escaped bool
+	// bareLocalities is whether the cursor is from before localities
+	// were stored with their country
+	bareLocalities bool
 }
 
 func (c *Cursor) Opts() GetListOpts {
@@ -178,28 +394,88 @@ func (c *Cursor) String() string {
 	return c.str
 }
 
+// EncodedString is the cursor signed so that it can be handed out and
+// trusted when it comes back, in the form v3.<base64 cursor>.<base64 hmac>
 func (c *Cursor) EncodedString() string {
-	return base64.URLEncoding.EncodeToString([]byte(c.str))
+	signed := cursorVersion + "." + base64.RawURLEncoding.EncodeToString([]byte(c.str))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signCursor(signed))
 }
 
+// Parse reads a cursor from EncodedString. Unsigned cursors, either base64
+// or already decoded, and v2 cursors are only accepted until
+// CursorConfig.LegacyUntil.
+// Any cursor that can't be read or trusted returns InvalidCursor.
 func (c *Cursor) Parse(cursorStr string) error {
+	err := c.parse(cursorStr)
+	if err != nil {
+		return fmt.Errorf("%w: %w", InvalidCursor, err)
+	}
+	return nil
+}
+
+func (c *Cursor) decode(cursorStr string) error {
+	if !versionPattern.MatchString(cursorStr) {
+		if !time.Now().Before(cursorConfig.LegacyUntil) {
+			return errors.New("unversioned cursors are no longer accepted")
+		}
+
+		dec, err := base64.URLEncoding.DecodeString(cursorStr)
+		if err != nil {
+			c.debugf("cursor is not b64 assuming decoded: %s\n", cursorStr)
+
+			c.str = cursorStr
+		} else {
+			c.str = string(dec)
+		}
+		c.escaped = false
+		c.bareLocalities = true
+		return nil
+	}
+
+	version, rest, _ := strings.Cut(cursorStr, ".")
+	switch {
+	case version == cursorVersion:
+		c.bareLocalities = false
+	case version == legacyCursorVersion && time.Now().Before(cursorConfig.LegacyUntil):
+		c.bareLocalities = true
+	default:
+		return fmt.Errorf("unknown cursor version %s", version)
+	}
+
+	body, sig, ok := strings.Cut(rest, ".")
+	if !ok {
+		return errors.New("cursor is not signed")
+	}
+
+	sigBytes, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(sigBytes, signCursor(version+"."+body)) {
+		return errors.New("cursor signature does not match")
+	}
+
+	dec, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return fmt.Errorf("could not decode cursor: %w", err)
+	}
+	c.str = string(dec)
+	c.escaped = true
+	return nil
+}
+
+func (c *Cursor) parse(cursorStr string) error {
 	c.debugf("received cursor for parsing: %s\n", cursorStr)
 
 	if len(strings.TrimSpace(cursorStr)) == 0 {
 		return c.setToDefault()
 	}
 
-	dec, err := base64.URLEncoding.DecodeString(cursorStr)
+	err := c.decode(cursorStr)
 	if err != nil {
-		c.debugf("cursor is not b64 assuming decoded: %s\n", cursorStr)
-
-		c.str = cursorStr
-	} else {
-		c.str = string(dec)
+		return err
 	}
 
 	c.opts = GetListOpts{}
 	c.reader = bytes.NewReader([]byte(c.str))
+	var bareLocalities []string
 
 	c.debugf("beginning parse: %s\n", c.str)
 
@@ -242,13 +518,34 @@ func (c *Cursor) Parse(cursorStr string) error {
 				return err
 			}
 
-			c.opts.Countries, err = c.readCountries()
+			c.opts.Countries, err = c.readStringSlice()
 			if err != nil {
 				err = fmt.Errorf("could not read countries from cursor: %w", err)
 				c.debugln(err.Error())
 				return err
 			}
 
+		case byte(localitiesKey):
+			err = c.checkReadRune(colon)
+			if err != nil {
+				err = fmt.Errorf("could not read localities from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
+
+			var places []string
+			places, err = c.readStringSlice()
+			if err == nil && c.bareLocalities {
+				bareLocalities = places
+			} else if err == nil {
+				c.opts.Localities, err = pairPlaces(places)
+			}
+			if err != nil {
+				err = fmt.Errorf("could not read localities from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
+
 		case byte(pageKey):
 			err = c.checkReadRune(colon)
 			if err != nil {
@@ -276,6 +573,19 @@ func (c *Cursor) Parse(cursorStr string) error {
 				c.debugln(err.Error())
 				return err
 			}
+		case byte(eskCreatedAtKey):
+			err = c.checkReadRune(colon)
+			if err != nil {
+				err = fmt.Errorf("could not read excl start created at from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
+			c.opts.ExclStartCreatedAt, err = c.readTime()
+			if err != nil {
+				err = fmt.Errorf("could not read excl start created at from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
 		case byte(limitKey):
 			err = c.checkReadRune(colon)
 			if err != nil {
@@ -289,9 +599,120 @@ func (c *Cursor) Parse(cursorStr string) error {
 				c.debugln(err.Error())
 				return err
 			}
+		case byte(albumKey):
+			err = c.checkReadRune(colon)
+			if err != nil {
+				err = fmt.Errorf("could not read album from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
+			c.opts.Album, err = c.readString()
+			if err != nil {
+				err = fmt.Errorf("could not read album from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
+		case byte(tagsKey):
+			err = c.checkReadRune(colon)
+			if err != nil {
+				err = fmt.Errorf("could not read tags from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
+			c.opts.Tags, err = c.readStringSlice()
+			if err != nil {
+				err = fmt.Errorf("could not read tags from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
+		case byte(tagMatchKey):
+			err = c.checkReadRune(colon)
+			if err != nil {
+				err = fmt.Errorf("could not read tag match from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
+			tagMatch, err := c.readString()
+			if err != nil {
+				err = fmt.Errorf("could not read tag match from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
+			c.opts.TagMatch = TagMatch(tagMatch)
+		case byte(fromKey):
+			err = c.checkReadRune(colon)
+			if err != nil {
+				err = fmt.Errorf("could not read from from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
+			c.opts.From, err = c.readTime()
+			if err != nil {
+				err = fmt.Errorf("could not read from from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
+		case byte(toKey):
+			err = c.checkReadRune(colon)
+			if err != nil {
+				err = fmt.Errorf("could not read to from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
+			c.opts.To, err = c.readTime()
+			if err != nil {
+				err = fmt.Errorf("could not read to from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
+		case byte(boundsKey):
+			err = c.checkReadRune(colon)
+			if err != nil {
+				err = fmt.Errorf("could not read bounds from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
+			fs, err := c.readFloats(4)
+			if err != nil {
+				err = fmt.Errorf("could not read bounds from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
+			c.opts.Bounds = Bounds{South: fs[0], West: fs[1], North: fs[2], East: fs[3]}
+		case byte(radiusKey):
+			err = c.checkReadRune(colon)
+			if err != nil {
+				err = fmt.Errorf("could not read radius from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
+			fs, err := c.readFloats(3)
+			if err != nil {
+				err = fmt.Errorf("could not read radius from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
+			c.opts.Radius = Radius{Lat: fs[0], Long: fs[1], Km: fs[2]}
+		case byte(queryKey):
+			err = c.checkReadRune(colon)
+			if err != nil {
+				err = fmt.Errorf("could not read query from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
+			c.opts.Query, err = c.readString()
+			if err != nil {
+				err = fmt.Errorf("could not read query from cursor: %w", err)
+				c.debugln(err.Error())
+				return err
+			}
 		}
 	}
 
+	if c.bareLocalities {
+		c.opts.Localities = scopePlaces(c.opts.Countries, bareLocalities)
+	}
+
 	return nil
 }
 
@@ -340,11 +761,11 @@ func (c *Cursor) readOrder() (Order, error) {
 
 }
 
-func (c *Cursor) readCountries() ([]string, error) {
-	c.debugln("readCountries")
+func (c *Cursor) readStringSlice() ([]string, error) {
+	c.debugln("readStringSlice")
 
-	countries := []string{}
-	currCountry := []byte{}
+	values := []string{}
+	currValue := []byte{}
 
 	var err error
 	dividerFound := false
@@ -357,24 +778,24 @@ func (c *Cursor) readCountries() ([]string, error) {
 		}
 
 		if berr == io.EOF {
-			c.debugf("appending country: %s\n", string(currCountry))
-			countries = append(countries, string(currCountry))
+			c.debugf("appending value: %s\n", string(currValue))
+			values = append(values, string(currValue))
 			err = berr
 			break
 		}
 
 		switch rune(b) {
 		case arrSep:
-			c.debugf("appending country: %s\n", string(currCountry))
+			c.debugf("appending value: %s\n", string(currValue))
 
-			countries = append(countries, string(currCountry))
-			currCountry = []byte{}
+			values = append(values, string(currValue))
+			currValue = []byte{}
 		case divider:
-			c.debugf("appending country: %s\n", string(currCountry))
-			countries = append(countries, string(currCountry))
+			c.debugf("appending value: %s\n", string(currValue))
+			values = append(values, string(currValue))
 			dividerFound = true
 		default:
-			currCountry = append(currCountry, b)
+			currValue = append(currValue, b)
 		}
 
 		if dividerFound {
@@ -389,8 +810,12 @@ func (c *Cursor) readCountries() ([]string, error) {
 		return nil, err
 	}
 
-	c.debugf("countries: %v\n", countries)
-	return countries, nil
+	for i := range values {
+		values[i] = c.unescape(values[i])
+	}
+
+	c.debugf("values: %v\n", values)
+	return values, nil
 }
 
 func (c *Cursor) readInt() (int, error) {
@@ -438,7 +863,43 @@ func (c *Cursor) readString() (string, error) {
 		return "", err
 	}
 
-	return string(stringBytes), nil
+	return c.unescape(string(stringBytes)), nil
+}
+
+// readFloats reads a slice of exactly n numbers
+func (c *Cursor) readFloats(n int) ([]float64, error) {
+	ss, err := c.readStringSlice()
+	if err != nil {
+		return nil, err
+	}
+	if len(ss) != n {
+		return nil, fmt.Errorf("expected %d numbers but got %d", n, len(ss))
+	}
+
+	fs := make([]float64, n)
+	for i, s := range ss {
+		fs[i], err = strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fs, nil
+}
+
+func (c *Cursor) readTime() (time.Time, error) {
+	s, err := c.readString()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// unescape undoes escapeValue, values in unversioned cursors weren't escaped
+func (c *Cursor) unescape(s string) string {
+	if !c.escaped {
+		return s
+	}
+	return unescapeValue(s)
 }
 
 func (c *Cursor) debugln(msg string) {
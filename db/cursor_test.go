@@ -1,14 +1,19 @@
 package db_test
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/wobwainwwight/sa-photos/db"
+	"github.com/wobwainwwight/sa-photos/db/dbtest"
 )
 
 func TestNewCursor(t *testing.T) {
@@ -80,6 +85,8 @@ func TestParseCursor(t *testing.T) {
 	})
 
 	t.Run("should handle decoded and encoded strings", func(t *testing.T) {
+		dbtest.AcceptLegacyCursors(t)
+
 		opts := db.GetListOpts{
 			Order:        db.ASC,
 			Countries:    []string{"United States", "Chile", "Argentina"},
@@ -136,6 +143,22 @@ func TestParseCursor(t *testing.T) {
 				opts: db.GetListOpts{Order: db.ASC, ExclStartKey: "abc123"},
 				exp:  "o:ASC|e:abc123",
 			},
+			{
+				opts: db.GetListOpts{Album: "south-america", Tags: []string{"food", "street art"}, TagMatch: db.MatchAllTags},
+				exp:  "a:south-america|t:food,street art|m:all",
+			},
+			{
+				opts: db.GetListOpts{Album: "south-america", Query: "puerto natales"},
+				exp:  "a:south-america|q:puerto natales",
+			},
+			{
+				opts: db.GetListOpts{Bounds: db.Bounds{South: -54, West: -76.5, North: -50, East: -68.25}},
+				exp:  "b:-54,-76.5,-50,-68.25",
+			},
+			{
+				opts: db.GetListOpts{Radius: db.Radius{Lat: -51.7236, Long: -72.5064, Km: 150}},
+				exp:  "r:-51.7236,-72.5064,150",
+			},
 		}
 
 		for _, tt := range tests {
@@ -149,7 +172,107 @@ func TestParseCursor(t *testing.T) {
 		}
 	})
 
+	t.Run("should parse album, tags and query", func(t *testing.T) {
+		opts := db.GetListOpts{
+			Order:    db.DESC,
+			Album:    "south-america",
+			Tags:     []string{"food", "street art"},
+			TagMatch: db.MatchAnyTag,
+			Query:    "puerto natales",
+			Limit:    5,
+		}
+
+		cursor, err := db.NewCursor(opts)
+		require.NoError(t, err)
+
+		parsed, err := db.ParseCursor(cursor.EncodedString())
+		require.NoError(t, err)
+		assert.Equal(t, opts, parsed.Opts())
+	})
+
+	t.Run("should parse compound start key", func(t *testing.T) {
+		dbtest.AcceptLegacyCursors(t)
+
+		opts := db.GetListOpts{
+			Order:              db.ASC,
+			ExclStartKey:       "abc123",
+			ExclStartCreatedAt: time.Date(2024, 3, 1, 9, 30, 15, 123456789, time.FixedZone("", -3*60*60)),
+			Limit:              5,
+		}
+
+		cursor, err := db.NewCursor(opts)
+		require.NoError(t, err)
+		assert.Equal(t, "o:ASC|e:abc123|s:2024-03-01T09:30:15.123456789-03:00|l:5", cursor.String())
+
+		parsed, err := db.ParseCursor(cursor.EncodedString())
+		require.NoError(t, err)
+		assert.True(t, opts.ExclStartCreatedAt.Equal(parsed.Opts().ExclStartCreatedAt))
+		assert.Equal(t, opts.ExclStartCreatedAt.Format(time.RFC3339Nano), parsed.Opts().ExclStartCreatedAt.Format(time.RFC3339Nano))
+		assert.Equal(t, opts.ExclStartKey, parsed.Opts().ExclStartKey)
+
+		_, err = db.ParseCursor("o:ASC|e:abc123|s:yesterday")
+		assert.Error(t, err)
+	})
+
+	t.Run("should parse localities", func(t *testing.T) {
+		opts := db.GetListOpts{
+			Order:      db.ASC,
+			Countries:  []string{"Chile"},
+			Localities: []db.Place{{Country: "Chile", Locality: "Puerto Natales"}, {Country: "Chile", Locality: "Torres del Paine"}},
+			Limit:      5,
+		}
+
+		cursor, err := db.NewCursor(opts)
+		require.NoError(t, err)
+		assert.Equal(t, "o:ASC|c:Chile|n:Chile,Puerto Natales,Chile,Torres del Paine|l:5", cursor.String())
+
+		parsed, err := db.ParseCursor(cursor.EncodedString())
+		require.NoError(t, err)
+		assert.Equal(t, opts, parsed.Opts())
+	})
+
+	t.Run("should parse date range", func(t *testing.T) {
+		opts := db.GetListOpts{
+			Order: db.ASC,
+			Limit: 5,
+			From:  time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			To:    time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC),
+		}
+
+		cursor, err := db.NewCursor(opts)
+		require.NoError(t, err)
+		assert.Equal(t, "o:ASC|l:5|f:2024-03-01T00:00:00Z|u:2024-03-08T00:00:00Z", cursor.String())
+
+		parsed, err := db.ParseCursor(cursor.EncodedString())
+		require.NoError(t, err)
+		assert.Equal(t, opts, parsed.Opts())
+	})
+
+	t.Run("should parse bounds and radius", func(t *testing.T) {
+		opts := db.GetListOpts{
+			Order:  db.ASC,
+			Limit:  100,
+			Bounds: db.Bounds{South: -54, West: -76.5, North: -50, East: -68.25},
+			Radius: db.Radius{Lat: -51.7236, Long: -72.5064, Km: 150},
+		}
+
+		cursor, err := db.NewCursor(opts)
+		require.NoError(t, err)
+
+		parsed, err := db.ParseCursor(cursor.EncodedString())
+		require.NoError(t, err)
+		assert.Equal(t, opts, parsed.Opts())
+
+		dbtest.AcceptLegacyCursors(t)
+		_, err = db.ParseCursor("o:ASC|b:-54,-76.5,-50")
+		assert.ErrorIs(t, err, db.InvalidCursor)
+		_, err = db.ParseCursor("o:ASC|r:-51.7,north,150")
+		assert.ErrorIs(t, err, db.InvalidCursor)
+	})
+
 	t.Run("should be able to handle any ordering", func(t *testing.T) {
+		dbtest.AcceptLegacyCursors(t)
+
 		opts := db.GetListOpts{
 			Order:        db.ASC,
 			Countries:    []string{"United States", "Chile", "Argentina"},
@@ -180,3 +303,121 @@ func TestParseCursor(t *testing.T) {
 	})
 
 }
+
+func TestSignedCursor(t *testing.T) {
+	opts := db.GetListOpts{
+		Order:     db.ASC,
+		Countries: []string{"Korea, Republic of", "A|B", "100%"},
+		Album:     "south-america",
+		Limit:     5,
+	}
+
+	t.Run("should escape separators in values", func(t *testing.T) {
+		cursor, err := db.NewCursor(opts)
+		require.NoError(t, err)
+		assert.Equal(t, "o:ASC|c:Korea%2C Republic of,A%7CB,100%25|l:5|a:south-america", cursor.String())
+
+		parsed, err := db.ParseCursor(cursor.EncodedString())
+		require.NoError(t, err)
+		assert.Equal(t, opts, parsed.Opts())
+	})
+
+	t.Run("should reject tampered cursors", func(t *testing.T) {
+		cursor, err := db.NewCursor(opts)
+		require.NoError(t, err)
+
+		parts := strings.Split(cursor.EncodedString(), ".")
+		require.Len(t, parts, 3)
+		assert.Equal(t, "v3", parts[0])
+
+		tampered := base64.RawURLEncoding.EncodeToString([]byte("o:ASC|l:100000"))
+		_, err = db.ParseCursor(strings.Join([]string{parts[0], tampered, parts[2]}, "."))
+		assert.ErrorIs(t, err, db.InvalidCursor)
+
+		_, err = db.ParseCursor(parts[0] + "." + parts[1])
+		assert.ErrorIs(t, err, db.InvalidCursor)
+
+		_, err = db.ParseCursor(parts[0] + "." + parts[1] + ".not-the-signature")
+		assert.ErrorIs(t, err, db.InvalidCursor)
+	})
+
+	t.Run("should reject cursors signed with another secret", func(t *testing.T) {
+		cursor, err := db.NewCursor(opts)
+		require.NoError(t, err)
+		encoded := cursor.EncodedString()
+
+		prev := db.CursorConfiguration()
+		require.NoError(t, db.ConfigureCursors(db.CursorConfig{Secret: []byte("another secret of enough length")}))
+		defer db.ConfigureCursors(prev)
+
+		_, err = db.ParseCursor(encoded)
+		assert.ErrorIs(t, err, db.InvalidCursor)
+	})
+
+	t.Run("should reject unknown versions", func(t *testing.T) {
+		cursor, err := db.NewCursor(opts)
+		require.NoError(t, err)
+
+		_, err = db.ParseCursor("v4" + strings.TrimPrefix(cursor.EncodedString(), "v3"))
+		assert.ErrorIs(t, err, db.InvalidCursor)
+
+		_, err = db.ParseCursor("v1." + base64.URLEncoding.EncodeToString([]byte("o:ASC|l:5")))
+		assert.ErrorIs(t, err, db.InvalidCursor)
+	})
+
+	t.Run("should not accept short secrets", func(t *testing.T) {
+		assert.Error(t, db.ConfigureCursors(db.CursorConfig{Secret: []byte("short")}))
+	})
+
+	t.Run("should only accept unsigned cursors in the transition window", func(t *testing.T) {
+		legacy := base64.URLEncoding.EncodeToString([]byte("o:DESC|c:Chile|l:1000"))
+
+		prev := db.CursorConfiguration()
+		defer db.ConfigureCursors(prev)
+
+		require.NoError(t, db.ConfigureCursors(db.CursorConfig{Secret: prev.Secret}))
+		_, err := db.ParseCursor(legacy)
+		assert.ErrorIs(t, err, db.InvalidCursor, "zero LegacyUntil should not accept legacy cursors")
+
+		require.NoError(t, db.ConfigureCursors(db.CursorConfig{Secret: prev.Secret, LegacyUntil: time.Now().Add(time.Hour)}))
+		cursor, err := db.ParseCursor(legacy)
+		require.NoError(t, err)
+		assert.Equal(t, db.GetListOpts{Order: db.DESC, Countries: []string{"Chile"}, Limit: 1000}, cursor.Opts())
+
+		require.NoError(t, db.ConfigureCursors(db.CursorConfig{Secret: prev.Secret, LegacyUntil: time.Now().Add(-time.Hour)}))
+		_, err = db.ParseCursor(legacy)
+		assert.ErrorIs(t, err, db.InvalidCursor)
+	})
+
+	t.Run("should only accept v2 cursors in the transition window", func(t *testing.T) {
+		prev := db.CursorConfiguration()
+		defer db.ConfigureCursors(prev)
+
+		// v2 cursors were signed the same way but had bare locality names
+		body := "v2." + base64.RawURLEncoding.EncodeToString([]byte("o:DESC|c:Chile,Argentina|n:Santiago|l:5"))
+		mac := hmac.New(sha256.New, prev.Secret)
+		mac.Write([]byte(body))
+		v2 := body + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+		require.NoError(t, db.ConfigureCursors(db.CursorConfig{Secret: prev.Secret}))
+		_, err := db.ParseCursor(v2)
+		assert.ErrorIs(t, err, db.InvalidCursor, "zero LegacyUntil should not accept v2 cursors")
+
+		require.NoError(t, db.ConfigureCursors(db.CursorConfig{Secret: prev.Secret, LegacyUntil: time.Now().Add(time.Hour)}))
+		cursor, err := db.ParseCursor(v2)
+		require.NoError(t, err)
+		assert.Equal(t, db.GetListOpts{
+			Order:     db.DESC,
+			Countries: []string{"Chile", "Argentina"},
+			Localities: []db.Place{
+				{Country: "Chile", Locality: "Santiago"},
+				{Country: "Argentina", Locality: "Santiago"},
+			},
+			Limit: 5,
+		}, cursor.Opts())
+
+		require.NoError(t, db.ConfigureCursors(db.CursorConfig{Secret: prev.Secret, LegacyUntil: time.Now().Add(-time.Hour)}))
+		_, err = db.ParseCursor(v2)
+		assert.ErrorIs(t, err, db.InvalidCursor)
+	})
+}
@@ -1,9 +1,12 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -11,8 +14,12 @@ import (
 )
 
 var DuplicateImage = errors.New("duplicate image")
+var InvalidDateRange = errors.New("date range must start before it ends")
 var NotFound = errors.New("image not found")
 
+// DefaultQueryTimeout is the QueryTimeout of a new ImageTable
+const DefaultQueryTimeout = 10 * time.Second
+
 func NewImageTable(dsn string) (*ImageTable, error) {
 	if len(strings.TrimSpace(dsn)) == 0 {
 		dsn = "file:saws.sqlite"
@@ -23,13 +30,10 @@ func NewImageTable(dsn string) (*ImageTable, error) {
 		return nil, err
 	}
 
-	i := ImageTable{db}
-	_, ok, err := i.CheckImageTableExists()
-	if !ok {
-		err = i.CreateImageTable()
-		if err != nil {
-			return nil, err
-		}
+	i := ImageTable{DB: db, QueryTimeout: DefaultQueryTimeout}
+	err = i.Migrate()
+	if err != nil {
+		return nil, err
 	}
 	return &i, nil
 }
@@ -43,6 +47,7 @@ func CheckImageTableExists(db *sql.DB) (TableInfo, bool, error) {
 	if err != nil {
 		return TableInfo{}, false, err
 	}
+	defer r.Close()
 
 	t := TableInfo{}
 	if r.Next() {
@@ -55,6 +60,8 @@ func CheckImageTableExists(db *sql.DB) (TableInfo, bool, error) {
 	return t, t.Name == "image", nil
 }
 
+// CreateImageTable creates the image table as it was before migrations,
+// NewImageTable brings the schema up to date with Migrate instead
 func (i *ImageTable) CreateImageTable() error {
 	_, err := i.DB.Exec(`CREATE TABLE image (
 	    id TEXT PRIMARY KEY,
@@ -72,22 +79,53 @@ func (i *ImageTable) CreateImageTable() error {
 	return err
 }
 
+// Save adds an image or, if it already exists, updates its editable
+// fields as Update does
 func (i *ImageTable) Save(img Image) error {
-	_, err := i.DB.Exec(`
+	return i.SaveContext(context.Background(), img)
+}
+
+func (i *ImageTable) SaveContext(ctx context.Context, img Image) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	err := i.InsertContext(ctx, img)
+	if err == DuplicateImage {
+		return i.UpdateContext(ctx, img)
+	}
+	return err
+}
+
+// Insert adds a new image, returning DuplicateImage if it already exists.
+// UploadedAt is now unless the image was uploaded before, e.g. when it's
+// imported.
+func (i *ImageTable) Insert(img Image) error {
+	return i.InsertContext(context.Background(), img)
+}
+
+func (i *ImageTable) InsertContext(ctx context.Context, img Image) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	_, err := i.DB.ExecContext(ctx, `
 		INSERT INTO image
-		(id, mime_type, width, height, thumbhash, lat, long, locality, country, created_at)
-		VALUES (?,?,?,?,?,?,?,?,?,?)
-		ON CONFLICT DO UPDATE SET country=excluded.country,locality=excluded.locality;`,
+		(id, mime_type, width, height, thumbhash, dhash, lat, long, title, caption, alt_text, locality, country, created_at, uploaded_at)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,COALESCE(?, CURRENT_TIMESTAMP));`,
 		img.ID,
 		img.MimeType,
 		img.Width,
 		img.Height,
 		img.ThumbHash,
+		img.DHash,
 		img.Lat,
 		img.Long,
+		img.Title,
+		img.Caption,
+		img.AltText,
 		img.Locality,
 		img.Country,
 		img.CreatedAt,
+		sql.NullTime{Time: img.UploadedAt, Valid: !img.UploadedAt.IsZero()},
 	)
 
 	sqlErr, ok := err.(sqlite.Error)
@@ -102,8 +140,55 @@ func (i *ImageTable) Save(img Image) error {
 	return err
 }
 
+// Update sets the editable fields of an existing image, these are the
+// ones describing it rather than the ones read from the file
+func (i *ImageTable) Update(img Image) error {
+	return i.UpdateContext(context.Background(), img)
+}
+
+func (i *ImageTable) UpdateContext(ctx context.Context, img Image) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	return updateImage(ctx, i.DB, img)
+}
+
+// updateImage writes the fields of an image that can be changed, with
+// either the DB or a transaction
+func updateImage(ctx context.Context, e execer, img Image) error {
+	res, err := e.ExecContext(ctx, `
+		UPDATE image SET title = (?), caption = (?), alt_text = (?), locality = (?), country = (?)
+		WHERE id = (?) AND deleted_at IS NULL;`,
+		img.Title,
+		img.Caption,
+		img.AltText,
+		img.Locality,
+		img.Country,
+		img.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("could not update image %s: %w", img.ID, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return NotFound
+	}
+	return nil
+}
+
 func (i *ImageTable) GetByID(id string) (Image, error) {
-	row := i.DB.QueryRow("SELECT DISTINCT * FROM image WHERE id = (?);", id)
+	return i.GetByIDContext(context.Background(), id)
+}
+
+func (i *ImageTable) GetByIDContext(ctx context.Context, id string) (Image, error) {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	row := i.DB.QueryRowContext(ctx, "SELECT "+imageColumns+" FROM image WHERE id = (?) AND deleted_at IS NULL;", id)
 	if err := row.Err(); err != nil {
 		return Image{}, err
 	}
@@ -116,16 +201,47 @@ type Order string
 const ASC = Order("ASC")
 const DESC = Order("DESC")
 
+// TagMatch is how images are matched when filtering by more than one tag
+type TagMatch string
+
+// MatchAnyTag matches images that have at least one of the tags
+const MatchAnyTag = TagMatch("any")
+
+// MatchAllTags matches images that have every one of the tags
+const MatchAllTags = TagMatch("all")
+
 type GetListOptsFn func(*GetListOpts) error
 
 type GetListOpts struct {
-	Order        Order    `json:"order"`
-	Countries    []string `json:"countries"`
-	Page         int      `json:"page"`
-	ExclStartKey string   `json:"exclStartKey"`
-	Limit        int      `json:"limit"`
+	Order     Order    `json:"order"`
+	Countries []string `json:"countries"`
+	// Localities narrow the countries they're in down to those towns and
+	// cities, countries without a locality picked are shown whole
+	Localities []Place `json:"localities"`
+	Page       int     `json:"page"`
+	// ExclStartKey and ExclStartCreatedAt are the (created_at, id) key of
+	// the image to start after. If only the ID is set then the created_at
+	// is looked up from the image.
+	ExclStartKey       string    `json:"exclStartKey"`
+	ExclStartCreatedAt time.Time `json:"exclStartCreatedAt"`
+	Limit              int       `json:"limit"`
+	Album              string    `json:"album"`
+	Tags               []string  `json:"tags"`
+	TagMatch           TagMatch  `json:"tagMatch"`
+	Query              string    `json:"query"`
+	// From and To limit the list to images created in [From, To), either
+	// can be left as the zero time to not limit that end
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Bounds and Radius limit the list to images taken in an area
+	Bounds Bounds `json:"bounds"`
+	Radius Radius `json:"radius"`
 }
 
+// pageSize is the number of images on each page when listing by Page
+// rather than with a start key
+const pageSize = 5
+
 type ImageList struct {
 	Images []Image
 	Cursor *Cursor
@@ -140,67 +256,46 @@ var DefaultOpts = GetListOpts{
 }
 
 func (i *ImageTable) GetList(opts ...GetListOptsFn) (ImageList, error) {
-	opt := DefaultOpts
-
-	for _, option := range opts {
-		err := option(&opt)
-		if err != nil {
-			return ImageList{}, err
-		}
-	}
-
-	args := []any{}
-	sb := strings.Builder{}
-	sb.WriteString("SELECT * FROM image")
-
-	if len(opt.ExclStartKey) > 0 || len(opt.Countries) > 0 {
-		sb.WriteString(" WHERE ")
-
-		if len(opt.ExclStartKey) > 0 {
-			sb.WriteString("created_at")
+	return i.GetListContext(context.Background(), opts...)
+}
 
-			if opt.Order == ASC {
-				sb.WriteString(" > ")
-			} else {
-				sb.WriteString(" < ")
-			}
+func (i *ImageTable) GetListContext(ctx context.Context, opts ...GetListOptsFn) (ImageList, error) {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
 
-			sb.WriteString("( SELECT created_at FROM image WHERE id = (?) )")
-			args = append(args, opt.ExclStartKey)
-		}
+	opt, err := listOpts(opts)
+	if err != nil {
+		return ImageList{}, err
+	}
 
-		if len(opt.Countries) > 0 && len(opt.ExclStartKey) > 0 {
-			sb.WriteString(" AND ")
+	w := filterWhere(opt)
 
+	// images are ordered by (created_at, id) rather than created_at alone
+	// so that images with the same created_at aren't skipped between pages
+	if len(opt.ExclStartKey) > 0 {
+		cmp := "<"
+		if opt.Order == ASC {
+			cmp = ">"
 		}
-
-		if len(opt.Countries) > 0 {
-			sb.WriteString("country IN (")
-
-			for i := range opt.Countries {
-				sb.WriteString("?")
-
-				if i == len(opt.Countries)-1 {
-					sb.WriteString(")")
-				} else {
-					sb.WriteString(",")
-				}
-
-				args = append(args, opt.Countries[i])
-			}
+		if opt.ExclStartCreatedAt.IsZero() {
+			w.add("(created_at, id) "+cmp+" ( SELECT created_at, id FROM image WHERE id = (?) )", opt.ExclStartKey)
+		} else {
+			w.add("(created_at, id) "+cmp+" ((?), (?))", opt.ExclStartCreatedAt, opt.ExclStartKey)
 		}
 	}
 
-	sb.WriteString(" ORDER BY created_at")
+	args := w.args
+	sb := strings.Builder{}
+	sb.WriteString("SELECT " + imageColumns + " FROM image")
+	sb.WriteString(w.String())
 
 	if opt.Order == ASC {
-		sb.WriteString(" ASC")
+		sb.WriteString(" ORDER BY created_at ASC, id ASC")
 	} else {
-		sb.WriteString(" DESC")
+		sb.WriteString(" ORDER BY created_at DESC, id DESC")
 	}
 
 	if opt.Page > 0 && len(opt.ExclStartKey) == 0 {
-		pageSize := 5
 		sb.WriteString(" LIMIT (?) OFFSET (?)")
 		args = append(args, pageSize)
 		args = append(args, pageSize*(opt.Page-1))
@@ -213,7 +308,7 @@ func (i *ImageTable) GetList(opts ...GetListOptsFn) (ImageList, error) {
 
 	q := sb.String()
 
-	rows, err := i.DB.Query(q, args...)
+	rows, err := i.DB.QueryContext(ctx, q, args...)
 	if err != nil {
 		return ImageList{}, fmt.Errorf("could not get image rows: %w", err)
 	}
@@ -227,9 +322,79 @@ func (i *ImageTable) GetList(opts ...GetListOptsFn) (ImageList, error) {
 		}
 		imgs = append(imgs, img)
 	}
+	if err = rows.Err(); err != nil {
+		return ImageList{}, fmt.Errorf("could not get image rows: %w", err)
+	}
+
+	return newImageList(opt, imgs)
+}
+
+// filterWhere is the conditions for the images that pass the filters of
+// the opts, leaving out the start key
+func filterWhere(opt GetListOpts) where {
+	w := where{}
+	w.add("deleted_at IS NULL")
+
+	if len(opt.Countries) > 0 || len(opt.Localities) > 0 {
+		w.addPlaces(placeScopes(opt.Countries, opt.Localities))
+	}
+
+	if len(opt.Album) > 0 {
+		w.add("id IN ( SELECT image_id FROM album_image WHERE album_slug = (?) )", opt.Album)
+	}
+
+	if !opt.From.IsZero() {
+		w.add("datetime(created_at) >= datetime(?)", opt.From.UTC().Format(time.DateTime))
+	}
+
+	if !opt.To.IsZero() {
+		w.add("datetime(created_at) < datetime(?)", opt.To.UTC().Format(time.DateTime))
+	}
+
+	if !opt.Bounds.IsZero() {
+		w.addBounds(opt.Bounds)
+	}
+
+	if !opt.Radius.IsZero() {
+		w.addRadius(opt.Radius)
+	}
+
+	if len(opt.Query) > 0 {
+		w.add("id IN ( SELECT image_id FROM image_search WHERE image_search MATCH (?) )", searchExpr(opt.Query))
+	}
+
+	if len(opt.Tags) > 0 {
+		tw := where{}
+		tw.addIn("name", opt.Tags)
+		if opt.TagMatch == MatchAllTags {
+			w.add("id IN ( SELECT image_id FROM tag"+tw.String()+" GROUP BY image_id HAVING COUNT(DISTINCT name) = (?) )",
+				append(tw.args, len(uniqueStrings(opt.Tags)))...)
+		} else {
+			w.add("id IN ( SELECT image_id FROM tag"+tw.String()+" )", tw.args...)
+		}
+	}
+
+	return w
+}
+
+// listOpts applies the options of a GetList over DefaultOpts
+func listOpts(opts []GetListOptsFn) (GetListOpts, error) {
+	opt := DefaultOpts
+	for _, option := range opts {
+		err := option(&opt)
+		if err != nil {
+			return GetListOpts{}, err
+		}
+	}
+	return opt, nil
+}
 
+// newImageList is a page of images with the cursor for the next page,
+// which starts after the last image
+func newImageList(opt GetListOpts, imgs []Image) (ImageList, error) {
 	if len(imgs) > 0 {
 		opt.ExclStartKey = imgs[len(imgs)-1].ID
+		opt.ExclStartCreatedAt = imgs[len(imgs)-1].CreatedAt
 	}
 
 	cursor, err := NewCursor(opt)
@@ -278,6 +443,38 @@ func WithCountries(countries ...string) GetListOptsFn {
 	}
 }
 
+// WithLocalities limits the countries of the localities to images taken
+// in those localities
+func WithLocalities(localities ...Place) GetListOptsFn {
+	return func(glo *GetListOpts) error {
+		glo.Localities = localities
+		return nil
+	}
+}
+
+func WithAlbum(slug string) GetListOptsFn {
+	return func(glo *GetListOpts) error {
+		glo.Album = slug
+		return nil
+	}
+}
+
+// WithTags filters to images tagged with any or all of the tags depending on match
+func WithTags(match TagMatch, tags ...string) GetListOptsFn {
+	return func(glo *GetListOpts) error {
+		if match != MatchAnyTag && match != MatchAllTags {
+			return fmt.Errorf("invalid tag match: %s", match)
+		}
+		tags, err := normaliseTags(tags)
+		if err != nil {
+			return err
+		}
+		glo.TagMatch = match
+		glo.Tags = tags
+		return nil
+	}
+}
+
 func WithLimit(limit int) GetListOptsFn {
 	return func(glo *GetListOpts) error {
 		glo.Limit = limit
@@ -314,28 +511,120 @@ func WithPage(page int) GetListOptsFn {
 func WithExclStartKey(startKey string) GetListOptsFn {
 	return func(glo *GetListOpts) error {
 		glo.ExclStartKey = startKey
+		glo.ExclStartCreatedAt = time.Time{}
 		return nil
 	}
 }
 
+// WithDateRange limits the list to images created from, and including,
+// from up to but not including to. Either can be the zero time.
+func WithDateRange(from, to time.Time) GetListOptsFn {
+	return func(glo *GetListOpts) error {
+		if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+			return InvalidDateRange
+		}
+		glo.From = from
+		glo.To = to
+		return nil
+	}
+}
+
+// WithExclStartImage starts the list after the given image, saving the
+// lookup of its created_at that WithExclStartKey needs
+func WithExclStartImage(img Image) GetListOptsFn {
+	return func(glo *GetListOpts) error {
+		glo.ExclStartKey = img.ID
+		glo.ExclStartCreatedAt = img.CreatedAt
+		return nil
+	}
+}
+
+// where builds up the conditions of a WHERE clause, joining them with AND
+type where struct {
+	conds []string
+	args  []any
+}
+
+func (w *where) add(cond string, args ...any) {
+	w.conds = append(w.conds, cond)
+	w.args = append(w.args, args...)
+}
+
+func (w *where) addIn(column string, values []string) {
+	sb := strings.Builder{}
+	sb.WriteString(column)
+	sb.WriteString(" IN (")
+	for i, v := range values {
+		sb.WriteString("?")
+		if i < len(values)-1 {
+			sb.WriteString(",")
+		}
+		w.args = append(w.args, v)
+	}
+	sb.WriteString(")")
+	w.conds = append(w.conds, sb.String())
+}
+
+// addPlaces matches images in any of the scopes, either a whole country
+// or some of its localities
+func (w *where) addPlaces(scopes []placeScope) {
+	conds := make([]string, len(scopes))
+	for i, s := range scopes {
+		if len(s.localities) == 0 {
+			conds[i] = "country = (?)"
+			w.args = append(w.args, s.country)
+			continue
+		}
+		lw := where{}
+		lw.addIn("locality", s.localities)
+		conds[i] = "(country = (?) AND " + lw.conds[0] + ")"
+		w.args = append(w.args, s.country)
+		w.args = append(w.args, lw.args...)
+	}
+	w.conds = append(w.conds, "("+strings.Join(conds, " OR ")+")")
+}
+
+func (w *where) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
+
 type scanner interface {
 	Scan(a ...any) error
 }
 
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// imageColumns are the columns selected for every image, in the order scanImageRow expects
+const imageColumns = `id, mime_type, width, height, thumbhash, dhash, lat, long, title, caption, alt_text, locality, country, created_at, uploaded_at, deleted_at,
+	( SELECT json_group_array(name) FROM ( SELECT name FROM tag WHERE tag.image_id = image.id ORDER BY name ) )`
+
 func (i *ImageTable) scanImageRow(s scanner) (Image, error) {
 	img := Image{}
+	deletedAt := sql.NullTime{}
+	tags := ""
 	err := s.Scan(
 		&img.ID,
 		&img.MimeType,
 		&img.Width,
 		&img.Height,
 		&img.ThumbHash,
+		&img.DHash,
 		&img.Lat,
 		&img.Long,
+		&img.Title,
+		&img.Caption,
+		&img.AltText,
 		&img.Locality,
 		&img.Country,
 		&img.CreatedAt,
 		&img.UploadedAt,
+		&deletedAt,
+		&tags,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -344,61 +633,170 @@ func (i *ImageTable) scanImageRow(s scanner) (Image, error) {
 		}
 		return Image{}, fmt.Errorf("could not scan image row: %w", err)
 	}
+
+	if deletedAt.Valid {
+		img.DeletedAt = &deletedAt.Time
+	}
+
+	err = json.Unmarshal([]byte(tags), &img.Tags)
+	if err != nil {
+		return Image{}, fmt.Errorf("could not read tags of image %s: %w", img.ID, err)
+	}
+	if len(img.Tags) == 0 {
+		img.Tags = nil
+	}
 	return img, nil
 }
 
+// Delete removes an image for good, see Trash for removing an image that
+// can be restored
 func (i *ImageTable) Delete(id string) error {
-	_, err := i.DB.Exec("DELETE FROM image WHERE id = (?)", id)
+	return i.DeleteContext(context.Background(), id)
+}
+
+func (i *ImageTable) DeleteContext(ctx context.Context, id string) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	_, err := i.DB.ExecContext(ctx, "DELETE FROM image WHERE id = (?)", id)
 	if err != nil {
 		return fmt.Errorf("could not remove image %s : %w", id, err)
 	}
 	return nil
 }
 
+// Place is a locality in its country, the same name can be used in more
+// than one country
+type Place struct {
+	Country  string `json:"country"`
+	Locality string `json:"locality"`
+}
+
+// placeScope is a country that images are filtered to, all of it or only
+// the localities picked in it
+type placeScope struct {
+	country    string
+	localities []string
+}
+
+// placeScopes groups the filtered countries and localities by country, so
+// picking a locality narrows its own country without hiding the others
+func placeScopes(countries []string, localities []Place) []placeScope {
+	scopes := []placeScope{}
+	scope := func(country string) *placeScope {
+		i := slices.IndexFunc(scopes, func(s placeScope) bool { return s.country == country })
+		if i < 0 {
+			scopes = append(scopes, placeScope{country: country})
+			i = len(scopes) - 1
+		}
+		return &scopes[i]
+	}
+	for _, c := range countries {
+		scope(c)
+	}
+	for _, l := range localities {
+		s := scope(l.Country)
+		if !slices.Contains(s.localities, l.Locality) {
+			s.localities = append(s.localities, l.Locality)
+		}
+	}
+	return scopes
+}
+
+// inPlaceScopes is whether an image in the country and locality is in
+// any of the scopes
+func inPlaceScopes(scopes []placeScope, country, locality string) bool {
+	return slices.ContainsFunc(scopes, func(s placeScope) bool {
+		return s.country == country && (len(s.localities) == 0 || slices.Contains(s.localities, locality))
+	})
+}
+
 type Locality struct {
 	Country    string
 	Localities []string
 }
 
+// GetLocalities is every country with images and the localities in it,
+// both in name order without duplicates
 func (i *ImageTable) GetLocalities() ([]Locality, error) {
-	res, err := i.DB.Query("SELECT country, locality FROM image WHERE country IS NOT \"\";")
+	return i.GetLocalitiesContext(context.Background())
+}
+
+func (i *ImageTable) GetLocalitiesContext(ctx context.Context) ([]Locality, error) {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	res, err := i.DB.QueryContext(ctx, "SELECT DISTINCT country, locality FROM image WHERE country IS NOT \"\" AND deleted_at IS NULL;")
 	if err != nil {
 		return nil, fmt.Errorf("could not get localities: %w", err)
 	}
+	defer res.Close()
 
-	var countryLocality = make(map[string][]string)
+	localities := []Locality{}
 	for res.Next() {
 		country, locality := "", ""
 		err = res.Scan(&country, &locality)
 		if err != nil {
 			return nil, fmt.Errorf("could not scan country and locality: %w", err)
 		}
-
-		_, ok := countryLocality[country]
-		if !ok {
-			countryLocality[country] = []string{locality}
-		} else {
-			countryLocality[country] = append(countryLocality[country], locality)
-		}
+		localities = addLocality(localities, country, locality)
+	}
+	if err = res.Err(); err != nil {
+		return nil, fmt.Errorf("could not get localities: %w", err)
 	}
 
-	localities := []Locality{}
-	for k, v := range countryLocality {
-		localities = append(localities, Locality{
-			Country:    k,
-			Localities: v,
-		})
+	return sortLocalities(localities), nil
+}
+
+// addLocality adds a locality to its country, blank localities only add
+// the country
+func addLocality(localities []Locality, country, locality string) []Locality {
+	i := slices.IndexFunc(localities, func(l Locality) bool { return l.Country == country })
+	if i < 0 {
+		localities = append(localities, Locality{Country: country, Localities: []string{}})
+		i = len(localities) - 1
 	}
+	if locality != "" && !slices.Contains(localities[i].Localities, locality) {
+		localities[i].Localities = append(localities[i].Localities, locality)
+	}
+	return localities
+}
 
-	return localities, nil
+func sortLocalities(localities []Locality) []Locality {
+	for _, l := range localities {
+		slices.Sort(l.Localities)
+	}
+	slices.SortFunc(localities, func(a, b Locality) int {
+		return strings.Compare(a.Country, b.Country)
+	})
+	return localities
 }
 
 func (i *ImageTable) Close() error {
 	return i.DB.Close()
 }
 
+// ImageTable is the SQLite catalogue of images. Every method that runs a
+// query has a Context variant, the query is stopped when the context is
+// done or after QueryTimeout, whichever is first.
 type ImageTable struct {
 	DB *sql.DB
+	// QueryTimeout is how long each call can take, there's no limit
+	// when it's zero
+	QueryTimeout time.Duration
+}
+
+// withTimeout limits the context to the query timeout
+func (i *ImageTable) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if i.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, i.QueryTimeout)
+}
+
+// IsTimeout is whether an error is from a query that ran out of time
+func IsTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
 }
 
 // TableInfo is the information provided by SQLite's table_list pragma
@@ -422,6 +820,16 @@ type Image struct {
 	UploadedAt time.Time `json:"uploadedAt"`
 	Lat        float64   `json:"lat"`
 	Long       float64   `json:"long"`
+	Title      string    `json:"title"`
+	Caption    string    `json:"caption"`
+	AltText    string    `json:"altText"`
 	Locality   string    `json:"locality"`
 	Country    string    `json:"country"`
+	Tags       []string  `json:"tags,omitempty"`
+	// DeletedAt is when the image was trashed, it is nil for images
+	// that aren't in the trash
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// DHash is a perceptual hash of the image for finding near duplicates,
+	// it is blank for images that haven't been hashed yet
+	DHash string `json:"dhash,omitempty"`
 }
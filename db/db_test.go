@@ -1,6 +1,7 @@
 package db_test
 
 import (
+	"context"
 	"os"
 	"slices"
 	"testing"
@@ -290,7 +291,7 @@ func TestDB(t *testing.T) {
 		})
 		require.NoError(t, err)
 
-		list, err := table.GetList(db.WithCursorStr(cursor.String()))
+		list, err := table.GetList(db.WithCursorStr(cursor.EncodedString()))
 		require.NoError(t, err)
 
 		require.Len(t, list.Images, 2)
@@ -303,13 +304,132 @@ func TestDB(t *testing.T) {
 		assert.Equal(t, imgs[2].ID, list.Images[0].ID)
 		assert.Equal(t, imgs[4].ID, list.Images[1].ID)
 
-		list, err = table.GetList(db.WithCursorStr(list.Cursor.String()))
+		list, err = table.GetList(db.WithCursorStr(list.Cursor.EncodedString()))
 		require.NoError(t, err)
 		require.Len(t, list.Images, 2)
 		assert.Equal(t, imgs[5].ID, list.Images[0].ID)
 		assert.Equal(t, imgs[6].ID, list.Images[1].ID)
 	})
 
+	t.Run("should page through images with the same created at", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		// images without exif all get the same created at
+		imgs := make([]db.Image, 300)
+		for i := range imgs {
+			imgs[i] = dbtest.GivenImage(t)
+			imgs[i].CreatedAt = time.Unix(0, 0)
+		}
+		before := dbtest.GivenImage(t)
+		before.CreatedAt = time.Unix(0, 0).Add(-time.Hour)
+		after := dbtest.GivenImage(t)
+		after.CreatedAt = time.Unix(0, 0).Add(time.Hour)
+		dbtest.GivenSaved(t, table, append(imgs, before, after)...)
+
+		ids := make([]string, len(imgs))
+		for i, img := range imgs {
+			ids[i] = img.ID
+		}
+		slices.Sort(ids)
+		expected := append(append([]string{before.ID}, ids...), after.ID)
+
+		pageThrough := func(t *testing.T, opts ...db.GetListOptsFn) []string {
+			found := []string{}
+			list, err := table.GetList(opts...)
+			require.NoError(t, err)
+			for len(list.Images) > 0 {
+				for _, img := range list.Images {
+					found = append(found, img.ID)
+				}
+				list, err = table.GetList(db.WithCursorStr(list.Cursor.EncodedString()))
+				require.NoError(t, err)
+			}
+			return found
+		}
+
+		t.Run("oldest first", func(t *testing.T) {
+			assert.Equal(t, expected, pageThrough(t, db.WithLimit(7)))
+		})
+
+		t.Run("latest first", func(t *testing.T) {
+			latest := slices.Clone(expected)
+			slices.Reverse(latest)
+			assert.Equal(t, latest, pageThrough(t, db.WithDescOrder(), db.WithLimit(7)))
+		})
+
+		t.Run("from an image id", func(t *testing.T) {
+			list, err := table.GetList(db.WithExclStartKey(ids[149]), db.WithLimit(10))
+			require.NoError(t, err)
+			require.Len(t, list.Images, 10)
+			for i, img := range list.Images {
+				assert.Equal(t, ids[150+i], img.ID)
+			}
+
+			list, err = table.GetList(db.WithExclStartKey(ids[149]), db.WithDescOrder(), db.WithLimit(10))
+			require.NoError(t, err)
+			require.Len(t, list.Images, 10)
+			for i, img := range list.Images {
+				assert.Equal(t, ids[148-i], img.ID)
+			}
+		})
+	})
+
+	t.Run("should filter by date range with cursor", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+		imgs := dbtest.GivenSaved(t, table,
+			givenImageCreatedAt(t, day.Add(-time.Second)),
+			givenImageCreatedAt(t, day),
+			givenImageCreatedAt(t, day.Add(6*time.Hour)),
+			// the same instant as midday in UTC
+			givenImageCreatedAt(t, day.Add(12*time.Hour).In(time.FixedZone("", -3*60*60))),
+			givenImageCreatedAt(t, day.Add(24*time.Hour-time.Second)),
+			givenImageCreatedAt(t, day.Add(24*time.Hour)),
+		)
+
+		tests := []struct {
+			Name            string
+			From            time.Time
+			To              time.Time
+			ExpectedIndexes []int
+		}{
+			{"from is inclusive and to is exclusive", day, day.Add(24 * time.Hour), []int{1, 2, 3, 4}},
+			{"only from", day.Add(12 * time.Hour), time.Time{}, []int{3, 4, 5}},
+			{"only to", time.Time{}, day.Add(12 * time.Hour), []int{0, 1, 2}},
+			{"nothing in range", day.Add(48 * time.Hour), time.Time{}, []int{}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.Name, func(t *testing.T) {
+				ids := []string{}
+
+				list, err := table.GetList(db.WithDateRange(tt.From, tt.To), db.WithLimit(1))
+				require.NoError(t, err)
+				for len(list.Images) > 0 {
+					ids = append(ids, list.Images[0].ID)
+
+					list, err = table.GetList(db.WithCursorStr(list.Cursor.EncodedString()))
+					require.NoError(t, err)
+				}
+
+				expected := []string{}
+				for _, i := range tt.ExpectedIndexes {
+					expected = append(expected, imgs[i].ID)
+				}
+				assert.Equal(t, expected, ids)
+			})
+		}
+
+		_, err := table.GetList(db.WithDateRange(day, day))
+		assert.ErrorIs(t, err, db.InvalidDateRange)
+
+		_, err = table.GetList(db.WithDateRange(day, day.Add(-time.Hour)))
+		assert.ErrorIs(t, err, db.InvalidDateRange)
+	})
+
 	t.Run("should get all localities", func(t *testing.T) {
 		table := dbtest.NewTestTable(t)
 		defer table.Close()
@@ -330,6 +450,32 @@ func TestDB(t *testing.T) {
 
 	})
 
+	t.Run("should not insert an image twice", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		img := dbtest.GivenImage(t)
+		require.NoError(t, table.Insert(img))
+
+		img.Title = "Again"
+		assert.Equal(t, db.DuplicateImage, table.Insert(img))
+
+		fetched, err := table.GetByID(img.ID)
+		require.NoError(t, err)
+		assert.Empty(t, fetched.Title)
+	})
+
+	t.Run("should only update existing images", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		img := dbtest.GivenImage(t)
+		assert.Equal(t, db.NotFound, table.Update(img))
+
+		_, err := table.GetByID(img.ID)
+		assert.Equal(t, db.NotFound, err)
+	})
+
 	t.Run("should upsert", func(t *testing.T) {
 		table := dbtest.NewTestTable(t)
 		defer table.Close()
@@ -374,8 +520,69 @@ func TestDB(t *testing.T) {
 			assertImageEqual(t, upserted, fetched)
 		})
 
+		t.Run("title, caption and alt text", func(t *testing.T) {
+			img := dbtest.GivenImage(t)
+
+			err := table.Save(img)
+			require.NoError(t, err)
+
+			upserted := img
+			upserted.Title = "Torres del Paine"
+			upserted.Caption = "The towers at sunrise, after a 4am start"
+			upserted.AltText = "Three granite peaks lit orange above a glacial lake"
+
+			err = table.Save(upserted)
+			require.NoError(t, err)
+
+			fetched, err := table.GetByID(img.ID)
+			require.NoError(t, err)
+
+			assertImageEqual(t, upserted, fetched)
+		})
+
+	})
+
+	t.Run("should stop queries when the context is done", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		img := dbtest.GivenSaved(t, table, dbtest.GivenImage(t))[0]
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := table.GetByIDContext(ctx, img.ID)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.False(t, db.IsTimeout(err))
+
+		_, err = table.GetListContext(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		err = table.SaveContext(ctx, dbtest.GivenImage(t))
+		assert.ErrorIs(t, err, context.Canceled)
+
+		found, err := table.GetByIDContext(context.Background(), img.ID)
+		require.NoError(t, err)
+		assert.Equal(t, img.ID, found.ID)
 	})
 
+	t.Run("should time out queries", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		dbtest.GivenSaved(t, table, dbtest.GivenImage(t))
+
+		table.QueryTimeout = time.Nanosecond
+		_, err := table.GetList()
+		assert.True(t, db.IsTimeout(err))
+
+		_, err = table.GetLocalities()
+		assert.True(t, db.IsTimeout(err))
+
+		table.QueryTimeout = 0
+		list, err := table.GetList()
+		require.NoError(t, err)
+		assert.Len(t, list.Images, 1)
+	})
 }
 
 func givenCountriesAndLocalities(t *testing.T, it dbtest.TestTable, countryLocalities map[string][]string) {
@@ -0,0 +1,543 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wobwainwwight/sa-photos/db"
+)
+
+// NewCatalogue is an empty catalogue for a test, it should be cleaned up
+// with t.Cleanup
+type NewCatalogue func(t *testing.T) db.Catalogue
+
+// TestCatalogue is the behaviour every db.Catalogue should have. Tags,
+// albums and trash are tested too when the catalogue has them.
+func TestCatalogue(t *testing.T, newCatalogue NewCatalogue) {
+
+	t.Run("should get saved image", func(t *testing.T) {
+		c := newCatalogue(t)
+
+		img := GivenImage(t)
+		img.Title = "Torres del Paine"
+		GivenSaved(t, c, img)
+
+		found, err := c.GetByID(img.ID)
+		require.NoError(t, err)
+		assert.Equal(t, img.ID, found.ID)
+		assert.Equal(t, img.Title, found.Title)
+		assert.Equal(t, img.Width, found.Width)
+		assert.Equal(t, img.Country, found.Country)
+		assert.True(t, img.CreatedAt.Equal(found.CreatedAt))
+
+		_, err = c.GetByID("missing")
+		assert.Equal(t, db.NotFound, err)
+	})
+
+	t.Run("should not insert an image twice", func(t *testing.T) {
+		c := newCatalogue(t)
+
+		img := GivenImage(t)
+		require.NoError(t, c.Insert(img))
+		assert.Equal(t, db.DuplicateImage, c.Insert(img))
+	})
+
+	t.Run("should only update existing images", func(t *testing.T) {
+		c := newCatalogue(t)
+		assert.Equal(t, db.NotFound, c.Update(GivenImage(t)))
+	})
+
+	t.Run("should upsert", func(t *testing.T) {
+		c := newCatalogue(t)
+
+		img := GivenSaved(t, c, GivenImage(t))[0]
+		img.Title = "Puerto Natales"
+		img.Locality = "Puerto Natales"
+		img.Country = "Chile"
+		GivenSaved(t, c, img)
+
+		found, err := c.GetByID(img.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Puerto Natales", found.Title)
+		assert.Equal(t, "Puerto Natales", found.Locality)
+		assert.Equal(t, "Chile", found.Country)
+	})
+
+	t.Run("should delete image", func(t *testing.T) {
+		c := newCatalogue(t)
+
+		img := GivenSaved(t, c, GivenImage(t))[0]
+		require.NoError(t, c.Delete(img.ID))
+
+		_, err := c.GetByID(img.ID)
+		assert.Equal(t, db.NotFound, err)
+	})
+
+	t.Run("should page through images with cursor", func(t *testing.T) {
+		c := newCatalogue(t)
+
+		imgs := GivenSaved(t, c, SpaceByHour(givenImages(t, 7))...)
+
+		assert.Equal(t, imageIDs(imgs...), pageThrough(t, c, db.WithLimit(3)))
+		assert.Equal(t, reversed(imageIDs(imgs...)), pageThrough(t, c, db.WithDescOrder(), db.WithLimit(2)))
+	})
+
+	t.Run("should page through images with the same created at", func(t *testing.T) {
+		c := newCatalogue(t)
+
+		imgs := givenImages(t, 20)
+		for i := range imgs {
+			imgs[i].CreatedAt = time.Unix(0, 0)
+		}
+		before := GivenImage(t)
+		before.CreatedAt = time.Unix(0, 0).Add(-time.Hour)
+		after := GivenImage(t)
+		after.CreatedAt = time.Unix(0, 0).Add(time.Hour)
+		GivenSaved(t, c, append(imgs, before, after)...)
+
+		ids := imageIDs(imgs...)
+		slices.Sort(ids)
+		expected := append(append([]string{before.ID}, ids...), after.ID)
+
+		assert.Equal(t, expected, pageThrough(t, c, db.WithLimit(3)))
+		assert.Equal(t, reversed(expected), pageThrough(t, c, db.WithDescOrder(), db.WithLimit(3)))
+
+		list, err := c.GetList(db.WithExclStartKey(ids[9]), db.WithLimit(2))
+		require.NoError(t, err)
+		assert.Equal(t, ids[10:12], imageIDs(list.Images...))
+
+		list, err = c.GetList(db.WithExclStartKey("missing"))
+		require.NoError(t, err)
+		assert.Empty(t, list.Images)
+	})
+
+	t.Run("should get pages", func(t *testing.T) {
+		c := newCatalogue(t)
+
+		imgs := GivenSaved(t, c, SpaceByHour(givenImages(t, 7))...)
+
+		list, err := c.GetList(db.WithPage(2))
+		require.NoError(t, err)
+		assert.Equal(t, imageIDs(imgs[5:]...), imageIDs(list.Images...))
+	})
+
+	t.Run("should filter by country with cursor", func(t *testing.T) {
+		c := newCatalogue(t)
+
+		imgs := SpaceByHour(givenImages(t, 6))
+		for i, country := range []string{"Chile", "Argentina", "Chile", "Peru", "Chile", "Argentina"} {
+			imgs[i].Country = country
+		}
+		GivenSaved(t, c, imgs...)
+
+		assert.Equal(t, imageIDs(imgs[0], imgs[2], imgs[4]), pageThrough(t, c, db.WithCountries("Chile"), db.WithLimit(1)))
+		assert.Equal(t, imageIDs(imgs[5], imgs[3], imgs[1]), pageThrough(t, c,
+			db.WithCountries("Argentina", "Peru"), db.WithDescOrder(), db.WithLimit(2)))
+	})
+
+	t.Run("should filter by date range with cursor", func(t *testing.T) {
+		c := newCatalogue(t)
+
+		day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+		imgs := givenImages(t, 4)
+		imgs[0].CreatedAt = day.Add(-time.Second)
+		imgs[1].CreatedAt = day
+		imgs[2].CreatedAt = day.Add(12 * time.Hour).In(time.FixedZone("", -3*60*60))
+		imgs[3].CreatedAt = day.Add(24 * time.Hour)
+		GivenSaved(t, c, imgs...)
+
+		assert.Equal(t, imageIDs(imgs[1:3]...), pageThrough(t, c, db.WithDateRange(day, day.Add(24*time.Hour)), db.WithLimit(1)))
+	})
+
+	t.Run("should filter by location with cursor", func(t *testing.T) {
+		c := newCatalogue(t)
+
+		imgs := SpaceByHour(givenImages(t, 5))
+		at := func(i int, lat, long float64) { imgs[i].Lat, imgs[i].Long = lat, long }
+		at(0, -51.7236, -72.5064) // puerto natales
+		at(1, -50.9423, -73.4068) // torres del paine
+		at(2, -33.4489, -70.6693) // santiago
+		at(3, -16.8, 179.95)      // either side of the antimeridian
+		at(4, -16.8, -179.95)
+		GivenSaved(t, c, imgs...)
+
+		patagonia := db.Bounds{South: -54, West: -76, North: -50, East: -68}
+		assert.Equal(t, imageIDs(imgs[0:2]...), pageThrough(t, c, db.WithBounds(patagonia), db.WithLimit(1)))
+
+		fiji := db.Bounds{South: -17, West: 179, North: -16, East: -179}
+		assert.Equal(t, imageIDs(imgs[3:5]...), pageThrough(t, c, db.WithBounds(fiji)))
+
+		natales := db.Radius{Lat: -51.7236, Long: -72.5064, Km: 150}
+		assert.Equal(t, imageIDs(imgs[0:2]...), pageThrough(t, c, db.WithRadius(natales), db.WithLimit(1)))
+
+		antimeridian := db.Radius{Lat: -16.8, Long: 180, Km: 20}
+		assert.Equal(t, imageIDs(imgs[3:5]...), pageThrough(t, c, db.WithRadius(antimeridian)))
+	})
+
+	t.Run("should search images", func(t *testing.T) {
+		c := newCatalogue(t)
+
+		imgs := SpaceByHour(givenImages(t, 3))
+		imgs[0].Title = "Glaciar Perito Moreno"
+		imgs[1].Caption = "Ice at the Perito Moreno glacier"
+		imgs[2].Locality = "Valparaíso"
+		GivenSaved(t, c, imgs...)
+
+		assert.Equal(t, imageIDs(imgs[0:2]...), pageThrough(t, c, db.WithQuery("perito"), db.WithLimit(1)))
+		assert.Equal(t, imageIDs(imgs[2]), pageThrough(t, c, db.WithQuery("valparaiso")))
+		assert.Equal(t, imageIDs(imgs[2]), pageThrough(t, c, db.WithQuery("valpa")))
+		assert.Empty(t, pageThrough(t, c, db.WithQuery("mendoza")))
+	})
+
+	t.Run("should get all localities", func(t *testing.T) {
+		c := newCatalogue(t)
+
+		imgs := givenImages(t, 6)
+		imgs[0].Country, imgs[0].Locality = "Chile", "Santiago"
+		imgs[1].Country, imgs[1].Locality = "Chile", "Puerto Natales"
+		imgs[2].Country, imgs[2].Locality = "Chile", "Santiago"
+		imgs[3].Country, imgs[3].Locality = "Argentina", "Mendoza"
+		imgs[4].Country, imgs[4].Locality = "Argentina", ""
+		imgs[5].Country, imgs[5].Locality = "", ""
+		GivenSaved(t, c, imgs...)
+
+		localities, err := c.GetLocalities()
+		require.NoError(t, err)
+		assert.Equal(t, []db.Locality{
+			{Country: "Argentina", Localities: []string{"Mendoza"}},
+			{Country: "Chile", Localities: []string{"Puerto Natales", "Santiago"}},
+		}, localities)
+	})
+
+	t.Run("should filter by locality with cursor", func(t *testing.T) {
+		c := newCatalogue(t)
+
+		imgs := SpaceByHour(givenImages(t, 5))
+		for i, place := range [][2]string{
+			{"Chile", "Puerto Natales"},
+			{"Chile", "Santiago"},
+			{"Chile", "Puerto Natales"},
+			{"Argentina", "Mendoza"},
+			{"Chile", "Puerto Natales"},
+		} {
+			imgs[i].Country, imgs[i].Locality = place[0], place[1]
+		}
+		GivenSaved(t, c, imgs...)
+
+		natales := db.Place{Country: "Chile", Locality: "Puerto Natales"}
+		assert.Equal(t, imageIDs(imgs[0], imgs[2], imgs[4]), pageThrough(t, c,
+			db.WithCountries("Chile"), db.WithLocalities(natales), db.WithLimit(1)))
+		assert.Equal(t, imageIDs(imgs[4], imgs[3], imgs[2], imgs[0]), pageThrough(t, c,
+			db.WithLocalities(natales, db.Place{Country: "Argentina", Locality: "Mendoza"}), db.WithDescOrder(), db.WithLimit(3)))
+		assert.Equal(t, imageIDs(imgs[0], imgs[2], imgs[3], imgs[4]), pageThrough(t, c,
+			db.WithCountries("Chile", "Argentina"), db.WithLocalities(natales), db.WithLimit(2)),
+			"picking a locality should only narrow its own country")
+		assert.Empty(t, pageThrough(t, c, db.WithLocalities(db.Place{Country: "Argentina", Locality: "Santiago"})))
+	})
+
+	t.Run("should count facets with the other filters", func(t *testing.T) {
+		c := newCatalogue(t)
+
+		day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+		imgs := givenImages(t, 6)
+		for i, place := range [][2]string{
+			{"Chile", "Puerto Natales"},
+			{"Chile", "Puerto Natales"},
+			{"Chile", "Santiago"},
+			{"Argentina", ""},
+			{"", ""},
+			{"Chile", "Santiago"},
+		} {
+			imgs[i].Country, imgs[i].Locality = place[0], place[1]
+			imgs[i].CreatedAt = day.Add(time.Duration(i) * time.Hour)
+		}
+		imgs[5].CreatedAt = day.Add(48 * time.Hour)
+		GivenSaved(t, c, imgs...)
+
+		facets, err := c.Facets(db.WithCountries("Argentina"), db.WithDateRange(day, day.Add(24*time.Hour)))
+		require.NoError(t, err)
+		assert.Equal(t, db.Facets{Countries: []db.CountryFacet{
+			{Country: "Argentina", Count: 1, Localities: []db.LocalityFacet{}},
+			{Country: "Chile", Count: 3, Localities: []db.LocalityFacet{
+				{Locality: "Puerto Natales", Count: 2},
+				{Locality: "Santiago", Count: 1},
+			}},
+		}}, facets)
+
+		facets, err = c.Facets(db.WithQuery("mendoza"))
+		require.NoError(t, err)
+		assert.Empty(t, facets.Countries)
+	})
+
+	t.Run("should filter by tags with cursor", func(t *testing.T) {
+		c := newCatalogue(t)
+		tc, ok := c.(db.TagCatalogue)
+		if !ok {
+			t.Skip("catalogue has no tags")
+		}
+
+		imgs := GivenSaved(t, c, SpaceByHour(givenImages(t, 3))...)
+		require.NoError(t, tc.AddTags(imgs[0].ID, "glacier", "ice"))
+		require.NoError(t, tc.AddTags(imgs[1].ID, "glacier"))
+		require.NoError(t, tc.AddTags(imgs[2].ID, "ice"))
+
+		assert.Equal(t, imageIDs(imgs...), pageThrough(t, c, db.WithTags(db.MatchAnyTag, "glacier", "ice"), db.WithLimit(1)))
+		assert.Equal(t, imageIDs(imgs[0]), pageThrough(t, c, db.WithTags(db.MatchAllTags, "glacier", "ice")))
+		assert.Equal(t, imageIDs(imgs[2]), pageThrough(t, c, db.WithQuery("ice"), db.WithCountries(imgs[2].Country), db.WithTags(db.MatchAnyTag, "ice"), db.WithExclStartKey(imgs[0].ID)))
+
+		tags, err := tc.GetTags()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"glacier", "ice"}, tags)
+
+		found, err := c.GetByID(imgs[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"glacier", "ice"}, found.Tags)
+	})
+
+	t.Run("should filter by album with cursor", func(t *testing.T) {
+		c := newCatalogue(t)
+		ac, ok := c.(db.AlbumCatalogue)
+		if !ok {
+			t.Skip("catalogue has no albums")
+		}
+
+		imgs := GivenSaved(t, c, SpaceByHour(givenImages(t, 4))...)
+		_, err := ac.CreateAlbum("patagonia", "Patagonia")
+		require.NoError(t, err)
+		GivenInAlbum(t, ac, "patagonia", imgs[1], imgs[3])
+
+		assert.Equal(t, imageIDs(imgs[1], imgs[3]), pageThrough(t, c, db.WithAlbum("patagonia"), db.WithLimit(1)))
+
+		albums, err := ac.ListAlbums()
+		require.NoError(t, err)
+		slugs := []string{}
+		for _, a := range albums {
+			slugs = append(slugs, a.Slug)
+		}
+		assert.Equal(t, []string{"south-america", "patagonia"}, slugs)
+	})
+
+	t.Run("should leave trashed images out", func(t *testing.T) {
+		c := newCatalogue(t)
+		tc, ok := c.(db.TrashCatalogue)
+		if !ok {
+			t.Skip("catalogue has no trash")
+		}
+
+		imgs := SpaceByHour(givenImages(t, 3))
+		imgs[1].Country, imgs[1].Locality = "Bolivia", "Uyuni"
+		GivenSaved(t, c, imgs...)
+		require.NoError(t, tc.Trash(imgs[1].ID))
+
+		assert.Equal(t, imageIDs(imgs[0], imgs[2]), pageThrough(t, c, db.WithLimit(1)))
+
+		_, err := c.GetByID(imgs[1].ID)
+		assert.Equal(t, db.NotFound, err)
+
+		localities, err := c.GetLocalities()
+		require.NoError(t, err)
+		for _, l := range localities {
+			assert.NotEqual(t, "Bolivia", l.Country)
+		}
+
+		trash, err := tc.GetTrash()
+		require.NoError(t, err)
+		assert.Equal(t, imageIDs(imgs[1]), imageIDs(trash...))
+
+		require.NoError(t, tc.Restore(imgs[1].ID))
+		assert.Equal(t, db.NotFound, tc.Restore(imgs[1].ID))
+		assert.Equal(t, imageIDs(imgs...), pageThrough(t, c))
+	})
+
+	t.Run("should only purge images still in the trash", func(t *testing.T) {
+		c := newCatalogue(t)
+		tc, ok := c.(db.TrashCatalogue)
+		if !ok {
+			t.Skip("catalogue has no trash")
+		}
+
+		imgs := GivenSaved(t, c, givenImages(t, 3)...)
+		require.NoError(t, tc.Trash(imgs[0].ID))
+		require.NoError(t, tc.Trash(imgs[1].ID))
+		before := time.Now().Add(time.Hour)
+
+		require.NoError(t, tc.Restore(imgs[1].ID))
+		assert.Equal(t, db.NotFound, tc.Purge(imgs[1].ID, before), "restored images should be kept")
+		assert.Equal(t, db.NotFound, tc.Purge(imgs[2].ID, before))
+		assert.Equal(t, db.NotFound, tc.Purge(imgs[0].ID, time.Now().Add(-time.Hour)), "images trashed after the time should be kept")
+
+		require.NoError(t, tc.Purge(imgs[0].ID, before))
+		trash, err := tc.GetTrash()
+		require.NoError(t, err)
+		assert.Empty(t, trash)
+		assert.ElementsMatch(t, imageIDs(imgs[1], imgs[2]), pageThrough(t, c))
+	})
+
+	t.Run("should get stats of the trip", func(t *testing.T) {
+		c := newCatalogue(t)
+
+		day := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+		imgs := givenImages(t, 5)
+		places := []struct {
+			country, locality string
+			createdAt         time.Time
+			lat, long         float64
+		}{
+			{"Chile", "Santiago", day, 1, 0},
+			{"Chile", "Valparaíso", day.Add(2 * time.Hour), 1, 1},
+			{"Argentina", "Mendoza", day.Add(24 * time.Hour), 2, 1},
+			{"Argentina", "", day.Add(26 * time.Hour), 0, 0},
+			{"", "", time.Time{}, 0, 0},
+		}
+		for i, p := range places {
+			imgs[i].Country, imgs[i].Locality = p.country, p.locality
+			imgs[i].CreatedAt = p.createdAt
+			imgs[i].Lat, imgs[i].Long = p.lat, p.long
+		}
+		GivenSaved(t, c, imgs...)
+
+		stats, err := c.GetStats()
+		require.NoError(t, err)
+		assert.Equal(t, 5, stats.Total)
+		assert.Equal(t, 1, stats.Undated)
+
+		// a degree of latitude or longitude near the equator is about 111km
+		assert.InDelta(t, 222.4, stats.Km, 0.1)
+		require.Len(t, stats.Days, 2)
+		assert.Equal(t, db.DayStats{Date: "2024-03-01", Count: 2, Km: stats.Days[0].Km}, stats.Days[0])
+		assert.InDelta(t, 111.2, stats.Days[0].Km, 0.1)
+		assert.Equal(t, "2024-03-02", stats.Days[1].Date)
+		assert.Equal(t, 2, stats.Days[1].Count)
+		assert.InDelta(t, 111.2, stats.Days[1].Km, 0.1)
+
+		require.Len(t, stats.Countries, 2)
+		argentina, chile := stats.Countries[0], stats.Countries[1]
+		assert.Equal(t, "Argentina", argentina.Country)
+		assert.Equal(t, 2, argentina.Count)
+		assert.Equal(t, []db.LocalityStats{{Locality: "Mendoza", Count: 1}}, argentina.Localities)
+		assert.Equal(t, day.Add(24*time.Hour), argentina.First)
+		assert.Equal(t, day.Add(26*time.Hour), argentina.Last)
+		assert.Equal(t, "Chile", chile.Country)
+		assert.Equal(t, []db.LocalityStats{{Locality: "Santiago", Count: 1}, {Locality: "Valparaíso", Count: 1}}, chile.Localities)
+		assert.Equal(t, day, chile.First)
+		assert.Equal(t, day.Add(2*time.Hour), chile.Last)
+
+		stats, err = c.GetStats(db.WithCountries("Chile"))
+		require.NoError(t, err)
+		assert.Equal(t, 2, stats.Total)
+		assert.InDelta(t, 111.2, stats.Km, 0.1)
+	})
+
+	t.Run("should count images without EXIF as undated in stats", func(t *testing.T) {
+		c := newCatalogue(t)
+
+		day := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+		imgs := givenImages(t, 2)
+		imgs[0].Country, imgs[0].Locality, imgs[0].CreatedAt = "Chile", "Santiago", day
+		imgs[0].Lat, imgs[0].Long = 1, 0
+		// images without EXIF are saved as taken at the Unix epoch
+		imgs[1].Country, imgs[1].Locality, imgs[1].CreatedAt = "Chile", "Santiago", time.Unix(0, 0).UTC()
+		imgs[1].Lat, imgs[1].Long = 2, 0
+		GivenSaved(t, c, imgs...)
+
+		stats, err := c.GetStats()
+		require.NoError(t, err)
+		assert.Equal(t, 2, stats.Total)
+		assert.Equal(t, 1, stats.Undated)
+		assert.Zero(t, stats.Km)
+		require.Len(t, stats.Days, 1)
+		assert.Equal(t, "2024-03-01", stats.Days[0].Date)
+
+		require.Len(t, stats.Countries, 1)
+		assert.Equal(t, 2, stats.Countries[0].Count)
+		assert.Equal(t, day, stats.Countries[0].First)
+		assert.Equal(t, day, stats.Countries[0].Last)
+	})
+
+	t.Run("should pair near duplicates until both are kept", func(t *testing.T) {
+		c := newCatalogue(t)
+		dc, ok := c.(db.DuplicateCatalogue)
+		if !ok {
+			t.Skip("catalogue has no duplicates")
+		}
+
+		imgs := SpaceByHour(givenImages(t, 4))
+		imgs[0].DHash = "f0f0f0f0f0f0f0f0"
+		imgs[1].DHash = "0f0f0f0f0f0f0f0f"
+		imgs[2].DHash = "f0f0f0f0f0f0f0f1"
+		GivenSaved(t, c, imgs...)
+
+		unhashed, err := dc.GetUnhashed()
+		require.NoError(t, err)
+		assert.Equal(t, imageIDs(imgs[3]), unhashed)
+		require.NoError(t, dc.SetDHash(imgs[3].ID, "f0f0f0f0f0f0f0f3"))
+		assert.Equal(t, db.NotFound, dc.SetDHash("missing", "f0f0f0f0f0f0f0f3"))
+
+		pairs, err := dc.GetDuplicates(db.DefaultDuplicateDistance)
+		require.NoError(t, err)
+		require.Len(t, pairs, 3)
+		assert.Equal(t, imageIDs(imgs[0], imgs[2]), imageIDs(pairs[0].Image, pairs[0].Other))
+		assert.Equal(t, 1, pairs[0].Distance)
+		assert.Equal(t, 1, pairs[1].Distance)
+		assert.Equal(t, 2, pairs[2].Distance)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = dc.GetDuplicatesContext(ctx, db.DefaultDuplicateDistance)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		require.NoError(t, dc.KeepBoth(imgs[2].ID, imgs[0].ID))
+		assert.Equal(t, db.NotFound, dc.KeepBoth(imgs[0].ID, "missing"))
+		pairs, err = dc.GetDuplicates(db.DefaultDuplicateDistance)
+		require.NoError(t, err)
+		require.Len(t, pairs, 2)
+
+		if tc, ok := c.(db.TrashCatalogue); ok {
+			require.NoError(t, tc.Trash(imgs[3].ID))
+			pairs, err = dc.GetDuplicates(db.DefaultDuplicateDistance)
+			require.NoError(t, err)
+			assert.Empty(t, pairs)
+		}
+	})
+}
+
+// pageThrough follows the cursors of the list until the end, getting the
+// IDs of every image
+func pageThrough(t *testing.T, c db.Catalogue, opts ...db.GetListOptsFn) []string {
+	found := []string{}
+	list, err := c.GetList(opts...)
+	require.NoError(t, err)
+	for len(list.Images) > 0 {
+		found = append(found, imageIDs(list.Images...)...)
+		list, err = c.GetList(db.WithCursorStr(list.Cursor.EncodedString()))
+		require.NoError(t, err)
+	}
+	return found
+}
+
+func givenImages(t *testing.T, n int) []db.Image {
+	imgs := make([]db.Image, n)
+	for i := range imgs {
+		imgs[i] = GivenImage(t)
+		imgs[i].Lat, imgs[i].Long = 0, 0
+	}
+	return imgs
+}
+
+func imageIDs(imgs ...db.Image) []string {
+	ids := make([]string, len(imgs))
+	for i, img := range imgs {
+		ids[i] = img.ID
+	}
+	return ids
+}
+
+func reversed(s []string) []string {
+	s = slices.Clone(s)
+	slices.Reverse(s)
+	return s
+}
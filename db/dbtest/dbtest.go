@@ -29,6 +29,17 @@ func (t *TestTable) Close() error {
 	return os.Remove("test-saws.sqlite")
 }
 
+// AcceptLegacyCursors opens the window for unsigned cursors until the test ends
+func AcceptLegacyCursors(t *testing.T) {
+	prev := db.CursorConfiguration()
+	cfg := prev
+	cfg.LegacyUntil = time.Now().Add(time.Hour)
+	require.NoError(t, db.ConfigureCursors(cfg))
+	t.Cleanup(func() {
+		require.NoError(t, db.ConfigureCursors(prev))
+	})
+}
+
 func SpaceByHour(imgs []db.Image) []db.Image {
 	for i := range imgs {
 		imgs[i].CreatedAt = time.Now().Add(-time.Hour * time.Duration(len(imgs)-i))
@@ -36,7 +47,7 @@ func SpaceByHour(imgs []db.Image) []db.Image {
 	return imgs
 }
 
-func GivenSaved(t *testing.T, table TestTable, images ...db.Image) []db.Image {
+func GivenSaved(t *testing.T, table db.Catalogue, images ...db.Image) []db.Image {
 	for _, img := range images {
 		err := table.Save(img)
 		require.NoError(t, err)
@@ -70,3 +81,13 @@ func GivenImage(t *testing.T) db.Image {
 
 	return img
 }
+
+func GivenInAlbum(t *testing.T, table db.AlbumCatalogue, slug string, images ...db.Image) []db.Image {
+	ids := make([]string, len(images))
+	for i, img := range images {
+		ids[i] = img.ID
+	}
+	err := table.AddToAlbum(slug, ids...)
+	require.NoError(t, err)
+	return images
+}
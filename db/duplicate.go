@@ -0,0 +1,202 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultDuplicateDistance is the most bits the DHashes of two images can
+// differ by for them to be near duplicates
+const DefaultDuplicateDistance = 8
+
+// MaxDuplicateDistance is the furthest apart near duplicates are looked
+// for, unrelated photos are on average half of the 64 bits apart so any
+// further would pair nearly every image with every other
+const MaxDuplicateDistance = 24
+
+// DuplicatePair is two images that look like the same photo, Image is
+// the one that was taken first
+type DuplicatePair struct {
+	Image    Image
+	Other    Image
+	Distance int
+}
+
+// GetDuplicates finds the images whose DHashes are within maxDistance of
+// each other, closest first. Images in the trash, images that haven't
+// been hashed and pairs that were kept with KeepBoth are left out.
+func (i *ImageTable) GetDuplicates(maxDistance int) ([]DuplicatePair, error) {
+	return i.GetDuplicatesContext(context.Background(), maxDistance)
+}
+
+func (i *ImageTable) GetDuplicatesContext(ctx context.Context, maxDistance int) ([]DuplicatePair, error) {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := i.DB.QueryContext(ctx, "SELECT "+imageColumns+` FROM image
+		WHERE dhash IS NOT '' AND deleted_at IS NULL ORDER BY created_at, id;`)
+	if err != nil {
+		return nil, fmt.Errorf("could not get images for duplicates: %w", err)
+	}
+	defer rows.Close()
+
+	imgs := []Image{}
+	for rows.Next() {
+		img, err := i.scanImageRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		imgs = append(imgs, img)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not get images for duplicates: %w", err)
+	}
+
+	keptRows, err := i.DB.QueryContext(ctx, "SELECT image_id, other_id FROM duplicate_kept;")
+	if err != nil {
+		return nil, fmt.Errorf("could not get kept duplicates: %w", err)
+	}
+	defer keptRows.Close()
+
+	kept := map[[2]string]bool{}
+	for keptRows.Next() {
+		id, otherID := "", ""
+		err = keptRows.Scan(&id, &otherID)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan kept duplicate: %w", err)
+		}
+		kept[[2]string{id, otherID}] = true
+	}
+	if err = keptRows.Err(); err != nil {
+		return nil, fmt.Errorf("could not get kept duplicates: %w", err)
+	}
+
+	return findDuplicates(ctx, imgs, kept, maxDistance)
+}
+
+// KeepBoth marks two images as not being duplicates so that they aren't
+// paired by GetDuplicates again
+func (i *ImageTable) KeepBoth(id, otherID string) error {
+	return i.KeepBothContext(context.Background(), id, otherID)
+}
+
+func (i *ImageTable) KeepBothContext(ctx context.Context, id, otherID string) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	for _, id := range []string{id, otherID} {
+		_, err := i.GetByIDContext(ctx, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	pair := keptPair(id, otherID)
+	_, err := i.DB.ExecContext(ctx, "INSERT OR IGNORE INTO duplicate_kept (image_id, other_id) VALUES (?,?);", pair[0], pair[1])
+	if err != nil {
+		return fmt.Errorf("could not keep both %s and %s: %w", id, otherID, err)
+	}
+	return nil
+}
+
+// SetDHash sets the DHash of an image, for hashing images uploaded before
+// they were hashed
+func (i *ImageTable) SetDHash(id, dhash string) error {
+	return i.SetDHashContext(context.Background(), id, dhash)
+}
+
+func (i *ImageTable) SetDHashContext(ctx context.Context, id, dhash string) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	res, err := i.DB.ExecContext(ctx, "UPDATE image SET dhash = (?) WHERE id = (?);", dhash, id)
+	if err != nil {
+		return fmt.Errorf("could not set dhash of image %s: %w", id, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return NotFound
+	}
+	return nil
+}
+
+// GetUnhashed returns the IDs of the images without a DHash, including
+// the ones in the trash
+func (i *ImageTable) GetUnhashed() ([]string, error) {
+	return i.GetUnhashedContext(context.Background())
+}
+
+func (i *ImageTable) GetUnhashedContext(ctx context.Context) ([]string, error) {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := i.DB.QueryContext(ctx, "SELECT id FROM image WHERE dhash IS '' ORDER BY id;")
+	if err != nil {
+		return nil, fmt.Errorf("could not get unhashed images: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		id := ""
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan unhashed image: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not get unhashed images: %w", err)
+	}
+	return ids, nil
+}
+
+// keptPair is the key a KeepBoth is stored under, the same whichever
+// order the images are given in
+func keptPair(id, otherID string) [2]string {
+	if strings.Compare(id, otherID) > 0 {
+		return [2]string{otherID, id}
+	}
+	return [2]string{id, otherID}
+}
+
+// findDuplicates compares every image to every other, the images should
+// be in the order they were taken. It gives up once the context is done
+// as the comparisons grow with the square of the number of images.
+func findDuplicates(ctx context.Context, imgs []Image, kept map[[2]string]bool, maxDistance int) ([]DuplicatePair, error) {
+	hashes := make([]uint64, len(imgs))
+	for i, img := range imgs {
+		h, err := strconv.ParseUint(img.DHash, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dhash of %s %q: %w", img.ID, img.DHash, err)
+		}
+		hashes[i] = h
+	}
+
+	pairs := []DuplicatePair{}
+	for a := range imgs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for b := a + 1; b < len(imgs); b++ {
+			// the Hamming distance, how many bits differ
+			d := bits.OnesCount64(hashes[a] ^ hashes[b])
+			if d > maxDistance || kept[keptPair(imgs[a].ID, imgs[b].ID)] {
+				continue
+			}
+			pairs = append(pairs, DuplicatePair{Image: imgs[a], Other: imgs[b], Distance: d})
+		}
+	}
+	slices.SortStableFunc(pairs, func(a, b DuplicatePair) int {
+		return a.Distance - b.Distance
+	})
+	return pairs, nil
+}
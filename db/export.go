@@ -0,0 +1,557 @@
+package db
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var UnknownFormat = errors.New("format must be jsonl or csv")
+
+// Format is how a catalogue is written by Export and read by Import
+type Format string
+
+// JSONL is an ExportRecord as JSON on each line
+const JSONL = Format("jsonl")
+
+// CSV is an ExportRecord on each row after a header of the column names
+const CSV = Format("csv")
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case JSONL, CSV:
+		return f, nil
+	}
+	return "", fmt.Errorf("%w: %q", UnknownFormat, s)
+}
+
+// ExportRecord is an image as it is exported, with the albums it's in
+type ExportRecord struct {
+	Image
+	Albums []ExportAlbum `json:"albums,omitempty"`
+}
+
+// ExportAlbum is an album an exported image is in, the position is kept
+// so that albums created by Import are in the same order
+type ExportAlbum struct {
+	Slug     string `json:"slug"`
+	Name     string `json:"name"`
+	Position int    `json:"position"`
+}
+
+// exportPageSize is how many images are read from the catalogue at a time
+const exportPageSize = 100
+
+// Export writes every image in the catalogue, oldest first, along with
+// its tags and albums. Images in the trash are left out as they are on
+// their way to being purged.
+func Export(ctx context.Context, c FullCatalogue, w io.Writer, format Format) error {
+	rw, err := newRecordWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	albums, err := c.ListAlbumsContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	imageAlbums := map[string][]ExportAlbum{}
+	for _, a := range albums {
+		err = eachImage(ctx, c, func(img Image) error {
+			imageAlbums[img.ID] = append(imageAlbums[img.ID], ExportAlbum{Slug: a.Slug, Name: a.Name, Position: a.Position})
+			return nil
+		}, WithAlbum(a.Slug))
+		if err != nil {
+			return fmt.Errorf("could not export album %s: %w", a.Slug, err)
+		}
+	}
+
+	err = eachImage(ctx, c, func(img Image) error {
+		return rw.write(ExportRecord{Image: img, Albums: imageAlbums[img.ID]})
+	})
+	if err != nil {
+		return fmt.Errorf("could not export images: %w", err)
+	}
+
+	return rw.flush()
+}
+
+// eachImage pages through the images in the list, oldest first
+func eachImage(ctx context.Context, c Catalogue, fn func(Image) error, opts ...GetListOptsFn) error {
+	list, err := c.GetListContext(ctx, append(opts, WithAscOrder(), WithLimit(exportPageSize))...)
+	for err == nil && len(list.Images) > 0 {
+		for _, img := range list.Images {
+			err = fn(img)
+			if err != nil {
+				return err
+			}
+		}
+		list, err = c.GetListContext(ctx, WithCursorStr(list.Cursor.EncodedString()))
+	}
+	return err
+}
+
+// ImportReport is what Import did with each record
+type ImportReport struct {
+	Inserted  int              `json:"inserted"`
+	Updated   int              `json:"updated"`
+	Unchanged int              `json:"unchanged"`
+	Conflicts []ImportConflict `json:"conflicts"`
+}
+
+// ImportConflict is a field that was different in the catalogue to the
+// record being imported. Editable fields are overwritten by the import
+// but the ones read from the file are kept, as are album names.
+type ImportConflict struct {
+	// ID is the image's ID, or the album's slug for album names
+	ID       string `json:"id"`
+	Field    string `json:"field"`
+	Existing string `json:"existing"`
+	Imported string `json:"imported"`
+	Kept     bool   `json:"kept"`
+}
+
+// Import upserts the images written by Export. New images are inserted,
+// images that are already in the catalogue have their editable fields
+// and tags updated, and images are added to their albums, creating any
+// albums that don't exist. When albums are created the imported albums
+// are moved in front of the others in their exported order. Images in the
+// trash are not changed.
+//
+// Every record is read and checked before any are written, so a file with
+// a bad record in it changes nothing.
+func Import(ctx context.Context, c FullCatalogue, r io.Reader, format Format) (ImportReport, error) {
+	report := ImportReport{Conflicts: []ImportConflict{}}
+
+	recs, err := readRecords(r, format)
+	if err != nil {
+		return report, fmt.Errorf("nothing was imported: %w", err)
+	}
+
+	existing, err := c.ListAlbumsContext(ctx)
+	if err != nil {
+		return report, err
+	}
+	albums := map[string]Album{}
+	for _, a := range existing {
+		albums[a.Slug] = a
+	}
+
+	imported := map[string]ExportAlbum{}
+	created := false
+	for i, rec := range recs {
+		// records that were checked can still fail to be written, the
+		// ones before them have been imported by then
+		stopped := func(err error) error {
+			return fmt.Errorf("import stopped at record %d, the %d before it were imported: %w", i+1, i, err)
+		}
+
+		err = importImage(ctx, c, rec.Image, &report)
+		if err == DuplicateImage {
+			continue
+		}
+		if err != nil {
+			return report, stopped(err)
+		}
+
+		for _, a := range rec.Albums {
+			album, ok := albums[a.Slug]
+			if !ok {
+				album, err = c.CreateAlbumContext(ctx, a.Slug, a.Name)
+				if err != nil {
+					return report, stopped(err)
+				}
+				albums[a.Slug] = album
+				created = true
+			} else if album.Name != a.Name && !slices.ContainsFunc(report.Conflicts, func(c ImportConflict) bool {
+				return c.ID == a.Slug && c.Field == "albumName"
+			}) {
+				report.Conflicts = append(report.Conflicts, ImportConflict{
+					ID: a.Slug, Field: "albumName", Existing: album.Name, Imported: a.Name, Kept: true,
+				})
+			}
+
+			imported[a.Slug] = a
+
+			err = c.AddToAlbumContext(ctx, a.Slug, rec.ID)
+			if err != nil {
+				return report, stopped(err)
+			}
+		}
+	}
+
+	if created {
+		return report, reorderImported(ctx, c, imported)
+	}
+	return report, nil
+}
+
+// readRecords reads every record and checks that it can be imported, the
+// first record that can't is returned as an error
+func readRecords(r io.Reader, format Format) ([]ExportRecord, error) {
+	rr, err := newRecordReader(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	recs := []ExportRecord{}
+	for n := 1; ; n++ {
+		rec, err := rr.read()
+		if err == io.EOF {
+			return recs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read record %d: %w", n, err)
+		}
+		err = checkRecord(rec)
+		if err != nil {
+			return nil, fmt.Errorf("could not import record %d: %w", n, err)
+		}
+		recs = append(recs, rec)
+	}
+}
+
+// checkRecord finds what would stop a record from being written before
+// any are
+func checkRecord(rec ExportRecord) error {
+	if len(rec.ID) == 0 {
+		return errors.New("id is missing")
+	}
+	_, err := normaliseTags(rec.Tags)
+	if err != nil {
+		return err
+	}
+	for _, a := range rec.Albums {
+		if !slugPattern.MatchString(a.Slug) {
+			return fmt.Errorf("%w: %q", InvalidSlug, a.Slug)
+		}
+	}
+	return nil
+}
+
+// importImage inserts or updates an image, an image in the trash is
+// reported as a conflict and DuplicateImage is returned
+func importImage(ctx context.Context, c FullCatalogue, img Image, report *ImportReport) error {
+	current, err := c.GetByIDContext(ctx, img.ID)
+	if err == NotFound {
+		err = c.InsertContext(ctx, img)
+		if err == DuplicateImage {
+			report.Conflicts = append(report.Conflicts, ImportConflict{
+				ID: img.ID, Field: "deletedAt", Existing: "in trash", Kept: true,
+			})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		report.Inserted++
+		if len(img.Tags) > 0 {
+			return c.SetTagsContext(ctx, img.ID, img.Tags...)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	conflicts := []ImportConflict{}
+	for _, col := range exportColumns {
+		if col.name == "albums" {
+			continue
+		}
+		have, want := col.get(ExportRecord{Image: current}), col.get(ExportRecord{Image: img})
+		if have != want {
+			conflicts = append(conflicts, ImportConflict{
+				ID: img.ID, Field: col.name, Existing: have, Imported: want, Kept: !col.editable,
+			})
+		}
+	}
+	if len(conflicts) == 0 {
+		report.Unchanged++
+		return nil
+	}
+	report.Conflicts = append(report.Conflicts, conflicts...)
+	report.Updated++
+
+	err = c.UpdateContext(ctx, img)
+	if err != nil {
+		return err
+	}
+	return c.SetTagsContext(ctx, img.ID, img.Tags...)
+}
+
+// reorderImported puts the albums of an import first, in the order they
+// were exported in
+func reorderImported(ctx context.Context, c FullCatalogue, imported map[string]ExportAlbum) error {
+	order := make([]ExportAlbum, 0, len(imported))
+	for _, a := range imported {
+		order = append(order, a)
+	}
+	slices.SortFunc(order, func(a, b ExportAlbum) int {
+		if a.Position != b.Position {
+			return a.Position - b.Position
+		}
+		return strings.Compare(a.Slug, b.Slug)
+	})
+
+	slugs := make([]string, len(order))
+	for i, a := range order {
+		slugs[i] = a.Slug
+	}
+	return c.ReorderAlbumsContext(ctx, slugs...)
+}
+
+type recordWriter interface {
+	write(rec ExportRecord) error
+	flush() error
+}
+
+type recordReader interface {
+	// read returns io.EOF once every record has been read
+	read() (ExportRecord, error)
+}
+
+func newRecordWriter(w io.Writer, format Format) (recordWriter, error) {
+	switch format {
+	case JSONL:
+		return jsonlWriter{json.NewEncoder(w)}, nil
+	case CSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", UnknownFormat, format)
+}
+
+func newRecordReader(r io.Reader, format Format) (recordReader, error) {
+	switch format {
+	case JSONL:
+		return jsonlReader{json.NewDecoder(r)}, nil
+	case CSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		return &csvReader{r: cr}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", UnknownFormat, format)
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (j jsonlWriter) write(rec ExportRecord) error {
+	return j.enc.Encode(rec)
+}
+
+func (j jsonlWriter) flush() error {
+	return nil
+}
+
+type jsonlReader struct {
+	dec *json.Decoder
+}
+
+func (j jsonlReader) read() (ExportRecord, error) {
+	rec := ExportRecord{}
+	err := j.dec.Decode(&rec)
+	return rec, err
+}
+
+type csvWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func (c *csvWriter) write(rec ExportRecord) error {
+	if !c.wroteHeader {
+		err := c.w.Write(exportColumnNames())
+		if err != nil {
+			return err
+		}
+		c.wroteHeader = true
+	}
+
+	row := make([]string, len(exportColumns))
+	for i, col := range exportColumns {
+		row[i] = col.get(rec)
+	}
+	return c.w.Write(row)
+}
+
+// flush writes the header if there weren't any records so that the
+// file can still be imported
+func (c *csvWriter) flush() error {
+	if !c.wroteHeader {
+		err := c.w.Write(exportColumnNames())
+		if err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type csvReader struct {
+	r       *csv.Reader
+	columns []exportColumn
+}
+
+func (c *csvReader) read() (ExportRecord, error) {
+	if c.columns == nil {
+		header, err := c.r.Read()
+		if err != nil {
+			return ExportRecord{}, err
+		}
+		for _, name := range header {
+			i := slices.IndexFunc(exportColumns, func(col exportColumn) bool { return col.name == name })
+			if i < 0 {
+				return ExportRecord{}, fmt.Errorf("unknown column %q", name)
+			}
+			c.columns = append(c.columns, exportColumns[i])
+		}
+	}
+
+	row, err := c.r.Read()
+	if err != nil {
+		return ExportRecord{}, err
+	}
+	if len(row) != len(c.columns) {
+		return ExportRecord{}, fmt.Errorf("row has %d fields but there are %d columns", len(row), len(c.columns))
+	}
+
+	rec := ExportRecord{}
+	for i, col := range c.columns {
+		err = col.set(&rec, row[i])
+		if err != nil {
+			return ExportRecord{}, fmt.Errorf("could not read %s: %w", col.name, err)
+		}
+	}
+	return rec, nil
+}
+
+// exportColumn is a column of a CSV export, the columns are also used to
+// compare imported images to the ones already in the catalogue. Editable
+// columns are the ones Import can change.
+type exportColumn struct {
+	name     string
+	get      func(rec ExportRecord) string
+	set      func(rec *ExportRecord, s string) error
+	editable bool
+}
+
+func exportColumnNames() []string {
+	names := make([]string, len(exportColumns))
+	for i, col := range exportColumns {
+		names[i] = col.name
+	}
+	return names
+}
+
+func stringColumn(name string, field func(rec *ExportRecord) *string, editable bool) exportColumn {
+	return exportColumn{
+		name: name,
+		get:  func(rec ExportRecord) string { return *field(&rec) },
+		set: func(rec *ExportRecord, s string) error {
+			*field(rec) = s
+			return nil
+		},
+		editable: editable,
+	}
+}
+
+func intColumn(name string, field func(rec *ExportRecord) *int) exportColumn {
+	return exportColumn{
+		name: name,
+		get:  func(rec ExportRecord) string { return strconv.Itoa(*field(&rec)) },
+		set: func(rec *ExportRecord, s string) (err error) {
+			*field(rec), err = strconv.Atoi(s)
+			return err
+		},
+	}
+}
+
+func floatColumn(name string, field func(rec *ExportRecord) *float64) exportColumn {
+	return exportColumn{
+		name: name,
+		get:  func(rec ExportRecord) string { return strconv.FormatFloat(*field(&rec), 'f', -1, 64) },
+		set: func(rec *ExportRecord, s string) (err error) {
+			*field(rec), err = strconv.ParseFloat(s, 64)
+			return err
+		},
+	}
+}
+
+func timeColumn(name string, field func(rec *ExportRecord) *time.Time) exportColumn {
+	return exportColumn{
+		name: name,
+		get:  func(rec ExportRecord) string { return field(&rec).UTC().Format(time.RFC3339Nano) },
+		set: func(rec *ExportRecord, s string) (err error) {
+			*field(rec), err = time.Parse(time.RFC3339Nano, s)
+			return err
+		},
+	}
+}
+
+var exportColumns = []exportColumn{
+	stringColumn("id", func(rec *ExportRecord) *string { return &rec.ID }, false),
+	stringColumn("mimeType", func(rec *ExportRecord) *string { return &rec.MimeType }, false),
+	intColumn("width", func(rec *ExportRecord) *int { return &rec.Width }),
+	intColumn("height", func(rec *ExportRecord) *int { return &rec.Height }),
+	stringColumn("thumbhash", func(rec *ExportRecord) *string { return &rec.ThumbHash }, false),
+	stringColumn("dhash", func(rec *ExportRecord) *string { return &rec.DHash }, false),
+	timeColumn("createdAt", func(rec *ExportRecord) *time.Time { return &rec.CreatedAt }),
+	timeColumn("uploadedAt", func(rec *ExportRecord) *time.Time { return &rec.UploadedAt }),
+	floatColumn("lat", func(rec *ExportRecord) *float64 { return &rec.Lat }),
+	floatColumn("long", func(rec *ExportRecord) *float64 { return &rec.Long }),
+	stringColumn("title", func(rec *ExportRecord) *string { return &rec.Title }, true),
+	stringColumn("caption", func(rec *ExportRecord) *string { return &rec.Caption }, true),
+	stringColumn("altText", func(rec *ExportRecord) *string { return &rec.AltText }, true),
+	stringColumn("locality", func(rec *ExportRecord) *string { return &rec.Locality }, true),
+	stringColumn("country", func(rec *ExportRecord) *string { return &rec.Country }, true),
+	{
+		// tags can't contain commas so they are joined by them
+		name: "tags",
+		get:  func(rec ExportRecord) string { return strings.Join(rec.Tags, string(arrSep)) },
+		set: func(rec *ExportRecord, s string) error {
+			if len(s) > 0 {
+				rec.Tags = strings.Split(s, string(arrSep))
+			}
+			return nil
+		},
+		editable: true,
+	},
+	{
+		// albums are slug|position|name, escaped as cursor values are
+		name: "albums",
+		get: func(rec ExportRecord) string {
+			albums := make([]string, len(rec.Albums))
+			for i, a := range rec.Albums {
+				albums[i] = strings.Join([]string{a.Slug, strconv.Itoa(a.Position), escapeValue(a.Name)}, string(divider))
+			}
+			return strings.Join(albums, string(arrSep))
+		},
+		set: func(rec *ExportRecord, s string) error {
+			if len(s) == 0 {
+				return nil
+			}
+			for _, album := range strings.Split(s, string(arrSep)) {
+				parts := strings.Split(album, string(divider))
+				if len(parts) != 3 {
+					return fmt.Errorf("album %q is not slug|position|name", album)
+				}
+				position, err := strconv.Atoi(parts[1])
+				if err != nil {
+					return fmt.Errorf("position of album %q: %w", album, err)
+				}
+				rec.Albums = append(rec.Albums, ExportAlbum{Slug: parts[0], Name: unescapeValue(parts[2]), Position: position})
+			}
+			return nil
+		},
+	},
+}
@@ -0,0 +1,179 @@
+package db_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wobwainwwight/sa-photos/db"
+	"github.com/wobwainwwight/sa-photos/db/dbtest"
+)
+
+func TestExportImport(t *testing.T) {
+
+	givenCatalogue := func(t *testing.T) (dbtest.TestTable, []db.Image) {
+		table := dbtest.NewTestTable(t)
+
+		imgs := dbtest.SpaceByHour([]db.Image{
+			givenImageInLocale(t, "Chile", "Puerto Natales"),
+			givenImageInLocale(t, "Argentina", "Mendoza"),
+			givenImageInLocale(t, "Chile", "Valparaíso"),
+		})
+		imgs[0].Title = "Torres"
+		imgs[0].Caption = "Sunrise, \"finally\"\nafter three days of cloud"
+		imgs[1].AltText = "A glass of malbec | on a table"
+		imgs[2].Lat, imgs[2].Long = -33.0472, -71.6127
+		dbtest.GivenSaved(t, table, imgs...)
+		givenTags(t, table, imgs[0], "mountains", "street art")
+
+		_, err := table.CreateAlbum("patagonia", "Patagonia, Chile & Argentina | 2024")
+		require.NoError(t, err)
+		_, err = table.CreateAlbum("wine", "Wine")
+		require.NoError(t, err)
+		require.NoError(t, table.ReorderAlbums("wine"))
+		dbtest.GivenInAlbum(t, table, "south-america", imgs...)
+		dbtest.GivenInAlbum(t, table, "patagonia", imgs[0])
+		dbtest.GivenInAlbum(t, table, "wine", imgs[1])
+
+		require.NoError(t, table.Trash(imgs[2].ID))
+		return table, imgs
+	}
+
+	emptyTable := func(t *testing.T) *db.ImageTable {
+		table, err := db.NewImageTable("file:" + filepath.Join(t.TempDir(), "import.sqlite"))
+		require.NoError(t, err)
+		t.Cleanup(func() { table.Close() })
+		return table
+	}
+
+	for _, format := range []db.Format{db.JSONL, db.CSV} {
+		t.Run("should re-import "+string(format)+" without losing anything", func(t *testing.T) {
+			table, imgs := givenCatalogue(t)
+			defer table.Close()
+
+			exported := bytes.Buffer{}
+			require.NoError(t, db.Export(context.Background(), table, &exported, format))
+
+			imported := emptyTable(t)
+			report, err := db.Import(context.Background(), imported, bytes.NewReader(exported.Bytes()), format)
+			require.NoError(t, err)
+			assert.Equal(t, db.ImportReport{Inserted: 2, Conflicts: []db.ImportConflict{}}, report)
+
+			for _, img := range imgs[:2] {
+				want, err := table.GetByID(img.ID)
+				require.NoError(t, err)
+				got, err := imported.GetByID(img.ID)
+				require.NoError(t, err)
+				assert.True(t, want.CreatedAt.Equal(got.CreatedAt))
+				assert.True(t, want.UploadedAt.Equal(got.UploadedAt))
+				want.CreatedAt, want.UploadedAt = got.CreatedAt, got.UploadedAt
+				assert.Equal(t, want, got)
+			}
+
+			_, err = imported.GetByID(imgs[2].ID)
+			assert.Equal(t, db.NotFound, err, "trash should not be exported")
+
+			albums, err := imported.ListAlbums()
+			require.NoError(t, err)
+			slugs := []string{}
+			for _, a := range albums {
+				slugs = append(slugs, a.Slug)
+			}
+			assert.Equal(t, []string{"wine", "south-america", "patagonia"}, slugs)
+
+			reexported := bytes.Buffer{}
+			require.NoError(t, db.Export(context.Background(), imported, &reexported, format))
+			assert.Equal(t, exported.String(), reexported.String())
+		})
+	}
+
+	t.Run("should report conflicts when importing over existing images", func(t *testing.T) {
+		table, imgs := givenCatalogue(t)
+		defer table.Close()
+
+		exported := bytes.Buffer{}
+		require.NoError(t, db.Export(context.Background(), table, &exported, db.CSV))
+
+		changed := imgs[0]
+		changed.Title = "Torres del Paine"
+		require.NoError(t, table.Update(changed))
+		require.NoError(t, table.RenameAlbum("patagonia", "Patagonia"))
+
+		report, err := db.Import(context.Background(), table, bytes.NewReader(exported.Bytes()), db.CSV)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Updated)
+		assert.Equal(t, 1, report.Unchanged)
+		assert.Equal(t, []db.ImportConflict{
+			{ID: imgs[0].ID, Field: "title", Existing: "Torres del Paine", Imported: "Torres"},
+			{ID: "patagonia", Field: "albumName", Existing: "Patagonia", Imported: "Patagonia, Chile & Argentina | 2024", Kept: true},
+		}, report.Conflicts)
+
+		img, err := table.GetByID(imgs[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Torres", img.Title)
+	})
+
+	t.Run("should not import over images in the trash", func(t *testing.T) {
+		table, imgs := givenCatalogue(t)
+		defer table.Close()
+
+		rec, err := json.Marshal(db.ExportRecord{Image: imgs[2]})
+		require.NoError(t, err)
+
+		report, err := db.Import(context.Background(), table, bytes.NewReader(rec), db.JSONL)
+		require.NoError(t, err)
+		assert.Equal(t, []db.ImportConflict{{ID: imgs[2].ID, Field: "deletedAt", Existing: "in trash", Kept: true}}, report.Conflicts)
+		assert.Zero(t, report.Inserted)
+	})
+
+	t.Run("should reject bad records", func(t *testing.T) {
+		for name, tt := range map[string]struct {
+			format db.Format
+			body   string
+		}{
+			"unknown column": {db.CSV, "id,colour\nabc,red\n"},
+			"bad time":       {db.CSV, "id,createdAt\nabc,yesterday\n"},
+			"missing id":     {db.JSONL, `{"title": "no id"}`},
+			"bad json":       {db.JSONL, `{"id": `},
+			"bad tag":        {db.JSONL, `{"id": "abc", "tags": ["a,b"]}`},
+			"bad album slug": {db.JSONL, `{"id": "abc", "albums": [{"slug": "Not A Slug", "name": "x"}]}`},
+		} {
+			t.Run(name, func(t *testing.T) {
+				_, err := db.Import(context.Background(), emptyTable(t), strings.NewReader(tt.body), tt.format)
+				assert.Error(t, err)
+			})
+		}
+
+		_, err := db.ParseFormat("xml")
+		assert.ErrorIs(t, err, db.UnknownFormat)
+	})
+
+	t.Run("should import nothing when a later record is bad", func(t *testing.T) {
+		table := emptyTable(t)
+		body := `{"id": "first", "tags": ["sea"], "albums": [{"slug": "coast", "name": "Coast"}]}
+{"id": "second"}
+{"id": "third", "createdAt": "yesterday"}
+`
+		_, err := db.Import(context.Background(), table, strings.NewReader(body), db.JSONL)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "record 3")
+
+		_, err = table.GetByID("first")
+		assert.Equal(t, db.NotFound, err)
+		_, err = table.GetAlbum("coast")
+		assert.Equal(t, db.AlbumNotFound, err)
+		tags, err := table.GetTags()
+		require.NoError(t, err)
+		assert.Empty(t, tags)
+	})
+
+	t.Run("should reject unknown formats", func(t *testing.T) {
+		_, err := db.ParseFormat("xml")
+		assert.ErrorIs(t, err, db.UnknownFormat)
+	})
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Facets are how many images there are in each country and locality
+type Facets struct {
+	Countries []CountryFacet
+}
+
+type CountryFacet struct {
+	Country    string
+	Count      int
+	Localities []LocalityFacet
+}
+
+type LocalityFacet struct {
+	Locality string
+	Count    int
+}
+
+// Facets counts the images in each country and locality that pass the
+// filters of the opts. The country and locality filters are left out so
+// that the counts are of what would be shown if one was picked. Countries
+// and localities are in name order and images without a country aren't
+// counted.
+func (i *ImageTable) Facets(opts ...GetListOptsFn) (Facets, error) {
+	return i.FacetsContext(context.Background(), opts...)
+}
+
+func (i *ImageTable) FacetsContext(ctx context.Context, opts ...GetListOptsFn) (Facets, error) {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	opt, err := facetOpts(opts)
+	if err != nil {
+		return Facets{}, err
+	}
+
+	w := filterWhere(opt)
+	w.add("country IS NOT \"\"")
+
+	rows, err := i.DB.QueryContext(ctx, "SELECT country, locality, COUNT(*) FROM image"+w.String()+
+		" GROUP BY country, locality;", w.args...)
+	if err != nil {
+		return Facets{}, fmt.Errorf("could not get facets: %w", err)
+	}
+	defer rows.Close()
+
+	counts := facetCounts{}
+	for rows.Next() {
+		country, locality, n := "", "", 0
+		err = rows.Scan(&country, &locality, &n)
+		if err != nil {
+			return Facets{}, fmt.Errorf("could not scan facet: %w", err)
+		}
+		counts.add(country, locality, n)
+	}
+	if err = rows.Err(); err != nil {
+		return Facets{}, fmt.Errorf("could not get facets: %w", err)
+	}
+
+	return counts.facets(), nil
+}
+
+// facetOpts are the opts of a Facets without the country and locality
+// filters
+func facetOpts(opts []GetListOptsFn) (GetListOpts, error) {
+	opt, err := listOpts(opts)
+	if err != nil {
+		return GetListOpts{}, err
+	}
+	opt.Countries = nil
+	opt.Localities = nil
+	return opt, nil
+}
+
+// facetCounts is the number of images by country then locality
+type facetCounts map[string]map[string]int
+
+func (fc facetCounts) add(country, locality string, n int) {
+	if fc[country] == nil {
+		fc[country] = map[string]int{}
+	}
+	fc[country][locality] += n
+}
+
+func (fc facetCounts) facets() Facets {
+	f := Facets{Countries: []CountryFacet{}}
+	for country, localities := range fc {
+		cf := CountryFacet{Country: country, Localities: []LocalityFacet{}}
+		for locality, n := range localities {
+			cf.Count += n
+			if locality != "" {
+				cf.Localities = append(cf.Localities, LocalityFacet{Locality: locality, Count: n})
+			}
+		}
+		slices.SortFunc(cf.Localities, func(a, b LocalityFacet) int {
+			return strings.Compare(a.Locality, b.Locality)
+		})
+		f.Countries = append(f.Countries, cf)
+	}
+	slices.SortFunc(f.Countries, func(a, b CountryFacet) int {
+		return strings.Compare(a.Country, b.Country)
+	})
+	return f
+}
@@ -0,0 +1,239 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"math"
+)
+
+var InvalidBounds = errors.New("bounds must be latitudes between -90 and 90 and longitudes between -180 and 180 with south below north")
+var InvalidRadius = errors.New("radius must be around a valid latitude and longitude and more than 0km")
+
+// kmPerDegreeLat is roughly how far apart two lines of latitude a degree
+// apart are, and kmPerDegreeLong the same for longitude at the equator
+const kmPerDegreeLat = 110.574
+const kmPerDegreeLong = 111.320
+
+// imageLocationIndex is an R*Tree over the lat and long of images kept in
+// sync with the image table by triggers. Images without a location are
+// stored as 0, 0 so they are left out of the index.
+//
+// R*Tree coordinates are 32 bit floats, so the index is only used to
+// narrow down the images before comparing against the exact lat and long.
+var imageLocationIndex = execSQL(
+	`CREATE VIRTUAL TABLE image_location USING rtree(
+		id, min_lat, max_lat, min_long, max_long, +image_id
+	);`,
+	`INSERT INTO image_location (min_lat, max_lat, min_long, max_long, image_id)
+		SELECT lat, lat, long, long, id FROM image WHERE `+hasLocation("")+`;`,
+	`CREATE TRIGGER image_location_insert AFTER INSERT ON image WHEN `+hasLocation("new.")+` BEGIN
+		INSERT INTO image_location (min_lat, max_lat, min_long, max_long, image_id)
+		VALUES (new.lat, new.lat, new.long, new.long, new.id);
+	END;`,
+	`CREATE TRIGGER image_location_update AFTER UPDATE OF lat, long ON image BEGIN
+		DELETE FROM image_location WHERE image_id = old.id;
+		INSERT INTO image_location (min_lat, max_lat, min_long, max_long, image_id)
+		SELECT new.lat, new.lat, new.long, new.long, new.id WHERE `+hasLocation("new.")+`;
+	END;`,
+	`CREATE TRIGGER image_location_delete AFTER DELETE ON image BEGIN
+		DELETE FROM image_location WHERE image_id = old.id;
+	END;`,
+)
+
+// hasLocation is the condition for an image having a lat and long, prefix
+// is the table or trigger row to check
+func hasLocation(prefix string) string {
+	return prefix + "lat IS NOT NULL AND " + prefix + "long IS NOT NULL AND NOT (" + prefix + "lat = 0 AND " + prefix + "long = 0)"
+}
+
+// Bounds is a box of latitudes and longitudes. A box that crosses the
+// antimeridian has a West greater than its East.
+type Bounds struct {
+	South float64 `json:"south"`
+	West  float64 `json:"west"`
+	North float64 `json:"north"`
+	East  float64 `json:"east"`
+}
+
+func (b Bounds) IsZero() bool {
+	return b == Bounds{}
+}
+
+func (b Bounds) valid() bool {
+	return b.South >= -90 && b.North <= 90 && b.South <= b.North &&
+		b.West >= -180 && b.West <= 180 && b.East >= -180 && b.East <= 180
+}
+
+// Radius is a circle of Km around a lat and long
+type Radius struct {
+	Lat  float64 `json:"lat"`
+	Long float64 `json:"long"`
+	Km   float64 `json:"km"`
+}
+
+func (r Radius) IsZero() bool {
+	return r == Radius{}
+}
+
+func (r Radius) valid() bool {
+	return r.Lat >= -90 && r.Lat <= 90 && r.Long >= -180 && r.Long <= 180 && r.Km > 0
+}
+
+// bounds is the smallest box the radius fits in, it is only as accurate
+// as the distances in addRadius
+func (r Radius) bounds() Bounds {
+	dLat := r.Km / kmPerDegreeLat
+	b := Bounds{
+		South: math.Max(r.Lat-dLat, -90),
+		North: math.Min(r.Lat+dLat, 90),
+		West:  -180,
+		East:  180,
+	}
+
+	// circles over a pole take in every longitude
+	if r.Lat+dLat >= 90 || r.Lat-dLat <= -90 {
+		return b
+	}
+
+	cos := math.Cos(r.Lat * math.Pi / 180)
+	dLong := r.Km / (kmPerDegreeLong * cos)
+	if dLong >= 180 {
+		return b
+	}
+
+	b.West = wrapLong(r.Long - dLong)
+	b.East = wrapLong(r.Long + dLong)
+	return b
+}
+
+// longScale is how many km a degree of longitude is at the centre
+func (r Radius) longScale() float64 {
+	return kmPerDegreeLong * math.Cos(r.Lat*math.Pi/180)
+}
+
+func wrapLong(long float64) float64 {
+	if long < -180 {
+		return long + 360
+	}
+	if long > 180 {
+		return long - 360
+	}
+	return long
+}
+
+// addBounds adds conditions for images inside the bounds, using the
+// image_location index first
+func (w *where) addBounds(b Bounds) {
+	if b.West <= b.East {
+		w.add(`id IN ( SELECT image_id FROM image_location
+			WHERE max_lat >= (?) AND min_lat <= (?) AND max_long >= (?) AND min_long <= (?) )`,
+			b.South, b.North, b.West, b.East)
+		w.add("lat BETWEEN (?) AND (?) AND long BETWEEN (?) AND (?)", b.South, b.North, b.West, b.East)
+		return
+	}
+
+	w.add(`id IN ( SELECT image_id FROM image_location
+		WHERE max_lat >= (?) AND min_lat <= (?) AND (max_long >= (?) OR min_long <= (?)) )`,
+		b.South, b.North, b.West, b.East)
+	w.add("lat BETWEEN (?) AND (?) AND (long >= (?) OR long <= (?))", b.South, b.North, b.West, b.East)
+}
+
+// addRadius adds conditions for images within the radius. Distances are
+// worked out on a flat projection around the centre which is close
+// enough for the tens of kilometres a map view asks for.
+func (w *where) addRadius(r Radius) {
+	w.addBounds(r.bounds())
+
+	longScale := r.longScale()
+
+	// the difference in longitude is wrapped so a radius crossing the
+	// antimeridian measures the short way round
+	dLong := "(long - (?))"
+	wrapped := "(" + dLong + " - 360 * ((" + dLong + " > 180) - (" + dLong + " < -180)))"
+	y := "((lat - (?)) * (?))"
+	x := "(" + wrapped + " * (?))"
+
+	args := []any{r.Lat, kmPerDegreeLat, r.Lat, kmPerDegreeLat}
+	for range 2 {
+		args = append(args, r.Long, r.Long, r.Long, longScale)
+	}
+	w.add(y+" * "+y+" + "+x+" * "+x+" <= (?)", append(args, r.Km*r.Km)...)
+}
+
+// imageHasLocation and the contains methods do the same as the SQL above
+// for images that aren't in SQLite, such as in MemoryCatalogue
+
+func imageHasLocation(img Image) bool {
+	return !(img.Lat == 0 && img.Long == 0)
+}
+
+func (b Bounds) contains(lat, long float64) bool {
+	if lat < b.South || lat > b.North {
+		return false
+	}
+	if b.West <= b.East {
+		return long >= b.West && long <= b.East
+	}
+	return long >= b.West || long <= b.East
+}
+
+func (r Radius) contains(lat, long float64) bool {
+	if !r.bounds().contains(lat, long) {
+		return false
+	}
+
+	dLong := long - r.Long
+	if dLong > 180 {
+		dLong -= 360
+	} else if dLong < -180 {
+		dLong += 360
+	}
+
+	// the conversions stop the multiplications being fused with the
+	// addition, which would round differently to SQLite
+	y := float64((lat - r.Lat) * kmPerDegreeLat)
+	x := float64(dLong * r.longScale())
+	return float64(y*y)+float64(x*x) <= r.Km*r.Km
+}
+
+// InBounds gets the images inside the bounds, the opts page and filter
+// the list the same as GetList
+func (i *ImageTable) InBounds(b Bounds, opts ...GetListOptsFn) (ImageList, error) {
+	return i.InBoundsContext(context.Background(), b, opts...)
+}
+
+func (i *ImageTable) InBoundsContext(ctx context.Context, b Bounds, opts ...GetListOptsFn) (ImageList, error) {
+	return i.GetListContext(ctx, append(opts, WithBounds(b))...)
+}
+
+// WithinKm gets the images within km of the lat and long, the opts page
+// and filter the list the same as GetList
+func (i *ImageTable) WithinKm(lat, long, km float64, opts ...GetListOptsFn) (ImageList, error) {
+	return i.WithinKmContext(context.Background(), lat, long, km, opts...)
+}
+
+func (i *ImageTable) WithinKmContext(ctx context.Context, lat, long, km float64, opts ...GetListOptsFn) (ImageList, error) {
+	return i.GetListContext(ctx, append(opts, WithRadius(Radius{Lat: lat, Long: long, Km: km}))...)
+}
+
+// WithBounds limits the list to images taken inside the bounds
+func WithBounds(b Bounds) GetListOptsFn {
+	return func(glo *GetListOpts) error {
+		if !b.valid() {
+			return InvalidBounds
+		}
+		glo.Bounds = b
+		return nil
+	}
+}
+
+// WithRadius limits the list to images taken within the radius
+func WithRadius(r Radius) GetListOptsFn {
+	return func(glo *GetListOpts) error {
+		if !r.valid() {
+			return InvalidRadius
+		}
+		glo.Radius = r
+		return nil
+	}
+}
@@ -0,0 +1,123 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wobwainwwight/sa-photos/db"
+	"github.com/wobwainwwight/sa-photos/db/dbtest"
+)
+
+func TestLocation(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	imgs := dbtest.GivenSaved(t, table, dbtest.SpaceByHour([]db.Image{
+		givenImageAt(t, -51.7236, -72.5064), // puerto natales
+		givenImageAt(t, -50.9423, -73.4068), // torres del paine
+		givenImageAt(t, -53.1638, -70.9171), // punta arenas
+		givenImageAt(t, -33.4489, -70.6693), // santiago
+		givenImageAt(t, -16.8, 179.95),      // either side of the antimeridian
+		givenImageAt(t, -16.8, -179.95),
+		givenImageAt(t, 0, 0), // no location
+	})...)
+
+	ids := func(t *testing.T, list db.ImageList, err error) []string {
+		require.NoError(t, err)
+		found := []string{}
+		for len(list.Images) > 0 {
+			for _, img := range list.Images {
+				found = append(found, img.ID)
+			}
+			list, err = table.GetList(db.WithCursorStr(list.Cursor.EncodedString()))
+			require.NoError(t, err)
+		}
+		return found
+	}
+
+	expected := func(indexes ...int) []string {
+		e := []string{}
+		for _, i := range indexes {
+			e = append(e, imgs[i].ID)
+		}
+		return e
+	}
+
+	t.Run("should only index images with a location", func(t *testing.T) {
+		count := 0
+		require.NoError(t, table.DB.QueryRow("SELECT COUNT(*) FROM image_location;").Scan(&count))
+		assert.Equal(t, 6, count)
+	})
+
+	t.Run("should get images in bounds with cursor", func(t *testing.T) {
+		patagonia := db.Bounds{South: -54, West: -76, North: -50, East: -68}
+		list, err := table.InBounds(patagonia, db.WithLimit(1))
+		assert.Equal(t, expected(0, 1, 2), ids(t, list, err))
+	})
+
+	t.Run("should include images on the edge of the bounds", func(t *testing.T) {
+		edge := db.Bounds{South: -51.7236, West: -72.5064, North: -51.7236, East: -72.5064}
+		list, err := table.InBounds(edge)
+		assert.Equal(t, expected(0), ids(t, list, err))
+	})
+
+	t.Run("should get images in bounds across the antimeridian", func(t *testing.T) {
+		fiji := db.Bounds{South: -20, West: 179, North: -15, East: -179}
+		list, err := table.InBounds(fiji)
+		assert.Equal(t, expected(4, 5), ids(t, list, err))
+	})
+
+	t.Run("should get images within km", func(t *testing.T) {
+		list, err := table.WithinKm(-51.7236, -72.5064, 150, db.WithLimit(1))
+		assert.Equal(t, expected(0, 1), ids(t, list, err))
+
+		list, err = table.WithinKm(-51.7236, -72.5064, 250, db.WithDescOrder())
+		assert.Equal(t, expected(2, 1, 0), ids(t, list, err))
+
+		list, err = table.WithinKm(-51.7236, -72.5064, 50)
+		assert.Equal(t, expected(0), ids(t, list, err))
+	})
+
+	t.Run("should get images within km across the antimeridian", func(t *testing.T) {
+		list, err := table.WithinKm(-16.8, 179.99, 50)
+		assert.Equal(t, expected(4, 5), ids(t, list, err))
+	})
+
+	t.Run("should combine with other filters", func(t *testing.T) {
+		list, err := table.WithinKm(-51.7236, -72.5064, 150, db.WithDateRange(imgs[1].CreatedAt, imgs[3].CreatedAt))
+		assert.Equal(t, expected(1), ids(t, list, err))
+	})
+
+	t.Run("should not accept invalid areas", func(t *testing.T) {
+		_, err := table.InBounds(db.Bounds{South: -50, West: -76, North: -54, East: -68})
+		assert.ErrorIs(t, err, db.InvalidBounds)
+
+		_, err = table.InBounds(db.Bounds{South: -54, West: -200, North: -50, East: -68})
+		assert.ErrorIs(t, err, db.InvalidBounds)
+
+		_, err = table.WithinKm(-51.7236, -72.5064, 0)
+		assert.ErrorIs(t, err, db.InvalidRadius)
+
+		_, err = table.WithinKm(-91, -72.5064, 10)
+		assert.ErrorIs(t, err, db.InvalidRadius)
+	})
+
+	t.Run("should remove deleted images from the index", func(t *testing.T) {
+		require.NoError(t, table.Delete(imgs[0].ID))
+
+		count := 0
+		require.NoError(t, table.DB.QueryRow("SELECT COUNT(*) FROM image_location;").Scan(&count))
+		assert.Equal(t, 5, count)
+
+		list, err := table.WithinKm(-51.7236, -72.5064, 150)
+		assert.Equal(t, expected(1), ids(t, list, err))
+	})
+}
+
+func givenImageAt(t *testing.T, lat, long float64) db.Image {
+	i := dbtest.GivenImage(t)
+	i.Lat = lat
+	i.Long = long
+	return i
+}
@@ -0,0 +1,1012 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sqlite "github.com/mattn/go-sqlite3"
+)
+
+// MemoryCatalogue keeps images in memory rather than SQLite. It lists,
+// filters and pages images the same as ImageTable so cursors from one
+// work with the other, which is checked by dbtest.TestCatalogue.
+type MemoryCatalogue struct {
+	mu          sync.RWMutex
+	images      map[string]*memoryImage
+	albums      map[string]Album
+	albumImages map[string]map[string]bool
+	audit       []AuditEvent
+	keptBoth    map[[2]string]bool
+}
+
+type memoryImage struct {
+	img       Image
+	tags      []string
+	deletedAt time.Time
+}
+
+// NewMemoryCatalogue is an empty catalogue with the south-america album
+// that every ImageTable is created with
+func NewMemoryCatalogue() *MemoryCatalogue {
+	return &MemoryCatalogue{
+		images: map[string]*memoryImage{},
+		albums: map[string]Album{
+			"south-america": {Slug: "south-america", Name: "South America", Position: 0, CreatedAt: now()},
+		},
+		albumImages: map[string]map[string]bool{},
+		keptBoth:    map[[2]string]bool{},
+	}
+}
+
+// now is the time to the second, as CURRENT_TIMESTAMP defaults are
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// timeKey is how SQLite stores and compares times written by go-sqlite3,
+// images are ordered by it rather than by the time itself
+func timeKey(t time.Time) string {
+	return t.Format(sqlite.SQLiteTimestampFormats[0])
+}
+
+// dateTime is the time to the second in UTC, as SQLite's datetime()
+func dateTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+func (m *MemoryCatalogue) Save(img Image) error {
+	err := m.Insert(img)
+	if err == DuplicateImage {
+		return m.Update(img)
+	}
+	return err
+}
+
+func (m *MemoryCatalogue) Insert(img Image) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.images[img.ID]; ok {
+		return DuplicateImage
+	}
+
+	if img.UploadedAt.IsZero() {
+		img.UploadedAt = now()
+	}
+	img.Tags = nil
+	img.DeletedAt = nil
+	m.images[img.ID] = &memoryImage{img: img}
+	return nil
+}
+
+func (m *MemoryCatalogue) Update(img Image) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mi, ok := m.images[img.ID]
+	if !ok || !mi.deletedAt.IsZero() {
+		return NotFound
+	}
+
+	mi.img.Title = img.Title
+	mi.img.Caption = img.Caption
+	mi.img.AltText = img.AltText
+	mi.img.Locality = img.Locality
+	mi.img.Country = img.Country
+	return nil
+}
+
+func (m *MemoryCatalogue) GetByID(id string) (Image, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	mi, ok := m.images[id]
+	if !ok || !mi.deletedAt.IsZero() {
+		return Image{}, NotFound
+	}
+	return mi.image(), nil
+}
+
+// image is a copy of the image that can be handed out
+func (mi *memoryImage) image() Image {
+	img := mi.img
+	if len(mi.tags) > 0 {
+		img.Tags = slices.Clone(mi.tags)
+	}
+	if !mi.deletedAt.IsZero() {
+		deletedAt := mi.deletedAt
+		img.DeletedAt = &deletedAt
+	}
+	return img
+}
+
+func (m *MemoryCatalogue) GetList(opts ...GetListOptsFn) (ImageList, error) {
+	opt, err := listOpts(opts)
+	if err != nil {
+		return ImageList{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	startKey, startID := "", opt.ExclStartKey
+	if len(opt.ExclStartKey) > 0 {
+		if opt.ExclStartCreatedAt.IsZero() {
+			start, ok := m.images[opt.ExclStartKey]
+			if !ok {
+				return newImageList(opt, []Image{})
+			}
+			startKey = timeKey(start.img.CreatedAt)
+		} else {
+			startKey = timeKey(opt.ExclStartCreatedAt)
+		}
+	}
+
+	matched := []*memoryImage{}
+	for _, mi := range m.images {
+		if len(opt.ExclStartKey) > 0 {
+			c := compareKeys(timeKey(mi.img.CreatedAt), mi.img.ID, startKey, startID)
+			if (opt.Order == ASC && c <= 0) || (opt.Order != ASC && c >= 0) {
+				continue
+			}
+		}
+		if m.matches(opt, mi) {
+			matched = append(matched, mi)
+		}
+	}
+
+	slices.SortFunc(matched, func(a, b *memoryImage) int {
+		c := compareKeys(timeKey(a.img.CreatedAt), a.img.ID, timeKey(b.img.CreatedAt), b.img.ID)
+		if opt.Order != ASC {
+			return -c
+		}
+		return c
+	})
+
+	offset, limit := 0, opt.Limit
+	if opt.Page > 0 && len(opt.ExclStartKey) == 0 {
+		offset, limit = pageSize*(opt.Page-1), pageSize
+	}
+	matched = matched[min(offset, len(matched)):]
+	if limit >= 0 && limit < len(matched) {
+		matched = matched[:limit]
+	}
+
+	imgs := make([]Image, len(matched))
+	for i, mi := range matched {
+		imgs[i] = mi.image()
+	}
+	return newImageList(opt, imgs)
+}
+
+// compareKeys compares (created_at, id) keys
+func compareKeys(aTime, aID, bTime, bID string) int {
+	if c := strings.Compare(aTime, bTime); c != 0 {
+		return c
+	}
+	return strings.Compare(aID, bID)
+}
+
+// matches is whether an image passes the filters of the opts, these are
+// the conditions of ImageTable.GetList other than the start key
+func (m *MemoryCatalogue) matches(opt GetListOpts, mi *memoryImage) bool {
+	img := mi.img
+	if !mi.deletedAt.IsZero() {
+		return false
+	}
+	if (len(opt.Countries) > 0 || len(opt.Localities) > 0) &&
+		!inPlaceScopes(placeScopes(opt.Countries, opt.Localities), img.Country, img.Locality) {
+		return false
+	}
+	if len(opt.Album) > 0 && !m.albumImages[opt.Album][img.ID] {
+		return false
+	}
+	if !opt.From.IsZero() && dateTime(img.CreatedAt).Before(dateTime(opt.From)) {
+		return false
+	}
+	if !opt.To.IsZero() && !dateTime(img.CreatedAt).Before(dateTime(opt.To)) {
+		return false
+	}
+	if !opt.Bounds.IsZero() && (!imageHasLocation(img) || !opt.Bounds.contains(img.Lat, img.Long)) {
+		return false
+	}
+	if !opt.Radius.IsZero() && (!imageHasLocation(img) || !opt.Radius.contains(img.Lat, img.Long)) {
+		return false
+	}
+	if len(opt.Query) > 0 {
+		texts := append([]string{img.Title, img.Caption, img.AltText, img.Locality, img.Country}, mi.tags...)
+		if !searchMatches(opt.Query, texts...) {
+			return false
+		}
+	}
+	if len(opt.Tags) > 0 {
+		matching := 0
+		for _, t := range uniqueStrings(opt.Tags) {
+			if slices.Contains(mi.tags, t) {
+				matching++
+			}
+		}
+		if matching == 0 || (opt.TagMatch == MatchAllTags && matching < len(uniqueStrings(opt.Tags))) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *MemoryCatalogue) Facets(opts ...GetListOptsFn) (Facets, error) {
+	opt, err := facetOpts(opts)
+	if err != nil {
+		return Facets{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := facetCounts{}
+	for _, mi := range m.images {
+		if mi.img.Country != "" && m.matches(opt, mi) {
+			counts.add(mi.img.Country, mi.img.Locality, 1)
+		}
+	}
+	return counts.facets(), nil
+}
+
+// GetStats works out the Stats as ImageTable.GetStats does
+func (m *MemoryCatalogue) GetStats(opts ...GetListOptsFn) (Stats, error) {
+	opt, err := listOpts(opts)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matched := []*memoryImage{}
+	for _, mi := range m.images {
+		if m.matches(opt, mi) {
+			matched = append(matched, mi)
+		}
+	}
+	slices.SortFunc(matched, func(a, b *memoryImage) int {
+		return compareKeys(timeKey(a.img.CreatedAt), a.img.ID, timeKey(b.img.CreatedAt), b.img.ID)
+	})
+
+	sc := newStatsCounts()
+	for _, mi := range matched {
+		img := mi.img
+		if !imageIsDated(img) {
+			sc.addPlace(img.Country, img.Locality, 1, time.Time{}, time.Time{})
+			continue
+		}
+
+		createdAt := dateTime(img.CreatedAt)
+		date := createdAt.Format(time.DateOnly)
+		sc.addPlace(img.Country, img.Locality, 1, createdAt, createdAt)
+		sc.addDay(date, 1)
+		if imageHasLocation(img) {
+			sc.addStop(date, img.Lat, img.Long)
+		}
+	}
+	return sc.stats(), nil
+}
+
+// Delete removes an image for good along with its tags and albums
+func (m *MemoryCatalogue) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.delete(id)
+	return nil
+}
+
+func (m *MemoryCatalogue) delete(id string) {
+	delete(m.images, id)
+	for _, ids := range m.albumImages {
+		delete(ids, id)
+	}
+	for pair := range m.keptBoth {
+		if pair[0] == id || pair[1] == id {
+			delete(m.keptBoth, pair)
+		}
+	}
+}
+
+func (m *MemoryCatalogue) GetLocalities() ([]Locality, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	localities := []Locality{}
+	for _, mi := range m.images {
+		img := mi.img
+		if img.Country == "" || !mi.deletedAt.IsZero() {
+			continue
+		}
+		localities = addLocality(localities, img.Country, img.Locality)
+	}
+	return sortLocalities(localities), nil
+}
+
+func (m *MemoryCatalogue) AddTags(id string, tags ...string) error {
+	tags, err := normaliseTags(tags)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mi, ok := m.images[id]
+	if !ok || !mi.deletedAt.IsZero() {
+		return NotFound
+	}
+	for _, t := range tags {
+		if !slices.Contains(mi.tags, t) {
+			mi.tags = append(mi.tags, t)
+		}
+	}
+	slices.Sort(mi.tags)
+	return nil
+}
+
+func (m *MemoryCatalogue) RemoveTags(id string, tags ...string) error {
+	tags, err := normaliseTags(tags)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if mi, ok := m.images[id]; ok {
+		mi.tags = slices.DeleteFunc(mi.tags, func(t string) bool {
+			return slices.Contains(tags, t)
+		})
+	}
+	return nil
+}
+
+func (m *MemoryCatalogue) SetTags(id string, tags ...string) error {
+	tags, err := normaliseTags(tags)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mi, ok := m.images[id]
+	if !ok || !mi.deletedAt.IsZero() {
+		return NotFound
+	}
+	mi.tags = slices.Clone(tags)
+	slices.Sort(mi.tags)
+	return nil
+}
+
+func (m *MemoryCatalogue) UpdateWithTags(img Image, tags ...string) error {
+	tags, err := normaliseTags(tags)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mi, ok := m.images[img.ID]
+	if !ok || !mi.deletedAt.IsZero() {
+		return NotFound
+	}
+
+	mi.img.Title = img.Title
+	mi.img.Caption = img.Caption
+	mi.img.AltText = img.AltText
+	mi.img.Locality = img.Locality
+	mi.img.Country = img.Country
+	mi.tags = slices.Clone(tags)
+	slices.Sort(mi.tags)
+	return nil
+}
+
+func (m *MemoryCatalogue) GetTags() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tags := []string{}
+	for _, mi := range m.images {
+		if !mi.deletedAt.IsZero() {
+			continue
+		}
+		for _, t := range mi.tags {
+			if !slices.Contains(tags, t) {
+				tags = append(tags, t)
+			}
+		}
+	}
+	slices.Sort(tags)
+	return tags, nil
+}
+
+func (m *MemoryCatalogue) CreateAlbum(slug, name string) (Album, error) {
+	if !slugPattern.MatchString(slug) {
+		return Album{}, InvalidSlug
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.albums[slug]; ok {
+		return Album{}, DuplicateAlbum
+	}
+
+	position := 0
+	for _, a := range m.albums {
+		position = max(position, a.Position+1)
+	}
+
+	a := Album{Slug: slug, Name: name, Position: position, CreatedAt: now()}
+	m.albums[slug] = a
+	return a, nil
+}
+
+func (m *MemoryCatalogue) GetAlbum(slug string) (Album, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	a, ok := m.albums[slug]
+	if !ok {
+		return Album{}, AlbumNotFound
+	}
+	return a, nil
+}
+
+func (m *MemoryCatalogue) ListAlbums() ([]Album, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.listAlbums(), nil
+}
+
+func (m *MemoryCatalogue) listAlbums() []Album {
+	albums := make([]Album, 0, len(m.albums))
+	for _, a := range m.albums {
+		albums = append(albums, a)
+	}
+	slices.SortFunc(albums, func(a, b Album) int {
+		if a.Position != b.Position {
+			return a.Position - b.Position
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return albums
+}
+
+func (m *MemoryCatalogue) RenameAlbum(slug, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.albums[slug]
+	if !ok {
+		return AlbumNotFound
+	}
+	a.Name = name
+	m.albums[slug] = a
+	return nil
+}
+
+// ReorderAlbums moves the given albums to the front in the order given,
+// as ImageTable.ReorderAlbums does
+func (m *MemoryCatalogue) ReorderAlbums(slugs ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	albums := m.listAlbums()
+	order := make([]string, 0, len(albums))
+	seen := map[string]bool{}
+	for _, s := range slugs {
+		if seen[s] {
+			continue
+		}
+		if !containsAlbum(albums, s) {
+			return fmt.Errorf("could not reorder album %s: %w", s, AlbumNotFound)
+		}
+		seen[s] = true
+		order = append(order, s)
+	}
+	for _, a := range albums {
+		if !seen[a.Slug] {
+			order = append(order, a.Slug)
+		}
+	}
+
+	for pos, s := range order {
+		a := m.albums[s]
+		a.Position = pos
+		m.albums[s] = a
+	}
+	return nil
+}
+
+func (m *MemoryCatalogue) AddToAlbum(slug string, ids ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.albums[slug]; !ok {
+		return AlbumNotFound
+	}
+	if m.albumImages[slug] == nil {
+		m.albumImages[slug] = map[string]bool{}
+	}
+	for _, id := range ids {
+		m.albumImages[slug][id] = true
+	}
+	return nil
+}
+
+func (m *MemoryCatalogue) RemoveFromAlbum(slug string, ids ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range ids {
+		delete(m.albumImages[slug], id)
+	}
+	return nil
+}
+
+func (m *MemoryCatalogue) Trash(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mi, ok := m.images[id]
+	if !ok || !mi.deletedAt.IsZero() {
+		return NotFound
+	}
+	mi.deletedAt = time.Now().UTC()
+	return nil
+}
+
+func (m *MemoryCatalogue) Restore(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mi, ok := m.images[id]
+	if !ok || mi.deletedAt.IsZero() {
+		return NotFound
+	}
+	mi.deletedAt = time.Time{}
+	return nil
+}
+
+func (m *MemoryCatalogue) GetTrash() ([]Image, error) {
+	return m.getTrash(func(*memoryImage) bool { return true }), nil
+}
+
+func (m *MemoryCatalogue) GetTrashedBefore(before time.Time) ([]Image, error) {
+	return m.getTrash(func(mi *memoryImage) bool {
+		return dateTime(mi.deletedAt).Before(dateTime(before))
+	}), nil
+}
+
+func (m *MemoryCatalogue) Purge(id string, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mi, ok := m.images[id]
+	if !ok || mi.deletedAt.IsZero() || !dateTime(mi.deletedAt).Before(dateTime(before)) {
+		return NotFound
+	}
+	m.delete(id)
+	return nil
+}
+
+func (m *MemoryCatalogue) getTrash(include func(*memoryImage) bool) []Image {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	trashed := []*memoryImage{}
+	for _, mi := range m.images {
+		if !mi.deletedAt.IsZero() && include(mi) {
+			trashed = append(trashed, mi)
+		}
+	}
+	slices.SortFunc(trashed, func(a, b *memoryImage) int {
+		return compareKeys(timeKey(b.deletedAt), a.img.ID, timeKey(a.deletedAt), b.img.ID)
+	})
+
+	imgs := make([]Image, len(trashed))
+	for i, mi := range trashed {
+		imgs[i] = mi.image()
+	}
+	return imgs
+}
+
+func (m *MemoryCatalogue) AddAuditEvent(username, action, imageID string, before, after *Image) error {
+	beforeJSON, err := json.Marshal(before)
+	if err != nil {
+		return fmt.Errorf("could not marshal image %s for audit: %w", imageID, err)
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return fmt.Errorf("could not marshal image %s for audit: %w", imageID, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.audit = append(m.audit, AuditEvent{
+		ID:        int64(len(m.audit) + 1),
+		Username:  username,
+		Action:    action,
+		ImageID:   imageID,
+		Before:    beforeJSON,
+		After:     afterJSON,
+		CreatedAt: time.Now().UTC(),
+	})
+	return nil
+}
+
+// GetAuditEvents pages through the audit log as ImageTable.GetAuditEvents does
+func (m *MemoryCatalogue) GetAuditEvents(opts ...GetListOptsFn) (AuditList, error) {
+	opt, err := auditOpts(opts)
+	if err != nil {
+		return AuditList{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := slices.Clone(m.audit)
+	if opt.Order != ASC {
+		slices.Reverse(events)
+	}
+
+	if len(opt.ExclStartKey) > 0 {
+		startID, err := strconv.ParseInt(opt.ExclStartKey, 10, 64)
+		if err != nil {
+			return AuditList{}, fmt.Errorf("%w: audit start key must be a number", InvalidCursor)
+		}
+		events = slices.DeleteFunc(events, func(e AuditEvent) bool {
+			if opt.Order == ASC {
+				return e.ID <= startID
+			}
+			return e.ID >= startID
+		})
+	}
+
+	if opt.Limit >= 0 && opt.Limit < len(events) {
+		events = events[:opt.Limit]
+	}
+
+	return newAuditList(opt, events)
+}
+
+// GetDuplicates pairs up images as ImageTable.GetDuplicates does
+func (m *MemoryCatalogue) GetDuplicates(maxDistance int) ([]DuplicatePair, error) {
+	return m.getDuplicates(context.Background(), maxDistance)
+}
+
+func (m *MemoryCatalogue) getDuplicates(ctx context.Context, maxDistance int) ([]DuplicatePair, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	hashed := []*memoryImage{}
+	for _, mi := range m.images {
+		if mi.img.DHash != "" && mi.deletedAt.IsZero() {
+			hashed = append(hashed, mi)
+		}
+	}
+	slices.SortFunc(hashed, func(a, b *memoryImage) int {
+		return compareKeys(timeKey(a.img.CreatedAt), a.img.ID, timeKey(b.img.CreatedAt), b.img.ID)
+	})
+
+	imgs := make([]Image, len(hashed))
+	for i, mi := range hashed {
+		imgs[i] = mi.image()
+	}
+	return findDuplicates(ctx, imgs, m.keptBoth, maxDistance)
+}
+
+func (m *MemoryCatalogue) KeepBoth(id, otherID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range []string{id, otherID} {
+		mi, ok := m.images[id]
+		if !ok || !mi.deletedAt.IsZero() {
+			return NotFound
+		}
+	}
+	m.keptBoth[keptPair(id, otherID)] = true
+	return nil
+}
+
+func (m *MemoryCatalogue) SetDHash(id, dhash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mi, ok := m.images[id]
+	if !ok {
+		return NotFound
+	}
+	mi.img.DHash = dhash
+	return nil
+}
+
+func (m *MemoryCatalogue) GetUnhashed() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := []string{}
+	for id, mi := range m.images {
+		if mi.img.DHash == "" {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// GetUnoriented is always empty, images are only ever kept in memory
+// since Save started turning them the right way up
+func (m *MemoryCatalogue) GetUnoriented() ([]string, error) {
+	return []string{}, nil
+}
+
+func (m *MemoryCatalogue) SetOriented(img Image) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mi, ok := m.images[img.ID]
+	if !ok {
+		return NotFound
+	}
+	mi.img.Width, mi.img.Height = img.Width, img.Height
+	mi.img.ThumbHash, mi.img.DHash = img.ThumbHash, img.DHash
+	return nil
+}
+
+// The Context variants of MemoryCatalogue only check the context before
+// starting, nothing in memory takes long enough to stop part way through.
+
+func (m *MemoryCatalogue) SaveContext(ctx context.Context, img Image) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Save(img)
+}
+
+func (m *MemoryCatalogue) InsertContext(ctx context.Context, img Image) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Insert(img)
+}
+
+func (m *MemoryCatalogue) UpdateContext(ctx context.Context, img Image) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Update(img)
+}
+
+func (m *MemoryCatalogue) GetByIDContext(ctx context.Context, id string) (Image, error) {
+	if err := ctx.Err(); err != nil {
+		return Image{}, err
+	}
+	return m.GetByID(id)
+}
+
+func (m *MemoryCatalogue) GetListContext(ctx context.Context, opts ...GetListOptsFn) (ImageList, error) {
+	if err := ctx.Err(); err != nil {
+		return ImageList{}, err
+	}
+	return m.GetList(opts...)
+}
+
+func (m *MemoryCatalogue) FacetsContext(ctx context.Context, opts ...GetListOptsFn) (Facets, error) {
+	if err := ctx.Err(); err != nil {
+		return Facets{}, err
+	}
+	return m.Facets(opts...)
+}
+
+func (m *MemoryCatalogue) DeleteContext(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Delete(id)
+}
+
+func (m *MemoryCatalogue) GetLocalitiesContext(ctx context.Context) ([]Locality, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.GetLocalities()
+}
+
+func (m *MemoryCatalogue) AddTagsContext(ctx context.Context, id string, tags ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.AddTags(id, tags...)
+}
+
+func (m *MemoryCatalogue) RemoveTagsContext(ctx context.Context, id string, tags ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.RemoveTags(id, tags...)
+}
+
+func (m *MemoryCatalogue) SetTagsContext(ctx context.Context, id string, tags ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.SetTags(id, tags...)
+}
+
+func (m *MemoryCatalogue) UpdateWithTagsContext(ctx context.Context, img Image, tags ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.UpdateWithTags(img, tags...)
+}
+
+func (m *MemoryCatalogue) GetTagsContext(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.GetTags()
+}
+
+func (m *MemoryCatalogue) CreateAlbumContext(ctx context.Context, slug, name string) (Album, error) {
+	if err := ctx.Err(); err != nil {
+		return Album{}, err
+	}
+	return m.CreateAlbum(slug, name)
+}
+
+func (m *MemoryCatalogue) GetAlbumContext(ctx context.Context, slug string) (Album, error) {
+	if err := ctx.Err(); err != nil {
+		return Album{}, err
+	}
+	return m.GetAlbum(slug)
+}
+
+func (m *MemoryCatalogue) ListAlbumsContext(ctx context.Context) ([]Album, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.ListAlbums()
+}
+
+func (m *MemoryCatalogue) RenameAlbumContext(ctx context.Context, slug, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.RenameAlbum(slug, name)
+}
+
+func (m *MemoryCatalogue) ReorderAlbumsContext(ctx context.Context, slugs ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.ReorderAlbums(slugs...)
+}
+
+func (m *MemoryCatalogue) AddToAlbumContext(ctx context.Context, slug string, ids ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.AddToAlbum(slug, ids...)
+}
+
+func (m *MemoryCatalogue) RemoveFromAlbumContext(ctx context.Context, slug string, ids ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.RemoveFromAlbum(slug, ids...)
+}
+
+func (m *MemoryCatalogue) TrashContext(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Trash(id)
+}
+
+func (m *MemoryCatalogue) RestoreContext(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Restore(id)
+}
+
+func (m *MemoryCatalogue) GetTrashContext(ctx context.Context) ([]Image, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.GetTrash()
+}
+
+func (m *MemoryCatalogue) GetTrashedBeforeContext(ctx context.Context, before time.Time) ([]Image, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.GetTrashedBefore(before)
+}
+
+func (m *MemoryCatalogue) PurgeContext(ctx context.Context, id string, before time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Purge(id, before)
+}
+
+func (m *MemoryCatalogue) AddAuditEventContext(ctx context.Context, username, action, imageID string, before, after *Image) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.AddAuditEvent(username, action, imageID, before, after)
+}
+
+func (m *MemoryCatalogue) GetAuditEventsContext(ctx context.Context, opts ...GetListOptsFn) (AuditList, error) {
+	if err := ctx.Err(); err != nil {
+		return AuditList{}, err
+	}
+	return m.GetAuditEvents(opts...)
+}
+
+func (m *MemoryCatalogue) GetDuplicatesContext(ctx context.Context, maxDistance int) ([]DuplicatePair, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.getDuplicates(ctx, maxDistance)
+}
+
+func (m *MemoryCatalogue) KeepBothContext(ctx context.Context, id, otherID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.KeepBoth(id, otherID)
+}
+
+func (m *MemoryCatalogue) SetDHashContext(ctx context.Context, id, dhash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.SetDHash(id, dhash)
+}
+
+func (m *MemoryCatalogue) GetUnhashedContext(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.GetUnhashed()
+}
+
+func (m *MemoryCatalogue) GetUnorientedContext(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.GetUnoriented()
+}
+
+func (m *MemoryCatalogue) SetOrientedContext(ctx context.Context, img Image) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.SetOriented(img)
+}
+
+func (m *MemoryCatalogue) GetStatsContext(ctx context.Context, opts ...GetListOptsFn) (Stats, error) {
+	if err := ctx.Err(); err != nil {
+		return Stats{}, err
+	}
+	return m.GetStats(opts...)
+}
@@ -0,0 +1,209 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migration is a numbered change to the schema. Migrations are applied in
+// version order and each version is only ever applied once, so once a
+// migration has shipped it should not be edited, add a new one instead.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	{1, "create image table", execSQL(`CREATE TABLE IF NOT EXISTS image (
+	    id TEXT PRIMARY KEY,
+	    mime_type TEXT NOT NULL,
+		width INT NOT NULL,
+		height INT NOT NULL,
+		thumbhash TEXT,
+		lat REAL,
+		long REAL,
+		locality STRING,
+		country STRING,
+	    created_at DATETIME,
+		uploaded_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	) WITHOUT ROWID;`)},
+	{2, "create album tables", execSQL(
+		`CREATE TABLE album (
+			slug TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			position INT NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		) WITHOUT ROWID;`,
+		`CREATE TABLE album_image (
+			album_slug TEXT NOT NULL,
+			image_id TEXT NOT NULL,
+			PRIMARY KEY (album_slug, image_id)
+		) WITHOUT ROWID;`,
+		`CREATE INDEX album_image_image_id ON album_image (image_id);`,
+		`CREATE TRIGGER image_delete_album_image AFTER DELETE ON image BEGIN
+			DELETE FROM album_image WHERE image_id = old.id;
+		END;`,
+		// everything uploaded so far was from the South America trip
+		`INSERT INTO album (slug, name, position) VALUES ('south-america', 'South America', 0);`,
+		`INSERT INTO album_image (album_slug, image_id) SELECT 'south-america', id FROM image;`,
+	)},
+	{3, "create tag table", execSQL(
+		`CREATE TABLE tag (
+			image_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			PRIMARY KEY (image_id, name)
+		) WITHOUT ROWID;`,
+		`CREATE INDEX tag_name ON tag (name);`,
+		`CREATE TRIGGER image_delete_tag AFTER DELETE ON image BEGIN
+			DELETE FROM tag WHERE image_id = old.id;
+		END;`,
+	)},
+	{4, "create image search index", searchIndex("locality", "country")},
+	{5, "add image title, caption and alt text", inOrder(
+		execSQL(
+			`ALTER TABLE image ADD COLUMN title TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE image ADD COLUMN caption TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE image ADD COLUMN alt_text TEXT NOT NULL DEFAULT '';`,
+		),
+		dropSearchIndex,
+		searchIndex("title", "caption", "alt_text", "locality", "country"),
+	)},
+	{6, "index image created_at", execSQL(
+		`CREATE INDEX image_created_at_id ON image (created_at, id);`,
+	)},
+	{7, "create image location index", imageLocationIndex},
+	{8, "add image deleted_at", execSQL(
+		`ALTER TABLE image ADD COLUMN deleted_at DATETIME;`,
+		`CREATE INDEX image_deleted_at ON image (deleted_at);`,
+	)},
+	{9, "create audit event table", execSQL(
+		`CREATE TABLE audit_event (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL,
+			action TEXT NOT NULL,
+			image_id TEXT NOT NULL,
+			before TEXT,
+			after TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX audit_event_image_id ON audit_event (image_id);`,
+	)},
+	{10, "add image dhash", execSQL(
+		`ALTER TABLE image ADD COLUMN dhash TEXT NOT NULL DEFAULT '';`,
+		`CREATE TABLE duplicate_kept (
+			image_id TEXT NOT NULL,
+			other_id TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (image_id, other_id)
+		) WITHOUT ROWID;`,
+		`CREATE TRIGGER image_delete_duplicate_kept AFTER DELETE ON image BEGIN
+			DELETE FROM duplicate_kept WHERE image_id = old.id OR other_id = old.id;
+		END;`,
+	)},
+	{11, "mark unoriented images", execSQL(
+		`CREATE TABLE image_unoriented (
+			image_id TEXT PRIMARY KEY
+		) WITHOUT ROWID;`,
+		`INSERT INTO image_unoriented (image_id) SELECT id FROM image;`,
+		`CREATE TRIGGER image_delete_unoriented AFTER DELETE ON image BEGIN
+			DELETE FROM image_unoriented WHERE image_id = old.id;
+		END;`,
+	)},
+}
+
+func execSQL(stmts ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, stmt := range stmts {
+			_, err := tx.Exec(stmt)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func inOrder(steps ...func(tx *sql.Tx) error) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, step := range steps {
+			err := step(tx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// LatestSchemaVersion is the version the schema will be at once all
+// migrations have been applied
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// Migrate applies any pending migrations inside a single transaction,
+// if any of them fail then none of them are applied
+func (i *ImageTable) Migrate() error {
+	tx, err := i.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("could not begin migration: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`)
+	if err != nil {
+		return fmt.Errorf("could not create schema_version table: %w", err)
+	}
+
+	current, err := schemaVersion(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		err = m.up(tx)
+		if err != nil {
+			return fmt.Errorf("could not apply migration %d %s: %w", m.version, m.name, err)
+		}
+
+		_, err = tx.Exec("INSERT INTO schema_version (version, name) VALUES (?,?);", m.version, m.name)
+		if err != nil {
+			return fmt.Errorf("could not record migration %d %s: %w", m.version, m.name, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("could not commit migrations: %w", err)
+	}
+	return nil
+}
+
+// SchemaVersion returns the version of the last migration applied
+func (i *ImageTable) SchemaVersion() (int, error) {
+	tx, err := i.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	return schemaVersion(tx)
+}
+
+func schemaVersion(tx *sql.Tx) (int, error) {
+	version := 0
+	err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version;").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("could not get schema version: %w", err)
+	}
+	return version, nil
+}
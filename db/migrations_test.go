@@ -0,0 +1,152 @@
+package db_test
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wobwainwwight/sa-photos/db"
+	"github.com/wobwainwwight/sa-photos/db/dbtest"
+)
+
+func TestMigrate(t *testing.T) {
+
+	t.Run("should create new database at latest version", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		version, err := table.SchemaVersion()
+		require.NoError(t, err)
+		assert.Equal(t, db.LatestSchemaVersion(), version)
+	})
+
+	t.Run("should be safe to run more than once", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		require.NoError(t, table.Migrate())
+		require.NoError(t, table.Migrate())
+
+		version, err := table.SchemaVersion()
+		require.NoError(t, err)
+		assert.Equal(t, db.LatestSchemaVersion(), version)
+	})
+
+	t.Run("should upgrade database created before migrations without losing rows", func(t *testing.T) {
+		dsn := "file:test-legacy-saws.sqlite"
+		defer os.Remove("test-legacy-saws.sqlite")
+
+		legacy := givenLegacyTable(t, dsn)
+		imgs := givenLegacyRows(t, legacy, 20)
+		require.NoError(t, legacy.Close())
+
+		table, err := db.NewImageTable(dsn)
+		require.NoError(t, err)
+		defer table.Close()
+
+		version, err := table.SchemaVersion()
+		require.NoError(t, err)
+		assert.Equal(t, db.LatestSchemaVersion(), version)
+
+		for _, img := range imgs {
+			fetched, err := table.GetByID(img.ID)
+			require.NoError(t, err)
+
+			assert.Equal(t, img.ID, fetched.ID)
+			assert.Equal(t, img.MimeType, fetched.MimeType)
+			assert.Equal(t, img.Width, fetched.Width)
+			assert.Equal(t, img.Height, fetched.Height)
+			assert.Equal(t, img.ThumbHash, fetched.ThumbHash)
+			assert.Equal(t, img.Country, fetched.Country)
+			assert.Equal(t, img.Locality, fetched.Locality)
+			assert.WithinDuration(t, img.CreatedAt, fetched.CreatedAt, 0)
+		}
+
+		list, err := table.GetList(db.WithLimit(100))
+		require.NoError(t, err)
+		assert.Len(t, list.Images, len(imgs))
+
+		list, err = table.GetList(db.WithLimit(100), db.WithAlbum("south-america"))
+		require.NoError(t, err)
+		assert.Len(t, list.Images, len(imgs), "existing images should be in the south america album")
+
+		unoriented, err := table.GetUnoriented()
+		require.NoError(t, err)
+		assert.Len(t, unoriented, len(imgs), "existing images should be measured again the right way up")
+
+		measured := imgs[0]
+		measured.Width, measured.Height = imgs[0].Height, imgs[0].Width
+		require.NoError(t, table.SetOriented(measured))
+		fetched, err := table.GetByID(measured.ID)
+		require.NoError(t, err)
+		assert.Equal(t, measured.Width, fetched.Width)
+		assert.Equal(t, measured.Height, fetched.Height)
+
+		require.NoError(t, table.Delete(imgs[1].ID))
+		unoriented, err = table.GetUnoriented()
+		require.NoError(t, err)
+		assert.Len(t, unoriented, len(imgs)-2)
+		assert.NotContains(t, unoriented, measured.ID)
+
+		assert.Equal(t, db.NotFound, table.SetOriented(db.Image{ID: "missing"}))
+	})
+
+	t.Run("should have no unoriented images in a new database", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		dbtest.GivenSaved(t, table, dbtest.GivenImage(t))
+		unoriented, err := table.GetUnoriented()
+		require.NoError(t, err)
+		assert.Empty(t, unoriented)
+	})
+
+}
+
+func givenLegacyTable(t *testing.T, dsn string) *db.ImageTable {
+	require.NoFileExists(t, "test-legacy-saws.sqlite")
+
+	conn, err := sql.Open("sqlite3", dsn)
+	require.NoError(t, err)
+
+	legacy := &db.ImageTable{DB: conn}
+	require.NoError(t, legacy.CreateImageTable())
+
+	_, ok, err := legacy.CheckImageTableExists()
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	return legacy
+}
+
+// givenLegacyRows inserts rows with the columns the image table had
+// before migrations were introduced
+func givenLegacyRows(t *testing.T, legacy *db.ImageTable, n int) []db.Image {
+	imgs := dbtest.SpaceByHour(make([]db.Image, n))
+	for i := range imgs {
+		createdAt := imgs[i].CreatedAt
+		imgs[i] = dbtest.GivenImage(t)
+		imgs[i].CreatedAt = createdAt.UTC().Round(0)
+		imgs[i].Locality = "Santiago"
+
+		_, err := legacy.DB.Exec(`
+			INSERT INTO image
+			(id, mime_type, width, height, thumbhash, lat, long, locality, country, created_at)
+			VALUES (?,?,?,?,?,?,?,?,?,?);`,
+			imgs[i].ID,
+			imgs[i].MimeType,
+			imgs[i].Width,
+			imgs[i].Height,
+			imgs[i].ThumbHash,
+			imgs[i].Lat,
+			imgs[i].Long,
+			imgs[i].Locality,
+			imgs[i].Country,
+			imgs[i].CreatedAt,
+		)
+		require.NoError(t, err)
+	}
+	return imgs
+}
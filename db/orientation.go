@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// GetUnoriented returns the IDs of the images saved before they were
+// turned the right way up using their EXIF orientation, including the
+// ones in the trash. Their width, height and hashes may be of the image
+// on its side.
+func (i *ImageTable) GetUnoriented() ([]string, error) {
+	return i.GetUnorientedContext(context.Background())
+}
+
+func (i *ImageTable) GetUnorientedContext(ctx context.Context) ([]string, error) {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := i.DB.QueryContext(ctx, "SELECT image_id FROM image_unoriented ORDER BY image_id;")
+	if err != nil {
+		return nil, fmt.Errorf("could not get unoriented images: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		id := ""
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan unoriented image: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not get unoriented images: %w", err)
+	}
+	return ids, nil
+}
+
+// SetOriented saves the width, height, thumbhash and dhash of an image
+// measured the right way up, the rest of img is ignored. The image is no
+// longer returned by GetUnoriented.
+func (i *ImageTable) SetOriented(img Image) error {
+	return i.SetOrientedContext(context.Background(), img)
+}
+
+func (i *ImageTable) SetOrientedContext(ctx context.Context, img Image) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := i.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin orienting image %s: %w", img.ID, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE image SET width = (?), height = (?), thumbhash = (?), dhash = (?) WHERE id = (?);",
+		img.Width, img.Height, img.ThumbHash, img.DHash, img.ID)
+	if err != nil {
+		return fmt.Errorf("could not orient image %s: %w", img.ID, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return NotFound
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM image_unoriented WHERE image_id = (?);", img.ID)
+	if err != nil {
+		return fmt.Errorf("could not orient image %s: %w", img.ID, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("could not commit orienting image %s: %w", img.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// searchIndex creates the image_search full text index over the given
+// image columns and the tags, along with the triggers that keep it in
+// sync with the image and tag tables.
+//
+// The index is FTS4 because FTS5 is only compiled into go-sqlite3 with
+// the sqlite_fts5 build tag, FTS4 handles the prefix queries built by
+// searchExpr and folds diacritics with unicode61 all the same.
+func searchIndex(columns ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		cols := strings.Join(columns, ", ")
+		newCols := "new." + strings.Join(columns, ", new.")
+
+		return execSQL(
+			`CREATE VIRTUAL TABLE image_search USING fts4(
+				image_id, `+cols+`, tags, notindexed=image_id, tokenize=unicode61 "remove_diacritics=1"
+			);`,
+			`INSERT INTO image_search (image_id, `+cols+`, tags)
+				SELECT id, `+cols+`, `+searchTags("id")+` FROM image;`,
+			`CREATE TRIGGER image_search_insert AFTER INSERT ON image BEGIN
+				INSERT INTO image_search (image_id, `+cols+`, tags)
+				VALUES (new.id, `+newCols+`, `+searchTags("new.id")+`);
+			END;`,
+			`CREATE TRIGGER image_search_update AFTER UPDATE ON image BEGIN
+				DELETE FROM image_search WHERE image_id = old.id;
+				INSERT INTO image_search (image_id, `+cols+`, tags)
+				VALUES (new.id, `+newCols+`, `+searchTags("new.id")+`);
+			END;`,
+			`CREATE TRIGGER image_search_delete AFTER DELETE ON image BEGIN
+				DELETE FROM image_search WHERE image_id = old.id;
+			END;`,
+			`CREATE TRIGGER tag_search_insert AFTER INSERT ON tag BEGIN
+				UPDATE image_search SET tags = `+searchTags("new.image_id")+` WHERE image_id = new.image_id;
+			END;`,
+			`CREATE TRIGGER tag_search_delete AFTER DELETE ON tag BEGIN
+				UPDATE image_search SET tags = `+searchTags("old.image_id")+` WHERE image_id = old.image_id;
+			END;`,
+		)(tx)
+	}
+}
+
+// dropSearchIndex removes the image_search index and its triggers so it
+// can be created again over different columns
+var dropSearchIndex = execSQL(
+	`DROP TRIGGER image_search_insert;`,
+	`DROP TRIGGER image_search_update;`,
+	`DROP TRIGGER image_search_delete;`,
+	`DROP TRIGGER tag_search_insert;`,
+	`DROP TRIGGER tag_search_delete;`,
+	`DROP TABLE image_search;`,
+)
+
+// searchTags is the tags of an image joined into one searchable string
+func searchTags(imageID string) string {
+	return fmt.Sprintf("( SELECT COALESCE(group_concat(name, ' '), '') FROM tag WHERE image_id = %s )", imageID)
+}
+
+// Search finds images by their title, caption, alt text, locality,
+// country or tags. Every word of
+// the query has to match the start of a word of the image, so "puer nat"
+// finds Puerto Natales. Results are in the same order as GetList and the
+// query is kept in the cursor for the next page.
+func (i *ImageTable) Search(query string, opts ...GetListOptsFn) (ImageList, error) {
+	return i.SearchContext(context.Background(), query, opts...)
+}
+
+func (i *ImageTable) SearchContext(ctx context.Context, query string, opts ...GetListOptsFn) (ImageList, error) {
+	return i.GetListContext(ctx, append(opts, WithQuery(query))...)
+}
+
+// WithQuery filters to images matching a search query, see Search
+func WithQuery(query string) GetListOptsFn {
+	return func(glo *GetListOpts) error {
+		glo.Query = strings.Join(searchTerms(query), " ")
+		return nil
+	}
+}
+
+// searchTerms splits a query into lowercase words, dropping anything
+// that could be read as full text query syntax
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// diacritics are the accented letters folded to plain ones when matching
+// searches outside of SQLite, in the same way as remove_diacritics
+var diacritics = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ä", "a", "ã", "a", "å", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "ö", "o", "õ", "o", "ø", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u",
+	"ñ", "n", "ç", "c", "ý", "y", "ÿ", "y",
+)
+
+// searchMatches is whether every word of the query starts a word of one
+// of the texts, which is what the MATCH of searchExpr does
+func searchMatches(query string, texts ...string) bool {
+	words := searchTerms(diacritics.Replace(strings.ToLower(strings.Join(texts, " "))))
+	for _, term := range searchTerms(query) {
+		term = diacritics.Replace(term)
+		found := slices.ContainsFunc(words, func(w string) bool {
+			return strings.HasPrefix(w, term)
+		})
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// searchExpr is the full text MATCH expression for a query, each word is
+// matched as a prefix
+func searchExpr(query string) string {
+	terms := searchTerms(query)
+	for i := range terms {
+		terms[i] = terms[i] + "*"
+	}
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,140 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wobwainwwight/sa-photos/db"
+	"github.com/wobwainwwight/sa-photos/db/dbtest"
+)
+
+func TestSearch(t *testing.T) {
+
+	givenPlace := func(t *testing.T, locality, country string) db.Image {
+		img := dbtest.GivenImage(t)
+		img.Locality = locality
+		img.Country = country
+		return img
+	}
+
+	ids := func(list db.ImageList) []string {
+		ids := []string{}
+		for _, img := range list.Images {
+			ids = append(ids, img.ID)
+		}
+		return ids
+	}
+
+	t.Run("should find images by description, place and tags", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		imgs := dbtest.GivenSaved(t, table, dbtest.SpaceByHour([]db.Image{
+			givenPlace(t, "Puerto Natales", "Chile"),
+			givenPlace(t, "Bogotá", "Colombia"),
+			givenPlace(t, "Salta", "Argentina"),
+		})...)
+		require.NoError(t, table.AddTags(imgs[2].ID, "street art"))
+
+		list, err := table.Search("chile")
+		require.NoError(t, err)
+		assert.Equal(t, []string{imgs[0].ID}, ids(list))
+
+		list, err = table.Search("puer nat")
+		require.NoError(t, err)
+		assert.Equal(t, []string{imgs[0].ID}, ids(list), "words should match as prefixes")
+
+		list, err = table.Search("bogota")
+		require.NoError(t, err)
+		assert.Equal(t, []string{imgs[1].ID}, ids(list), "accents should not matter")
+
+		list, err = table.Search("ART")
+		require.NoError(t, err)
+		assert.Equal(t, []string{imgs[2].ID}, ids(list))
+
+		imgs[1].Caption = "Ajiaco at the market"
+		require.NoError(t, table.Update(imgs[1]))
+
+		list, err = table.Search("ajiaco")
+		require.NoError(t, err)
+		assert.Equal(t, []string{imgs[1].ID}, ids(list), "captions should be searchable")
+
+		list, err = table.Search("puerto colombia")
+		require.NoError(t, err)
+		assert.Empty(t, list.Images, "every word should match")
+	})
+
+	t.Run("should not fail on query syntax", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		imgs := dbtest.GivenSaved(t, table, givenPlace(t, "Puerto Natales", "Chile"))
+
+		for _, q := range []string{`"puerto`, "puerto -natales", "natales*)", "(puerto)", "puerto^", "chile:"} {
+			list, err := table.Search(q)
+			require.NoError(t, err, q)
+			assert.Equal(t, []string{imgs[0].ID}, ids(list), q)
+		}
+	})
+
+	t.Run("should keep index in sync with images and tags", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		img := dbtest.GivenSaved(t, table, givenPlace(t, "Santiago", "Chile"))[0]
+
+		img.Locality = "Valparaíso"
+		require.NoError(t, table.Save(img))
+
+		list, err := table.Search("santiago")
+		require.NoError(t, err)
+		assert.Empty(t, list.Images)
+
+		list, err = table.Search("valparaiso")
+		require.NoError(t, err)
+		assert.Equal(t, []string{img.ID}, ids(list))
+
+		require.NoError(t, table.AddTags(img.ID, "harbour"))
+		list, err = table.Search("harbour")
+		require.NoError(t, err)
+		assert.Equal(t, []string{img.ID}, ids(list))
+
+		require.NoError(t, table.RemoveTags(img.ID, "harbour"))
+		list, err = table.Search("harbour")
+		require.NoError(t, err)
+		assert.Empty(t, list.Images)
+
+		require.NoError(t, table.Delete(img.ID))
+		list, err = table.Search("valparaiso")
+		require.NoError(t, err)
+		assert.Empty(t, list.Images)
+	})
+
+	t.Run("should page through results with cursor", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		imgs := dbtest.GivenSaved(t, table, dbtest.SpaceByHour([]db.Image{
+			givenPlace(t, "Santiago", "Chile"),
+			givenPlace(t, "Mendoza", "Argentina"),
+			givenPlace(t, "Santiago", "Chile"),
+			givenPlace(t, "Santiago", "Chile"),
+			givenPlace(t, "Salta", "Argentina"),
+			givenPlace(t, "Santiago", "Chile"),
+		})...)
+
+		found := []string{}
+		list, err := table.Search("santiago", db.WithLimit(1))
+		require.NoError(t, err)
+
+		for len(list.Images) > 0 {
+			found = append(found, ids(list)...)
+
+			list, err = table.GetList(db.WithCursorStr(list.Cursor.EncodedString()))
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, []string{imgs[0].ID, imgs[2].ID, imgs[3].ID, imgs[5].ID}, found)
+	})
+}
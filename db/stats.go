@@ -0,0 +1,282 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// earthRadiusKm is the mean radius used for distances between photos
+const earthRadiusKm = 6371.0
+
+// Stats are how the trip unfolded. Days and the first and last photos
+// in each country only count images with a created at, Undated is how
+// many are without one. Km is the distance between each geotagged photo
+// and the next in the order they were taken.
+type Stats struct {
+	Total     int            `json:"total"`
+	Undated   int            `json:"undated"`
+	Km        float64        `json:"km"`
+	Days      []DayStats     `json:"days"`
+	Countries []CountryStats `json:"countries"`
+}
+
+// DayStats are the photos taken on a day in UTC, Km is the distance to
+// each geotagged photo that day from the one before
+type DayStats struct {
+	Date  string  `json:"date"`
+	Count int     `json:"count"`
+	Km    float64 `json:"km"`
+}
+
+type CountryStats struct {
+	Country    string          `json:"country"`
+	Count      int             `json:"count"`
+	First      time.Time       `json:"first"`
+	Last       time.Time       `json:"last"`
+	Localities []LocalityStats `json:"localities"`
+}
+
+type LocalityStats struct {
+	Locality string `json:"locality"`
+	Count    int    `json:"count"`
+}
+
+// GetStats works out the Stats of the images that pass the filters of
+// the opts, days are in date order and countries and localities in name
+// order. Images without a country are counted in Total but not under a
+// country.
+func (i *ImageTable) GetStats(opts ...GetListOptsFn) (Stats, error) {
+	return i.GetStatsContext(context.Background(), opts...)
+}
+
+func (i *ImageTable) GetStatsContext(ctx context.Context, opts ...GetListOptsFn) (Stats, error) {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	opt, err := listOpts(opts)
+	if err != nil {
+		return Stats{}, err
+	}
+	w := filterWhere(opt)
+	sc := newStatsCounts()
+
+	rows, err := i.DB.QueryContext(ctx, "SELECT country, locality, COUNT(*),"+
+		" datetime(MIN(created_at) FILTER (WHERE "+isDated+")),"+
+		" datetime(MAX(created_at) FILTER (WHERE "+isDated+"))"+
+		" FROM image"+w.String()+" GROUP BY country, locality;", w.args...)
+	if err != nil {
+		return Stats{}, fmt.Errorf("could not get country stats: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		country, locality, n := "", "", 0
+		var first, last *string
+		err = rows.Scan(&country, &locality, &n, &first, &last)
+		if err != nil {
+			return Stats{}, fmt.Errorf("could not scan country stats: %w", err)
+		}
+		firstAt, err := parseDateTime(first)
+		if err != nil {
+			return Stats{}, err
+		}
+		lastAt, err := parseDateTime(last)
+		if err != nil {
+			return Stats{}, err
+		}
+		sc.addPlace(country, locality, n, firstAt, lastAt)
+	}
+	if err = rows.Err(); err != nil {
+		return Stats{}, fmt.Errorf("could not get country stats: %w", err)
+	}
+
+	dw := filterWhere(opt)
+	dw.add(isDated)
+	dayRows, err := i.DB.QueryContext(ctx, "SELECT date(created_at), COUNT(*) FROM image"+dw.String()+
+		" GROUP BY date(created_at);", dw.args...)
+	if err != nil {
+		return Stats{}, fmt.Errorf("could not get day stats: %w", err)
+	}
+	defer dayRows.Close()
+
+	for dayRows.Next() {
+		date, n := "", 0
+		err = dayRows.Scan(&date, &n)
+		if err != nil {
+			return Stats{}, fmt.Errorf("could not scan day stats: %w", err)
+		}
+		sc.addDay(date, n)
+	}
+	if err = dayRows.Err(); err != nil {
+		return Stats{}, fmt.Errorf("could not get day stats: %w", err)
+	}
+
+	lw := filterWhere(opt)
+	lw.add(isDated)
+	lw.add(hasLocation(""))
+	legRows, err := i.DB.QueryContext(ctx, "SELECT date(created_at), lat, long FROM image"+lw.String()+
+		" ORDER BY created_at, id;", lw.args...)
+	if err != nil {
+		return Stats{}, fmt.Errorf("could not get distance stats: %w", err)
+	}
+	defer legRows.Close()
+
+	for legRows.Next() {
+		date, lat, long := "", 0.0, 0.0
+		err = legRows.Scan(&date, &lat, &long)
+		if err != nil {
+			return Stats{}, fmt.Errorf("could not scan distance stats: %w", err)
+		}
+		sc.addStop(date, lat, long)
+	}
+	if err = legRows.Err(); err != nil {
+		return Stats{}, fmt.Errorf("could not get distance stats: %w", err)
+	}
+
+	return sc.stats(), nil
+}
+
+// isDated is the condition for an image having a created at, images
+// without EXIF are saved with the Unix epoch, older ones with the zero time
+const isDated = "datetime(created_at) > '0001-01-01 00:00:00' AND datetime(created_at) != '1970-01-01 00:00:00'"
+
+// undatedAt is when images without EXIF are saved as taken
+var undatedAt = time.Unix(0, 0).UTC()
+
+func parseDateTime(s *string) (time.Time, error) {
+	if s == nil {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.DateTime, *s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not parse stats time %q: %w", *s, err)
+	}
+	return t, nil
+}
+
+// imageIsDated does the same as isDated for images that aren't in SQLite
+func imageIsDated(img Image) bool {
+	createdAt := dateTime(img.CreatedAt)
+	return createdAt.After(time.Time{}) && !createdAt.Equal(undatedAt)
+}
+
+// statsCounts builds Stats from counts by place and day and the
+// geotagged photos in the order they were taken
+type statsCounts struct {
+	total      int
+	km         float64
+	places     map[string]*CountryStats
+	localities map[string]map[string]int
+	days       map[string]*DayStats
+	stopped    bool
+	lastStop   [2]float64
+}
+
+func newStatsCounts() *statsCounts {
+	return &statsCounts{
+		places:     map[string]*CountryStats{},
+		localities: map[string]map[string]int{},
+		days:       map[string]*DayStats{},
+	}
+}
+
+// addPlace counts n images in the locality, first and last are the
+// earliest and latest created at of those that are dated
+func (sc *statsCounts) addPlace(country, locality string, n int, first, last time.Time) {
+	sc.total += n
+	if country == "" {
+		return
+	}
+
+	cs, ok := sc.places[country]
+	if !ok {
+		cs = &CountryStats{Country: country}
+		sc.places[country] = cs
+	}
+	cs.Count += n
+	if !first.IsZero() && (cs.First.IsZero() || first.Before(cs.First)) {
+		cs.First = first
+	}
+	if last.After(cs.Last) {
+		cs.Last = last
+	}
+	if locality != "" {
+		if sc.localities[country] == nil {
+			sc.localities[country] = map[string]int{}
+		}
+		sc.localities[country][locality] += n
+	}
+}
+
+func (sc *statsCounts) addDay(date string, n int) {
+	sc.day(date).Count += n
+}
+
+func (sc *statsCounts) day(date string) *DayStats {
+	ds, ok := sc.days[date]
+	if !ok {
+		ds = &DayStats{Date: date}
+		sc.days[date] = ds
+	}
+	return ds
+}
+
+// addStop adds the distance from the last geotagged photo to this one,
+// stops have to be added in the order the photos were taken
+func (sc *statsCounts) addStop(date string, lat, long float64) {
+	if sc.stopped {
+		km := haversineKm(sc.lastStop[0], sc.lastStop[1], lat, long)
+		sc.km += km
+		sc.day(date).Km += km
+	}
+	sc.stopped = true
+	sc.lastStop = [2]float64{lat, long}
+}
+
+func (sc *statsCounts) stats() Stats {
+	s := Stats{
+		Total:     sc.total,
+		Undated:   sc.total,
+		Km:        sc.km,
+		Days:      []DayStats{},
+		Countries: []CountryStats{},
+	}
+	for _, ds := range sc.days {
+		s.Days = append(s.Days, *ds)
+		s.Undated -= ds.Count
+	}
+	slices.SortFunc(s.Days, func(a, b DayStats) int {
+		return strings.Compare(a.Date, b.Date)
+	})
+
+	for country, cs := range sc.places {
+		c := *cs
+		c.Localities = []LocalityStats{}
+		for locality, n := range sc.localities[country] {
+			c.Localities = append(c.Localities, LocalityStats{Locality: locality, Count: n})
+		}
+		slices.SortFunc(c.Localities, func(a, b LocalityStats) int {
+			return strings.Compare(a.Locality, b.Locality)
+		})
+		s.Countries = append(s.Countries, c)
+	}
+	slices.SortFunc(s.Countries, func(a, b CountryStats) int {
+		return strings.Compare(a.Country, b.Country)
+	})
+	return s
+}
+
+// haversineKm is the distance over the surface of the earth between two
+// lats and longs
+func haversineKm(lat1, long1, lat2, long2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLong := (long2 - long1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLong/2)*math.Sin(dLong/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
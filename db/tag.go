@@ -0,0 +1,219 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var InvalidTag = errors.New("tags must not be blank or contain commas")
+
+// NormaliseTag trims and lowercases a tag and collapses any whitespace
+// inside it, so that "Street Art " and "street  art" are the same tag
+func NormaliseTag(tag string) (string, error) {
+	tag = strings.Join(strings.Fields(strings.ToLower(tag)), " ")
+	if len(tag) == 0 || strings.ContainsRune(tag, arrSep) {
+		return "", InvalidTag
+	}
+	return tag, nil
+}
+
+func normaliseTags(tags []string) ([]string, error) {
+	normalised := make([]string, len(tags))
+	for i, t := range tags {
+		n, err := NormaliseTag(t)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", err, t)
+		}
+		normalised[i] = n
+	}
+	return uniqueStrings(normalised), nil
+}
+
+// AddTags tags an image, tags the image already has are left as they are
+func (i *ImageTable) AddTags(id string, tags ...string) error {
+	return i.AddTagsContext(context.Background(), id, tags...)
+}
+
+func (i *ImageTable) AddTagsContext(ctx context.Context, id string, tags ...string) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	tags, err := normaliseTags(tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = i.GetByIDContext(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	tx, err := i.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin adding tags to %s: %w", id, err)
+	}
+	defer tx.Rollback()
+
+	for _, t := range tags {
+		_, err = tx.ExecContext(ctx, "INSERT OR IGNORE INTO tag (image_id, name) VALUES (?,?);", id, t)
+		if err != nil {
+			return fmt.Errorf("could not add tag %s to %s: %w", t, id, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (i *ImageTable) RemoveTags(id string, tags ...string) error {
+	return i.RemoveTagsContext(context.Background(), id, tags...)
+}
+
+func (i *ImageTable) RemoveTagsContext(ctx context.Context, id string, tags ...string) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	tags, err := normaliseTags(tags)
+	if err != nil {
+		return err
+	}
+
+	tx, err := i.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin removing tags from %s: %w", id, err)
+	}
+	defer tx.Rollback()
+
+	for _, t := range tags {
+		_, err = tx.ExecContext(ctx, "DELETE FROM tag WHERE image_id = (?) AND name = (?);", id, t)
+		if err != nil {
+			return fmt.Errorf("could not remove tag %s from %s: %w", t, id, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SetTags replaces all of an image's tags, no tags removes them all
+func (i *ImageTable) SetTags(id string, tags ...string) error {
+	return i.SetTagsContext(context.Background(), id, tags...)
+}
+
+func (i *ImageTable) SetTagsContext(ctx context.Context, id string, tags ...string) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	tags, err := normaliseTags(tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = i.GetByIDContext(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	tx, err := i.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin setting tags of %s: %w", id, err)
+	}
+	defer tx.Rollback()
+
+	err = replaceTags(ctx, tx, id, tags)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateWithTags updates an image and replaces all of its tags together,
+// if either fails neither are changed
+func (i *ImageTable) UpdateWithTags(img Image, tags ...string) error {
+	return i.UpdateWithTagsContext(context.Background(), img, tags...)
+}
+
+func (i *ImageTable) UpdateWithTagsContext(ctx context.Context, img Image, tags ...string) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	tags, err := normaliseTags(tags)
+	if err != nil {
+		return err
+	}
+
+	tx, err := i.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin updating %s: %w", img.ID, err)
+	}
+	defer tx.Rollback()
+
+	err = updateImage(ctx, tx, img)
+	if err != nil {
+		return err
+	}
+
+	err = replaceTags(ctx, tx, img.ID, tags)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceTags(ctx context.Context, tx *sql.Tx, id string, tags []string) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM tag WHERE image_id = (?);", id)
+	if err != nil {
+		return fmt.Errorf("could not clear tags of %s: %w", id, err)
+	}
+
+	for _, t := range tags {
+		_, err = tx.ExecContext(ctx, "INSERT INTO tag (image_id, name) VALUES (?,?);", id, t)
+		if err != nil {
+			return fmt.Errorf("could not add tag %s to %s: %w", t, id, err)
+		}
+	}
+	return nil
+}
+
+// GetTags returns every tag in use, sorted by name
+func (i *ImageTable) GetTags() ([]string, error) {
+	return i.GetTagsContext(context.Background())
+}
+
+func (i *ImageTable) GetTagsContext(ctx context.Context) ([]string, error) {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := i.DB.QueryContext(ctx, `SELECT DISTINCT name FROM tag
+		WHERE image_id IN ( SELECT id FROM image WHERE deleted_at IS NULL )
+		ORDER BY name;`)
+	if err != nil {
+		return nil, fmt.Errorf("could not get tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		t := ""
+		err = rows.Scan(&t)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan tag: %w", err)
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+func uniqueStrings(ss []string) []string {
+	unique := make([]string, 0, len(ss))
+	for _, s := range ss {
+		if !slices.Contains(unique, s) {
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,184 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wobwainwwight/sa-photos/db"
+	"github.com/wobwainwwight/sa-photos/db/dbtest"
+)
+
+func TestTags(t *testing.T) {
+
+	t.Run("should add and remove tags", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		img := dbtest.GivenSaved(t, table, dbtest.GivenImage(t))[0]
+
+		require.NoError(t, table.AddTags(img.ID, "Street Art", "  food ", "street  art"))
+
+		fetched, err := table.GetByID(img.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"food", "street art"}, fetched.Tags)
+
+		require.NoError(t, table.RemoveTags(img.ID, "STREET ART", "not-there"))
+
+		fetched, err = table.GetByID(img.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"food"}, fetched.Tags)
+	})
+
+	t.Run("should replace tags", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		img := dbtest.GivenSaved(t, table, dbtest.GivenImage(t))[0]
+		require.NoError(t, table.AddTags(img.ID, "food", "market"))
+
+		require.NoError(t, table.SetTags(img.ID, "Market", "beach"))
+
+		fetched, err := table.GetByID(img.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"beach", "market"}, fetched.Tags)
+
+		require.NoError(t, table.SetTags(img.ID))
+
+		fetched, err = table.GetByID(img.ID)
+		require.NoError(t, err)
+		assert.Nil(t, fetched.Tags)
+
+		assert.Equal(t, db.NotFound, table.SetTags("not-here", "food"))
+	})
+
+	t.Run("should update an image and its tags together", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		img := dbtest.GivenSaved(t, table, dbtest.GivenImage(t))[0]
+		require.NoError(t, table.AddTags(img.ID, "food"))
+
+		img.Title = "Market"
+		require.NoError(t, table.UpdateWithTags(img, "Market", "food"))
+
+		fetched, err := table.GetByID(img.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Market", fetched.Title)
+		assert.Equal(t, []string{"food", "market"}, fetched.Tags)
+
+		// tags that can't be saved leave the image as it was
+		_, err = table.DB.Exec(`CREATE TRIGGER fail_tag BEFORE INSERT ON tag WHEN NEW.name = 'boom'
+			BEGIN SELECT RAISE(ABORT, 'boom'); END;`)
+		require.NoError(t, err)
+
+		img.Title = "Beach"
+		assert.Error(t, table.UpdateWithTags(img, "beach", "boom"))
+		assert.ErrorIs(t, table.UpdateWithTags(img, "a,b"), db.InvalidTag)
+
+		fetched, err = table.GetByID(img.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Market", fetched.Title)
+		assert.Equal(t, []string{"food", "market"}, fetched.Tags)
+
+		img.ID = "not-here"
+		assert.Equal(t, db.NotFound, table.UpdateWithTags(img, "food"))
+	})
+
+	t.Run("should not add invalid tags", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		img := dbtest.GivenSaved(t, table, dbtest.GivenImage(t))[0]
+
+		assert.ErrorIs(t, table.AddTags(img.ID, "  "), db.InvalidTag)
+		assert.ErrorIs(t, table.AddTags(img.ID, "food,drink"), db.InvalidTag)
+		assert.Equal(t, db.NotFound, table.AddTags("not-here", "food"))
+	})
+
+	t.Run("should get all tags sorted", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		imgs := dbtest.GivenSaved(t, table, dbtest.GivenImage(t), dbtest.GivenImage(t))
+		require.NoError(t, table.AddTags(imgs[0].ID, "mountains", "food"))
+		require.NoError(t, table.AddTags(imgs[1].ID, "food", "beach"))
+
+		tags, err := table.GetTags()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"beach", "food", "mountains"}, tags)
+	})
+
+	t.Run("should remove tags when image is deleted", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		img := dbtest.GivenSaved(t, table, dbtest.GivenImage(t))[0]
+		require.NoError(t, table.AddTags(img.ID, "food"))
+		require.NoError(t, table.Delete(img.ID))
+
+		tags, err := table.GetTags()
+		require.NoError(t, err)
+		assert.Empty(t, tags)
+	})
+
+	t.Run("should filter by tags with cursor", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		imgs := dbtest.GivenSaved(t, table, dbtest.SpaceByHour([]db.Image{
+			dbtest.GivenImage(t),
+			dbtest.GivenImage(t),
+			dbtest.GivenImage(t),
+			dbtest.GivenImage(t),
+			dbtest.GivenImage(t),
+			dbtest.GivenImage(t),
+		})...)
+
+		givenTags(t, table, imgs[0], "food")
+		givenTags(t, table, imgs[1], "food", "market")
+		givenTags(t, table, imgs[2], "mountains")
+		givenTags(t, table, imgs[3], "market")
+		givenTags(t, table, imgs[4], "food", "market", "mountains")
+
+		tests := []struct {
+			Name            string
+			Match           db.TagMatch
+			Tags            []string
+			ExpectedIndexes []int
+		}{
+			{"single tag", db.MatchAnyTag, []string{"food"}, []int{0, 1, 4}},
+			{"any tag", db.MatchAnyTag, []string{"food", "mountains"}, []int{0, 1, 2, 4}},
+			{"all tags", db.MatchAllTags, []string{"food", "market"}, []int{1, 4}},
+			{"all tags needs every tag", db.MatchAllTags, []string{"food", "market", "mountains"}, []int{4}},
+			{"all tags ignores duplicates", db.MatchAllTags, []string{"food", "Food"}, []int{0, 1, 4}},
+			{"tag nobody has", db.MatchAnyTag, []string{"beach"}, []int{}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.Name, func(t *testing.T) {
+				ids := []string{}
+
+				list, err := table.GetList(db.WithTags(tt.Match, tt.Tags...), db.WithLimit(1))
+				require.NoError(t, err)
+				for len(list.Images) > 0 {
+					ids = append(ids, list.Images[0].ID)
+
+					list, err = table.GetList(db.WithCursorStr(list.Cursor.EncodedString()))
+					require.NoError(t, err)
+				}
+
+				expected := []string{}
+				for _, i := range tt.ExpectedIndexes {
+					expected = append(expected, imgs[i].ID)
+				}
+				assert.Equal(t, expected, ids)
+			})
+		}
+	})
+
+}
+
+func givenTags(t *testing.T, table dbtest.TestTable, img db.Image, tags ...string) {
+	require.NoError(t, table.AddTags(img.ID, tags...))
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Trash moves an image to the trash. Trashed images are left out of
+// lists and lookups until they are restored or purged.
+func (i *ImageTable) Trash(id string) error {
+	return i.TrashContext(context.Background(), id)
+}
+
+func (i *ImageTable) TrashContext(ctx context.Context, id string) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	res, err := i.DB.ExecContext(ctx, "UPDATE image SET deleted_at = (?) WHERE id = (?) AND deleted_at IS NULL;", time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("could not trash image %s: %w", id, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return NotFound
+	}
+	return nil
+}
+
+// Restore takes an image back out of the trash
+func (i *ImageTable) Restore(id string) error {
+	return i.RestoreContext(context.Background(), id)
+}
+
+func (i *ImageTable) RestoreContext(ctx context.Context, id string) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	res, err := i.DB.ExecContext(ctx, "UPDATE image SET deleted_at = NULL WHERE id = (?) AND deleted_at IS NOT NULL;", id)
+	if err != nil {
+		return fmt.Errorf("could not restore image %s: %w", id, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return NotFound
+	}
+	return nil
+}
+
+// Purge deletes an image that was trashed before the given time for good.
+// Images that have been restored or trashed since return NotFound, so a
+// restore between listing and purging the trash keeps the image.
+func (i *ImageTable) Purge(id string, before time.Time) error {
+	return i.PurgeContext(context.Background(), id, before)
+}
+
+func (i *ImageTable) PurgeContext(ctx context.Context, id string, before time.Time) error {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	res, err := i.DB.ExecContext(ctx,
+		"DELETE FROM image WHERE id = (?) AND deleted_at IS NOT NULL AND datetime(deleted_at) < datetime(?);",
+		id, before.UTC().Format(time.DateTime))
+	if err != nil {
+		return fmt.Errorf("could not purge image %s: %w", id, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return NotFound
+	}
+	return nil
+}
+
+// GetTrash returns the images in the trash, most recently trashed first
+func (i *ImageTable) GetTrash() ([]Image, error) {
+	return i.GetTrashContext(context.Background())
+}
+
+func (i *ImageTable) GetTrashContext(ctx context.Context) ([]Image, error) {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	return i.getTrash(ctx, "")
+}
+
+// GetTrashedBefore returns the images that were trashed before the given
+// time, these are the ones due to be purged
+func (i *ImageTable) GetTrashedBefore(before time.Time) ([]Image, error) {
+	return i.GetTrashedBeforeContext(context.Background(), before)
+}
+
+func (i *ImageTable) GetTrashedBeforeContext(ctx context.Context, before time.Time) ([]Image, error) {
+	ctx, cancel := i.withTimeout(ctx)
+	defer cancel()
+
+	return i.getTrash(ctx, "AND datetime(deleted_at) < datetime(?)", before.UTC().Format(time.DateTime))
+}
+
+func (i *ImageTable) getTrash(ctx context.Context, cond string, args ...any) ([]Image, error) {
+	rows, err := i.DB.QueryContext(ctx, "SELECT "+imageColumns+" FROM image WHERE deleted_at IS NOT NULL "+cond+
+		" ORDER BY deleted_at DESC, id ASC;", args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not get trash: %w", err)
+	}
+	defer rows.Close()
+
+	imgs := []Image{}
+	for rows.Next() {
+		img, err := i.scanImageRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		imgs = append(imgs, img)
+	}
+	return imgs, rows.Err()
+}
@@ -0,0 +1,94 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wobwainwwight/sa-photos/db"
+	"github.com/wobwainwwight/sa-photos/db/dbtest"
+)
+
+func TestTrash(t *testing.T) {
+
+	t.Run("should hide trashed images until restored", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		imgs := dbtest.SpaceByHour([]db.Image{
+			givenImageInLocale(t, "Chile", "Puerto Natales"),
+			givenImageInLocale(t, "Argentina", "Mendoza"),
+		})
+		dbtest.GivenSaved(t, table, imgs...)
+		givenTags(t, table, imgs[0], "mountains")
+
+		require.NoError(t, table.Trash(imgs[0].ID))
+
+		_, err := table.GetByID(imgs[0].ID)
+		assert.Equal(t, db.NotFound, err)
+
+		list, err := table.GetList(db.WithLimit(10))
+		require.NoError(t, err)
+		require.Len(t, list.Images, 1)
+		assert.Equal(t, imgs[1].ID, list.Images[0].ID)
+
+		localities, err := table.GetLocalities()
+		require.NoError(t, err)
+		assert.Equal(t, []db.Locality{{Country: "Argentina", Localities: []string{"Mendoza"}}}, localities)
+
+		tags, err := table.GetTags()
+		require.NoError(t, err)
+		assert.Empty(t, tags)
+
+		trash, err := table.GetTrash()
+		require.NoError(t, err)
+		require.Len(t, trash, 1)
+		assert.Equal(t, imgs[0].ID, trash[0].ID)
+		require.NotNil(t, trash[0].DeletedAt)
+		assert.WithinDuration(t, time.Now(), *trash[0].DeletedAt, time.Minute)
+
+		require.NoError(t, table.Restore(imgs[0].ID))
+
+		restored, err := table.GetByID(imgs[0].ID)
+		require.NoError(t, err)
+		assert.Nil(t, restored.DeletedAt)
+		assert.Equal(t, []string{"mountains"}, restored.Tags)
+
+		trash, err = table.GetTrash()
+		require.NoError(t, err)
+		assert.Empty(t, trash)
+	})
+
+	t.Run("should only trash and restore images once", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		img := dbtest.GivenSaved(t, table, dbtest.GivenImage(t))[0]
+
+		assert.Equal(t, db.NotFound, table.Restore(img.ID))
+		require.NoError(t, table.Trash(img.ID))
+		assert.Equal(t, db.NotFound, table.Trash(img.ID))
+		assert.Equal(t, db.NotFound, table.Trash("not-here"))
+
+		img.Title = "changed"
+		assert.Equal(t, db.NotFound, table.Update(img), "trashed images should not be updated")
+	})
+
+	t.Run("should get images trashed before a time", func(t *testing.T) {
+		table := dbtest.NewTestTable(t)
+		defer table.Close()
+
+		imgs := dbtest.GivenSaved(t, table, dbtest.GivenImage(t), dbtest.GivenImage(t))
+		require.NoError(t, table.Trash(imgs[0].ID))
+
+		trashed, err := table.GetTrashedBefore(time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		require.Len(t, trashed, 1)
+		assert.Equal(t, imgs[0].ID, trashed[0].ID)
+
+		trashed, err = table.GetTrashedBefore(time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Empty(t, trashed)
+	})
+}
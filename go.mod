@@ -1,23 +1,29 @@
 module github.com/wobwainwwight/sa-photos
 
-go 1.22
+go 1.22.0
 
 require (
 	github.com/galdor/go-thumbhash v1.0.1-0.20240227061205-5f40e920ff45
+	github.com/gen2brain/avif v0.4.2
+	github.com/gen2brain/heic v0.3.1
+	github.com/gen2brain/webp v0.5.2
 	github.com/google/go-cmp v0.6.0
 	github.com/matoous/go-nanoid/v2 v2.0.0
 	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/rwcarlsen/goexif v0.0.0-20190401172101-9e8deecbddbd
 	github.com/stretchr/testify v1.9.0
+	golang.org/x/image v0.14.0
 	googlemaps.github.io/maps v1.7.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/ebitengine/purego v0.8.1 // indirect
 	github.com/google/uuid v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/tetratelabs/wazero v1.9.0 // indirect
 	go.opencensus.io v0.22.3 // indirect
-	golang.org/x/image v0.14.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
 	golang.org/x/time v0.0.0-20200416051211-89c76fbcd5d1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,72 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+)
+
+// dHashSamples is how many pixels are averaged across and down each cell
+// of a DHash, big photos are sampled rather than read pixel by pixel
+const dHashSamples = 8
+
+// DHash is a perceptual hash of the image as 16 hex characters. The image
+// is shrunk to 9x8 in greyscale and each bit is whether a cell is
+// brighter than the one to its right, so resizing or re-encoding a photo
+// only flips a few bits. Hashes are compared by how many bits differ.
+func DHash(img image.Image) string {
+	b := img.Bounds()
+	var cells [8][9]float64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 9; x++ {
+			cells[y][x] = meanLuma(img,
+				b.Min.X+x*b.Dx()/9, b.Min.Y+y*b.Dy()/8,
+				b.Min.X+(x+1)*b.Dx()/9, b.Min.Y+(y+1)*b.Dy()/8,
+			)
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if cells[y][x] > cells[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return fmt.Sprintf("%016x", hash)
+}
+
+// DHashFile is the DHash of an image file the right way up, the same as
+// Save gives it
+func DHashFile(file []byte) (string, error) {
+	img, imgType, err := image.Decode(bytes.NewReader(file))
+	if err != nil {
+		return "", fmt.Errorf("could not decode image for dhash: %w", err)
+	}
+	return DHash(orient(img, fileOrientation(file, imgType))), nil
+}
+
+// meanLuma is the mean brightness of the pixels sampled from the
+// rectangle from x0, y0 to x1, y1
+func meanLuma(img image.Image, x0, y0, x1, y1 int) float64 {
+	if x1 <= x0 {
+		x1 = x0 + 1
+	}
+	if y1 <= y0 {
+		y1 = y0 + 1
+	}
+
+	sum, n := 0.0, 0
+	for sy := 0; sy < dHashSamples; sy++ {
+		y := y0 + sy*(y1-y0)/dHashSamples
+		for sx := 0; sx < dHashSamples; sx++ {
+			x := x0 + sx*(x1-x0)/dHashSamples
+			r, g, b, _ := img.At(x, y).RGBA()
+			sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			n++
+		}
+	}
+	return sum / float64(n)
+}
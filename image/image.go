@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"image"
+	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
@@ -16,13 +17,32 @@ import (
 	"time"
 
 	"github.com/galdor/go-thumbhash"
+	"github.com/gen2brain/heic"
+	_ "github.com/gen2brain/webp"
 	"github.com/rwcarlsen/goexif/exif"
 	"github.com/rwcarlsen/goexif/tiff"
 )
 
+// Formats images can be uploaded as on top of the ones renditions can be
+// encoded as. HEIC is what iPhones take photos in, browsers other than
+// Safari can't show it so it's only ever served as a rendition.
+const (
+	HEIC = "heic"
+	GIF  = "gif"
+)
+
+func init() {
+	// heic registers itself for the heic brand, iPhones also use heix for
+	// 10 bit photos and some cameras only give the general HEIF brand
+	for _, brand := range []string{"heix", "mif1", "msf1"} {
+		image.RegisterFormat(HEIC, "????ftyp"+brand, heic.Decode, heic.DecodeConfig)
+	}
+}
+
 type FileStore interface {
 	Save(file io.Reader) (Image, error)
 	ReadFile(id string) ([]byte, error)
+	ReadRendition(id string, o Original, r Rendition) ([]byte, string, error)
 	Delete(id string) error
 }
 
@@ -50,9 +70,11 @@ type Image struct {
 	Width     int
 	Height    int
 	ThumbHash string
-	Created   time.Time
-	Lat       float64
-	Long      float64
+	// DHash is a perceptual hash for finding near duplicates, see DHash
+	DHash   string
+	Created time.Time
+	Lat     float64
+	Long    float64
 }
 
 func (s FileStoreImpl) Save(file io.Reader) (Image, error) {
@@ -73,15 +95,16 @@ func (s FileStoreImpl) Save(file io.Reader) (Image, error) {
 		return Image{}, fmt.Errorf("could not save image file: %w", err)
 	}
 
+	// the width, height and hashes are of the image the right way up
+	img = orient(img, fileOrientation(fileBuf.Bytes(), imgType))
+
 	var ed exifData
-	var exifErr error
-	if imgType == "jpeg" {
-		exifBuf := bytes.NewBuffer(fileBuf.Bytes())
-		ed, exifErr = getExifData(exifBuf)
+	exifBytes, exifErr := findExif(fileBuf.Bytes(), imgType)
+	if exifErr == nil && exifBytes != nil {
+		ed, exifErr = getExifData(bytes.NewReader(exifBytes))
 	}
 
-	thumbhash := thumbhash.EncodeImage(img)
-	thumbhashStr := base64.StdEncoding.EncodeToString(thumbhash)
+	measured := measure(img)
 
 	id := fmt.Sprintf("%x", h.Sum(nil))[:12]
 
@@ -108,15 +131,36 @@ func (s FileStoreImpl) Save(file io.Reader) (Image, error) {
 		ID:        id,
 		FileName:  fileName,
 		MimeType:  "image/" + imgType,
-		Width:     img.Bounds().Dx(),
-		Height:    img.Bounds().Dy(),
+		Width:     measured.Width,
+		Height:    measured.Height,
 		Created:   ed.dateCreated,
-		ThumbHash: thumbhashStr,
+		ThumbHash: measured.ThumbHash,
+		DHash:     measured.DHash,
 		Lat:       ed.lat,
 		Long:      ed.long,
 	}, nil
 }
 
+// MeasureFile is the width, height, thumbhash and dhash of an image file
+// the right way up, the same as Save gives them. The rest of the Image is
+// left empty.
+func MeasureFile(file []byte) (Image, error) {
+	img, imgType, err := image.Decode(bytes.NewReader(file))
+	if err != nil {
+		return Image{}, fmt.Errorf("could not decode image to measure: %w", err)
+	}
+	return measure(orient(img, fileOrientation(file, imgType))), nil
+}
+
+func measure(img image.Image) Image {
+	return Image{
+		Width:     img.Bounds().Dx(),
+		Height:    img.Bounds().Dy(),
+		ThumbHash: base64.StdEncoding.EncodeToString(thumbhash.EncodeImage(img)),
+		DHash:     DHash(img),
+	}
+}
+
 type exifData struct {
 	dateCreated time.Time
 	lat         float64
@@ -160,13 +204,18 @@ func (s FileStoreImpl) Delete(id string) error {
 	}
 
 	if !ok {
-		return fmt.Errorf("could not find image file with id %s", id)
+		return notFoundError{id}
 	}
 
 	err = os.Remove(filepath.Join(s.dir, filename))
 	if err != nil {
 		return fmt.Errorf("could not remove %s: %w", filename, err)
 	}
+
+	err = s.deleteRenditions(id)
+	if err != nil {
+		return fmt.Errorf("could not remove renditions of %s: %w", id, err)
+	}
 	return nil
 }
 
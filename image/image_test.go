@@ -2,16 +2,26 @@ package image_test
 
 import (
 	"bytes"
-	_ "image/jpeg"
-	_ "image/png"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	goimage "image"
+	"image/jpeg"
+	"image/png"
 	"io"
 	"io/fs"
 	"math"
+	"math/bits"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/galdor/go-thumbhash"
+	"github.com/gen2brain/webp"
+	"github.com/rwcarlsen/goexif/exif"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/wobwainwwight/sa-photos/image"
@@ -59,6 +69,66 @@ func TestImageStore(t *testing.T) {
 		assert.Equal(t, 333, img.Height)
 	})
 
+	t.Run("should turn rotated photos the right way up", func(t *testing.T) {
+		fish := checker.testFileSaved(t, store, imagetest.FishJPEG(), "6a14a3595a01.jpeg")
+
+		for orientation, f := range imagetest.RotatedFishJPEGs() {
+			file, err := io.ReadAll(f)
+			require.NoError(t, err)
+			img, err := store.Save(bytes.NewReader(file))
+			require.NoError(t, err)
+			assert.Equal(t, fish.Width, img.Width, orientation)
+			assert.Equal(t, fish.Height, img.Height, orientation)
+
+			measured, err := image.MeasureFile(file)
+			require.NoError(t, err)
+			assert.Equal(t, image.Image{Width: img.Width, Height: img.Height, ThumbHash: img.ThumbHash, DHash: img.DHash}, measured, orientation)
+
+			assert.LessOrEqual(t, dhashDistance(t, fish.DHash, img.DHash), 4, orientation)
+
+			// thumbhashes differ a little as the jpegs were encoded again
+			fishThumb, thumb := decodeThumbHash(t, fish.ThumbHash), decodeThumbHash(t, img.ThumbHash)
+			assert.Equal(t, fishThumb.Bounds(), thumb.Bounds(), orientation)
+			assert.LessOrEqual(t, dhashDistance(t, image.DHash(fishThumb), image.DHash(thumb)), 4, orientation)
+
+			require.NoError(t, store.Delete(img.ID))
+		}
+	})
+
+	t.Run("should save heic and webp with their exif", func(t *testing.T) {
+		dogs := checker.testFileSaved(t, store, imagetest.DogsJPEG(), "046de7b98dc4.jpeg")
+
+		saved := map[string]image.Image{
+			"image/heic": checker.testFileSaved(t, store, imagetest.DogsHEIC(), "88e8c5781b27.heic"),
+			"image/webp": checker.testFileSaved(t, store, imagetest.DogsWebP(), "7030a3a31f42.webp"),
+		}
+		for mimeType, img := range saved {
+			assert.Equal(t, mimeType, img.MimeType)
+			assert.Equal(t, 400, img.Width, mimeType)
+			assert.Equal(t, 533, img.Height, mimeType)
+			assert.NotEmpty(t, img.ThumbHash, mimeType)
+			assert.Len(t, img.DHash, 16, mimeType)
+			assert.Equal(t, dogs.Created, img.Created, mimeType)
+			assert.Equal(t, -51.730347, roundFloat(img.Lat, 6), mimeType)
+			assert.Equal(t, -72.489717, roundFloat(img.Long, 6), mimeType)
+		}
+	})
+
+	t.Run("should save gif", func(t *testing.T) {
+		img := checker.testFileSaved(t, store, imagetest.FishGIF(), "d5d32a4a6e5a.gif")
+		assert.Equal(t, "image/gif", img.MimeType)
+		assert.Equal(t, 160, img.Width)
+		assert.Equal(t, 80, img.Height)
+		assert.NotEmpty(t, img.ThumbHash)
+	})
+}
+
+func decodeThumbHash(t *testing.T, hash string) goimage.Image {
+	b, err := base64.StdEncoding.DecodeString(hash)
+	require.NoError(t, err)
+	img, err := thumbhash.DecodeImage(b)
+	require.NoError(t, err)
+	return img
 }
 
 func roundFloat(val float64, precision int) float64 {
@@ -81,6 +151,196 @@ func TestResize(t *testing.T) {
 
 }
 
+func TestRenditions(t *testing.T) {
+	dir := t.TempDir()
+	store, err := image.NewImageFileStore(dir)
+	require.NoError(t, err)
+
+	original, err := io.ReadAll(imagetest.NYJPEG())
+	require.NoError(t, err)
+	img, err := store.Save(bytes.NewReader(original))
+	require.NoError(t, err)
+	orig := image.Original{Format: image.JPEG, Width: img.Width}
+
+	t.Run("should resize to the width and cache it", func(t *testing.T) {
+		b, mimeType, err := store.ReadRendition(img.ID, orig, image.Rendition{Width: 480})
+		require.NoError(t, err)
+		assert.Equal(t, "image/jpeg", mimeType)
+
+		cfg, format, err := goimage.DecodeConfig(bytes.NewReader(b))
+		require.NoError(t, err)
+		assert.Equal(t, "jpeg", format)
+		assert.Equal(t, 480, cfg.Width)
+		assert.Equal(t, 318, cfg.Height)
+		assert.Less(t, len(b), len(original))
+
+		cached := filepath.Join(dir, image.RenditionDir, img.ID+"-480-v2.jpeg")
+		require.FileExists(t, cached)
+		again, _, err := store.ReadRendition(img.ID, orig, image.Rendition{Width: 480})
+		require.NoError(t, err)
+		assert.Equal(t, b, again)
+	})
+
+	t.Run("should convert to modern formats", func(t *testing.T) {
+		for _, format := range []string{image.WebP, image.AVIF} {
+			b, mimeType, err := store.ReadRendition(img.ID, orig, image.Rendition{Width: 240, Format: format})
+			require.NoError(t, err)
+			assert.Equal(t, "image/"+format, mimeType)
+
+			cfg, decoded, err := goimage.DecodeConfig(bytes.NewReader(b))
+			require.NoError(t, err)
+			assert.Equal(t, format, decoded)
+			assert.Equal(t, 240, cfg.Width)
+			assert.FileExists(t, filepath.Join(dir, image.RenditionDir, img.ID+"-240-v2."+format))
+		}
+
+		b, _, err := store.ReadRendition(img.ID, orig, image.Rendition{Format: image.WebP})
+		require.NoError(t, err)
+		cfg, _, err := goimage.DecodeConfig(bytes.NewReader(b))
+		require.NoError(t, err)
+		assert.Equal(t, img.Width, cfg.Width)
+		assert.FileExists(t, filepath.Join(dir, image.RenditionDir, img.ID+"-full-v2.webp"))
+	})
+
+	t.Run("should not enlarge narrow images", func(t *testing.T) {
+		b, mimeType, err := store.ReadRendition(img.ID, orig, image.Rendition{Width: 1920})
+		require.NoError(t, err)
+		assert.Equal(t, original, b)
+		assert.Equal(t, "image/jpeg", mimeType)
+
+		b, _, err = store.ReadRendition(img.ID, orig, image.Rendition{})
+		require.NoError(t, err)
+		assert.Equal(t, original, b)
+	})
+
+	t.Run("should serve cached renditions without reading the original", func(t *testing.T) {
+		b, _, err := store.ReadRendition(img.ID, orig, image.Rendition{Width: 960})
+		require.NoError(t, err)
+
+		originalPath := filepath.Join(dir, img.FileName)
+		require.NoError(t, os.WriteFile(originalPath, []byte("not an image"), 0644))
+		defer os.WriteFile(originalPath, original, 0644)
+
+		cached, _, err := store.ReadRendition(img.ID, orig, image.Rendition{Width: 960})
+		require.NoError(t, err)
+		assert.Equal(t, b, cached)
+	})
+
+	t.Run("should make a rendition once for requests at the same time", func(t *testing.T) {
+		r := image.Rendition{Width: 240, Format: image.JPEG}
+		results := make([][]byte, 8)
+		var wg sync.WaitGroup
+		for i := range results {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b, _, err := store.ReadRendition(img.ID, orig, r)
+				assert.NoError(t, err)
+				results[i] = b
+			}()
+		}
+		wg.Wait()
+
+		for _, b := range results {
+			assert.Equal(t, results[0], b)
+		}
+		assert.NotEmpty(t, results[0])
+	})
+
+	t.Run("should find the original without its details", func(t *testing.T) {
+		b, mimeType, err := store.ReadRendition(img.ID, image.Original{}, image.Rendition{Width: 480})
+		require.NoError(t, err)
+		assert.Equal(t, "image/jpeg", mimeType)
+		cfg, _, err := goimage.DecodeConfig(bytes.NewReader(b))
+		require.NoError(t, err)
+		assert.Equal(t, 480, cfg.Width)
+	})
+
+	t.Run("should only make renditions of rendition widths and formats", func(t *testing.T) {
+		_, _, err := store.ReadRendition(img.ID, orig, image.Rendition{Width: 500})
+		assert.Equal(t, image.InvalidWidth, err)
+
+		_, _, err = store.ReadRendition(img.ID, orig, image.Rendition{Format: "bmp"})
+		assert.Equal(t, image.UnsupportedFormat, err)
+
+		_, _, err = store.ReadRendition("missing", image.Original{}, image.Rendition{Width: 480})
+		assert.True(t, image.IsNotFound(err))
+	})
+
+	t.Run("should serve heic as jpeg and keep the original", func(t *testing.T) {
+		original, err := io.ReadAll(imagetest.DogsHEIC())
+		require.NoError(t, err)
+		heic, err := store.Save(bytes.NewReader(original))
+		require.NoError(t, err)
+
+		b, mimeType, err := store.ReadRendition(heic.ID, image.Original{Format: image.HEIC, Width: heic.Width}, image.Rendition{})
+		require.NoError(t, err)
+		assert.Equal(t, "image/jpeg", mimeType)
+		cfg, format, err := goimage.DecodeConfig(bytes.NewReader(b))
+		require.NoError(t, err)
+		assert.Equal(t, "jpeg", format)
+		assert.Equal(t, 400, cfg.Width)
+
+		b, mimeType, err = store.ReadRendition(heic.ID, image.Original{Format: image.HEIC, Width: heic.Width}, image.Rendition{Width: 240, Format: image.WebP})
+		require.NoError(t, err)
+		assert.Equal(t, "image/webp", mimeType)
+		cfg, err = webp.DecodeConfig(bytes.NewReader(b))
+		require.NoError(t, err)
+		assert.Equal(t, 240, cfg.Width)
+
+		kept, err := store.ReadFile(heic.ID)
+		require.NoError(t, err)
+		assert.Equal(t, original, kept)
+		require.NoError(t, store.Delete(heic.ID))
+	})
+
+	t.Run("should serve gifs as they are", func(t *testing.T) {
+		original, err := io.ReadAll(imagetest.FishGIF())
+		require.NoError(t, err)
+		fish, err := store.Save(bytes.NewReader(original))
+		require.NoError(t, err)
+
+		for _, r := range []image.Rendition{{}, {Width: 240}, {Format: image.AVIF}} {
+			b, mimeType, err := store.ReadRendition(fish.ID, image.Original{Format: image.GIF, Width: fish.Width}, r)
+			require.NoError(t, err)
+			assert.Equal(t, "image/gif", mimeType)
+			assert.Equal(t, original, b)
+		}
+		require.NoError(t, store.Delete(fish.ID))
+	})
+
+	t.Run("should make renditions of rotated photos the right way up", func(t *testing.T) {
+		fish, err := store.Save(imagetest.FishJPEG())
+		require.NoError(t, err)
+		defer store.Delete(fish.ID)
+
+		rotated, err := store.Save(imagetest.RotatedFishJPEGs()[6])
+		require.NoError(t, err)
+		defer store.Delete(rotated.ID)
+
+		for _, r := range []image.Rendition{{Width: 240}, {Format: image.PNG}} {
+			b, _, err := store.ReadRendition(rotated.ID, image.Original{Format: image.JPEG, Width: rotated.Width}, r)
+			require.NoError(t, err)
+			img, _, err := goimage.Decode(bytes.NewReader(b))
+			require.NoError(t, err)
+			if r.Width > 0 {
+				assert.Equal(t, r.Width, img.Bounds().Dx())
+			} else {
+				assert.Equal(t, fish.Width, img.Bounds().Dx())
+			}
+
+			assert.LessOrEqual(t, dhashDistance(t, fish.DHash, image.DHash(img)), 4)
+		}
+	})
+
+	t.Run("should delete renditions with the image", func(t *testing.T) {
+		require.NoError(t, store.Delete(img.ID))
+		files, err := os.ReadDir(filepath.Join(dir, image.RenditionDir))
+		require.NoError(t, err)
+		assert.Empty(t, files)
+	})
+}
+
 type testFileChecker struct {
 	root string
 }
@@ -142,3 +402,181 @@ func BenchmarkSave(b *testing.B) {
 	//delete resulting file
 	require.NoError(b, os.Remove(filepath.Join(root, newFile)))
 }
+
+func TestDHash(t *testing.T) {
+	decode := func(t *testing.T, f io.Reader) goimage.Image {
+		img, _, err := goimage.Decode(f)
+		require.NoError(t, err)
+		return img
+	}
+
+	ny := decode(t, imagetest.NYJPEG())
+
+	// the same photo shrunk to a third and saved again at a low quality
+	b := ny.Bounds()
+	small := goimage.NewRGBA(goimage.Rect(0, 0, b.Dx()/3, b.Dy()/3))
+	for y := 0; y < small.Bounds().Dy(); y++ {
+		for x := 0; x < small.Bounds().Dx(); x++ {
+			small.Set(x, y, ny.At(b.Min.X+x*3, b.Min.Y+y*3))
+		}
+	}
+	buf := bytes.Buffer{}
+	require.NoError(t, jpeg.Encode(&buf, small, &jpeg.Options{Quality: 40}))
+
+	nyHash := image.DHash(ny)
+	assert.Len(t, nyHash, 16)
+
+	resizedHash, err := image.DHashFile(buf.Bytes())
+	require.NoError(t, err)
+
+	t.Run("should be close for a resized copy", func(t *testing.T) {
+		assert.LessOrEqual(t, dhashDistance(t, nyHash, resizedHash), 6)
+	})
+
+	t.Run("should be far for different photos", func(t *testing.T) {
+		for _, f := range []fs.File{imagetest.FishJPEG(), imagetest.DogsJPEG(), imagetest.PlanePNG()} {
+			assert.Greater(t, dhashDistance(t, nyHash, image.DHash(decode(t, f))), 12)
+		}
+	})
+}
+
+// dhashDistance is how many bits differ between two DHashes, the way
+// db.GetDuplicates compares them
+func dhashDistance(t *testing.T, a, b string) int {
+	x, err := strconv.ParseUint(a, 16, 64)
+	require.NoError(t, err)
+	y, err := strconv.ParseUint(b, 16, 64)
+	require.NoError(t, err)
+	return bits.OnesCount64(x ^ y)
+}
+
+func TestStripMetadata(t *testing.T) {
+	readAll := func(t *testing.T, f fs.File) []byte {
+		b, err := io.ReadAll(f)
+		require.NoError(t, err)
+		return b
+	}
+	dogsJPEG, dogsWebP := readAll(t, imagetest.DogsJPEG()), readAll(t, imagetest.DogsWebP())
+
+	// a png with the exif of the dogs and a comment
+	pngBuf := bytes.Buffer{}
+	require.NoError(t, png.Encode(&pngBuf, goimage.NewRGBA(goimage.Rect(0, 0, 4, 4))))
+	i := bytes.Index(dogsWebP, []byte("EXIF"))
+	exifData := dogsWebP[i+8 : i+8+int(binary.LittleEndian.Uint32(dogsWebP[i+4:]))]
+	ihdrEnd := 8 + 12 + 13
+	dogsPNG := append([]byte{}, pngBuf.Bytes()[:ihdrEnd]...)
+	dogsPNG = appendPNGChunk(dogsPNG, "eXIf", exifData)
+	dogsPNG = appendPNGChunk(dogsPNG, "tEXt", []byte("Comment\x00our house"))
+	dogsPNG = append(dogsPNG, pngBuf.Bytes()[ihdrEnd:]...)
+
+	files := map[string][]byte{
+		image.JPEG: dogsJPEG,
+		image.WebP: dogsWebP,
+		image.PNG:  dogsPNG,
+	}
+
+	// where the exif starts in each format
+	exifMarkers := map[string][]byte{
+		image.JPEG: []byte("Exif\x00\x00"),
+		image.WebP: []byte("EXIF"),
+		image.PNG:  []byte("eXIf"),
+	}
+
+	decodeExif := func(t *testing.T, file []byte, format string) *exif.Exif {
+		if format == image.JPEG {
+			e, err := exif.Decode(bytes.NewReader(file))
+			require.NoError(t, err)
+			return e
+		}
+		i := bytes.Index(file, exifMarkers[format])
+		require.GreaterOrEqual(t, i, 0, "no exif in %s", format)
+		var payload []byte
+		if format == image.WebP {
+			size := int(binary.LittleEndian.Uint32(file[i+4:]))
+			payload = file[i+8 : i+8+size]
+		} else {
+			size := int(binary.BigEndian.Uint32(file[i-4:]))
+			payload = file[i+4 : i+4+size]
+		}
+		e, err := exif.Decode(bytes.NewReader(payload))
+		require.NoError(t, err)
+		return e
+	}
+
+	t.Run("should strip location and camera but keep the date", func(t *testing.T) {
+		for format, file := range files {
+			stripped, err := image.StripMetadata(file, format, image.PrivacyStandard)
+			require.NoError(t, err, format)
+			assert.Less(t, len(stripped), len(file), format)
+
+			e := decodeExif(t, stripped, format)
+			for _, name := range []exif.FieldName{exif.GPSLatitude, exif.GPSLongitude, exif.Make, exif.Model, exif.LensModel, exif.Software} {
+				_, err := e.Get(name)
+				assert.Error(t, err, "%s should not have %s", format, name)
+			}
+			taken, err := e.DateTime()
+			require.NoError(t, err, format)
+			assert.Equal(t, "2023-11-04 14:32:58", taken.Format(time.DateTime), format)
+
+			original, _, err := goimage.Decode(bytes.NewReader(file))
+			require.NoError(t, err)
+			img, decoded, err := goimage.Decode(bytes.NewReader(stripped))
+			require.NoError(t, err, format)
+			assert.Equal(t, format, decoded)
+			assert.Equal(t, original, img, format)
+		}
+		stripped, err := image.StripMetadata(dogsPNG, image.PNG, image.PrivacyStandard)
+		require.NoError(t, err)
+		assert.NotContains(t, string(stripped), "our house")
+	})
+
+	t.Run("should only keep the orientation when strict", func(t *testing.T) {
+		for format, file := range files {
+			stripped, err := image.StripMetadata(file, format, image.PrivacyStrict)
+			require.NoError(t, err, format)
+			assert.NotContains(t, string(stripped), string(exifMarkers[format]), format)
+			assert.NotContains(t, string(stripped), "iPhone", format)
+
+			_, decoded, err := goimage.Decode(bytes.NewReader(stripped))
+			require.NoError(t, err, format)
+			assert.Equal(t, format, decoded)
+		}
+
+		rotated := readAll(t, imagetest.RotatedFishJPEGs()[6])
+		stripped, err := image.StripMetadata(rotated, image.JPEG, image.PrivacyStrict)
+		require.NoError(t, err)
+		e := decodeExif(t, stripped, image.JPEG)
+		tag, err := e.Get(exif.Orientation)
+		require.NoError(t, err)
+		o, err := tag.Int(0)
+		require.NoError(t, err)
+		assert.Equal(t, 6, o)
+		_, err = e.DateTime()
+		assert.Error(t, err)
+	})
+
+	t.Run("should serve files as they are when off", func(t *testing.T) {
+		for format, file := range files {
+			stripped, err := image.StripMetadata(file, format, image.PrivacyOff)
+			require.NoError(t, err)
+			assert.Equal(t, file, stripped, format)
+		}
+	})
+
+	t.Run("should only accept known policies", func(t *testing.T) {
+		p, err := image.ParsePrivacyPolicy("strict")
+		require.NoError(t, err)
+		assert.Equal(t, image.PrivacyStrict, p)
+
+		_, err = image.ParsePrivacyPolicy("loose")
+		assert.Equal(t, image.UnknownPrivacyPolicy, err)
+	})
+}
+
+func appendPNGChunk(b []byte, chunkType string, data []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	start := len(b)
+	b = append(b, chunkType...)
+	b = append(b, data...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b[start:]))
+}
@@ -8,11 +8,12 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 
 	"github.com/wobwainwwight/sa-photos/image"
 )
 
-//go:embed dogs.jpg fish.jpg plane.png new-york.jpeg
+//go:embed dogs.jpg fish.jpg plane.png new-york.jpeg dogs.heic dogs.webp fish.gif fish-*.jpg
 var f embed.FS
 
 // FishJPEG returns the test jpeg image of a fish
@@ -30,11 +31,40 @@ func PlanePNG() fs.File {
 	return mustOpen("plane.png")
 }
 
+// RotatedFishJPEGs returns copies of the fish jpeg stored turned or
+// mirrored, each with the exif orientation that puts it the right way up
+// again, by orientation
+func RotatedFishJPEGs() map[int]fs.File {
+	return map[int]fs.File{
+		3: mustOpen("fish-rotate-180.jpg"),
+		5: mustOpen("fish-transpose.jpg"),
+		6: mustOpen("fish-rotate-90.jpg"),
+		8: mustOpen("fish-rotate-270.jpg"),
+	}
+}
+
 // DogsJPEG returns test jpeg image of dogs
 func DogsJPEG() fs.File {
 	return mustOpen("dogs.jpg")
 }
 
+// DogsHEIC returns a smaller copy of the dogs jpeg as an iPhone would
+// save it, with the same exif
+func DogsHEIC() fs.File {
+	return mustOpen("dogs.heic")
+}
+
+// DogsWebP returns a smaller copy of the dogs jpeg as a webp, with the
+// same exif
+func DogsWebP() fs.File {
+	return mustOpen("dogs.webp")
+}
+
+// FishGIF returns an animated gif of the fish turning around
+func FishGIF() fs.File {
+	return mustOpen("fish.gif")
+}
+
 func mustOpen(name string) fs.File {
 	imageFile, err := f.Open(name)
 	if err != nil {
@@ -89,24 +119,37 @@ func (t *TestStore) ReadFile(id string) ([]byte, error) {
 	return t.store.ReadFile(id)
 }
 
-// Close removes all files created by the teststore
+func (t *TestStore) ReadRendition(id string, o image.Original, r image.Rendition) ([]byte, string, error) {
+	return t.store.ReadRendition(id, o, r)
+}
+
+// Close removes all files created by the teststore, along with their
+// renditions
 func (t *TestStore) Close() {
 	for _, fn := range t.fileNames {
-		path := t.appendFileName(fn)
-		err := os.Remove(path)
+		id := strings.TrimSuffix(fn, filepath.Ext(fn))
+		err := t.store.Delete(id)
 		if err != nil {
-			fmt.Println("failed to remove file", path)
+			fmt.Println("failed to remove file", t.appendFileName(fn))
 		}
 	}
 	t.fileNames = []string{}
+	os.Remove(t.appendFileName(image.RenditionDir))
 }
 
 func (t *TestStore) appendFileName(name string) string {
 	return filepath.Join(t.dir, name)
 }
 
-func (t *TestStore) removeFileName(name string) {
-	i := slices.Index(t.fileNames, name)
+// removeFileName stops tracking the file of the image with the id, file
+// names are the id with an extension
+func (t *TestStore) removeFileName(id string) {
+	i := slices.IndexFunc(t.fileNames, func(name string) bool {
+		return strings.HasPrefix(name, id)
+	})
+	if i < 0 {
+		return
+	}
 	t.fileNames = slices.Delete(t.fileNames, i, i+1)
 }
 
@@ -0,0 +1,284 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var noExif = errors.New("no exif in file")
+
+// findExif gets the part of the file that holds its EXIF in a form that
+// exif.Decode can read. JPEGs are read whole as exif.Decode finds the
+// APP1 segment itself, PNG, WebP and HEIC keep their EXIF in a chunk or
+// an item of their containers. PNGs without an eXIf chunk and GIFs are
+// returned nil with no error as they're not expected to have any.
+func findExif(file []byte, imgType string) ([]byte, error) {
+	switch imgType {
+	case JPEG:
+		return file, nil
+	case PNG:
+		return findPNGExif(file)
+	case WebP:
+		return findWebPExif(file)
+	case HEIC:
+		return findHEICExif(file)
+	default:
+		return nil, nil
+	}
+}
+
+// findPNGExif walks the chunks of the PNG for the eXIf one
+func findPNGExif(file []byte) ([]byte, error) {
+	if !bytes.HasPrefix(file, []byte(pngSignature)) {
+		return nil, fmt.Errorf("not a png file")
+	}
+
+	chunks := file[len(pngSignature):]
+	for len(chunks) >= 12 {
+		size := int(binary.BigEndian.Uint32(chunks[0:4]))
+		if size > len(chunks)-12 {
+			return nil, fmt.Errorf("png chunk is longer than the file")
+		}
+		if string(chunks[4:8]) == "eXIf" {
+			return chunks[8 : 8+size], nil
+		}
+		chunks = chunks[12+size:]
+	}
+	return nil, nil
+}
+
+// findWebPExif walks the chunks of the RIFF container for the EXIF one,
+// https://developers.google.com/speed/webp/docs/riff_container
+func findWebPExif(file []byte) ([]byte, error) {
+	if len(file) < 12 || string(file[0:4]) != "RIFF" || string(file[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("not a webp file")
+	}
+
+	chunks := file[12:]
+	for len(chunks) >= 8 {
+		chunkType := string(chunks[0:4])
+		size := int(binary.LittleEndian.Uint32(chunks[4:8]))
+		if size > len(chunks)-8 {
+			return nil, fmt.Errorf("webp %s chunk is longer than the file", chunkType)
+		}
+		if chunkType == "EXIF" {
+			return chunks[8 : 8+size], nil
+		}
+		// chunks are padded to an even size
+		chunks = chunks[min(len(chunks), 8+size+size%2):]
+	}
+	return nil, noExif
+}
+
+// findHEICExif looks up the Exif item in the meta box of the HEIF
+// container and where its data is in the file, see ISO/IEC 23008-12 and
+// ISO/IEC 14496-12. Only items stored at an offset in the file are read,
+// which is how cameras and phones store them.
+func findHEICExif(file []byte) ([]byte, error) {
+	meta, ok := findBox(readBoxes(file), "meta")
+	if !ok || len(meta) < 4 {
+		return nil, fmt.Errorf("heic has no meta box")
+	}
+	// meta is a full box, its version and flags come before its children
+	children := readBoxes(meta[4:])
+
+	iinf, ok := findBox(children, "iinf")
+	if !ok {
+		return nil, noExif
+	}
+	id, ok := exifItemID(iinf)
+	if !ok {
+		return nil, noExif
+	}
+
+	iloc, ok := findBox(children, "iloc")
+	if !ok {
+		return nil, fmt.Errorf("heic has no iloc box")
+	}
+	offset, length, err := itemLocation(iloc, id)
+	if err != nil {
+		return nil, err
+	}
+	if length < 4 || offset > uint64(len(file)) || length > uint64(len(file))-offset {
+		return nil, fmt.Errorf("heic exif item is outside the file")
+	}
+
+	// the item starts with the offset to the TIFF header, past the
+	// Exif\0\0 that's usually in front of it
+	item := file[offset : offset+length]
+	tiffOffset := uint64(binary.BigEndian.Uint32(item)) + 4
+	if tiffOffset >= length {
+		return nil, fmt.Errorf("heic exif tiff header is outside the item")
+	}
+	return item[tiffOffset:], nil
+}
+
+type box struct {
+	boxType string
+	content []byte
+}
+
+// readBoxes splits b into the boxes it's made of, stopping at the first
+// one that's malformed
+func readBoxes(b []byte) []box {
+	boxes := []box{}
+	for len(b) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(b[0:4]))
+		header := uint64(8)
+		switch size {
+		case 0:
+			// the box goes to the end of the file
+			size = uint64(len(b))
+		case 1:
+			if len(b) < 16 {
+				return boxes
+			}
+			size = binary.BigEndian.Uint64(b[8:16])
+			header = 16
+		}
+		if size < header || size > uint64(len(b)) {
+			return boxes
+		}
+		boxes = append(boxes, box{boxType: string(b[4:8]), content: b[header:size]})
+		b = b[size:]
+	}
+	return boxes
+}
+
+func findBox(boxes []box, boxType string) ([]byte, bool) {
+	for _, b := range boxes {
+		if b.boxType == boxType {
+			return b.content, true
+		}
+	}
+	return nil, false
+}
+
+// exifItemID finds the ID of the item with the Exif type in an iinf box
+func exifItemID(iinf []byte) (uint32, bool) {
+	r := boxReader{b: iinf}
+	version, _ := r.fullBoxHeader()
+	if version == 0 {
+		r.uint(2)
+	} else {
+		r.uint(4)
+	}
+	if r.err != nil {
+		return 0, false
+	}
+
+	for _, b := range readBoxes(r.rest()) {
+		if b.boxType != "infe" {
+			continue
+		}
+		ir := boxReader{b: b.content}
+		infeVersion, _ := ir.fullBoxHeader()
+		// versions before 2 don't have an item type
+		if infeVersion < 2 {
+			continue
+		}
+		idSize := 2
+		if infeVersion > 2 {
+			idSize = 4
+		}
+		id := ir.uint(idSize)
+		ir.uint(2) // item_protection_index
+		itemType := ir.uint(4)
+		if ir.err == nil && itemType == fourCC("Exif") {
+			return uint32(id), true
+		}
+	}
+	return 0, false
+}
+
+// itemLocation gets the offset in the file and length of an item from an
+// iloc box, items made of more than one extent aren't supported
+func itemLocation(iloc []byte, id uint32) (uint64, uint64, error) {
+	r := boxReader{b: iloc}
+	version, _ := r.fullBoxHeader()
+	sizes := r.uint(2)
+	offsetSize := int(sizes >> 12)
+	lengthSize := int(sizes >> 8 & 0xf)
+	baseOffsetSize := int(sizes >> 4 & 0xf)
+	indexSize := 0
+	if version == 1 || version == 2 {
+		indexSize = int(sizes & 0xf)
+	}
+
+	idSize := 2
+	if version == 2 {
+		idSize = 4
+	}
+	count := r.uint(idSize)
+
+	for range count {
+		itemID := r.uint(idSize)
+		constructionMethod := uint64(0)
+		if version == 1 || version == 2 {
+			constructionMethod = r.uint(2) & 0xf
+		}
+		r.uint(2) // data_reference_index
+		baseOffset := r.uint(baseOffsetSize)
+		extents := r.uint(2)
+
+		offset, length := uint64(0), uint64(0)
+		for range extents {
+			r.uint(indexSize)
+			offset = baseOffset + r.uint(offsetSize)
+			length = r.uint(lengthSize)
+		}
+		if r.err != nil {
+			return 0, 0, fmt.Errorf("could not read heic iloc: %w", r.err)
+		}
+
+		if uint32(itemID) != id {
+			continue
+		}
+		if constructionMethod != 0 || extents != 1 {
+			return 0, 0, fmt.Errorf("heic exif item is not stored in one extent at an offset in the file")
+		}
+		return offset, length, nil
+	}
+	return 0, 0, noExif
+}
+
+func fourCC(s string) uint64 {
+	return uint64(binary.BigEndian.Uint32([]byte(s)))
+}
+
+// boxReader reads the big endian fields of a box, once it has run out of
+// bytes every read returns 0 and err is set
+type boxReader struct {
+	b   []byte
+	i   int
+	err error
+}
+
+// uint reads an n byte unsigned int, n can be 0 for fields that a box
+// leaves out
+func (r *boxReader) uint(n int) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if n > len(r.b)-r.i || n > 8 {
+		r.err = fmt.Errorf("box is too short")
+		return 0
+	}
+	v := uint64(0)
+	for _, c := range r.b[r.i : r.i+n] {
+		v = v<<8 | uint64(c)
+	}
+	r.i += n
+	return v
+}
+
+// fullBoxHeader reads the version and flags that full boxes start with
+func (r *boxReader) fullBoxHeader() (uint64, uint64) {
+	return r.uint(1), r.uint(3)
+}
+
+func (r *boxReader) rest() []byte {
+	return r.b[min(r.i, len(r.b)):]
+}
@@ -0,0 +1,109 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// Orientations from the EXIF orientation tag, how the stored pixels have
+// to be turned to be the right way up. Phones save portrait photos in
+// the shape of the sensor and tag them orientationRotate90.
+const (
+	orientationUpright      = 1
+	orientationFlip         = 2
+	orientationRotate180    = 3
+	orientationFlipVertical = 4
+	orientationTranspose    = 5
+	orientationRotate90     = 6
+	orientationTransverse   = 7
+	orientationRotate270    = 8
+)
+
+// exifOrientation reads the orientation tag, images without one or with
+// one that's not valid are upright
+func exifOrientation(e *exif.Exif) int {
+	tag, err := e.Get(exif.Orientation)
+	if err != nil {
+		return orientationUpright
+	}
+	o, err := tag.Int(0)
+	if err != nil || o < orientationUpright || o > orientationRotate270 {
+		return orientationUpright
+	}
+	return o
+}
+
+// fileOrientation reads the orientation from the EXIF of an image file.
+// HEICs are always upright, libheif applies the rotation stored in their
+// container when decoding them and their EXIF orientation repeats it.
+func fileOrientation(file []byte, imgType string) int {
+	if imgType == HEIC {
+		return orientationUpright
+	}
+	b, err := findExif(file, imgType)
+	if err != nil || b == nil {
+		return orientationUpright
+	}
+	e, err := exif.Decode(bytes.NewReader(b))
+	if err != nil {
+		return orientationUpright
+	}
+	return exifOrientation(e)
+}
+
+// swapsSides is whether the width and height of an image change places
+// when it's turned the right way up
+func swapsSides(orientation int) bool {
+	return orientation >= orientationTranspose && orientation <= orientationRotate270
+}
+
+// orient turns img the right way up for its EXIF orientation
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= orientationUpright || orientation > orientationRotate270 {
+		return img
+	}
+
+	src, ok := img.(*image.RGBA)
+	if !ok {
+		b := img.Bounds()
+		src = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	dw, dh := w, h
+	if swapsSides(orientation) {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// the pixel in src that ends up at x, y
+			sx, sy := x, y
+			switch orientation {
+			case orientationFlip:
+				sx = w - 1 - x
+			case orientationRotate180:
+				sx, sy = w-1-x, h-1-y
+			case orientationFlipVertical:
+				sy = h - 1 - y
+			case orientationTranspose:
+				sx, sy = y, x
+			case orientationRotate90:
+				sx, sy = y, h-1-x
+			case orientationTransverse:
+				sx, sy = w-1-y, h-1-x
+			case orientationRotate270:
+				sx, sy = w-1-y, x
+			}
+			si := src.PixOffset(src.Rect.Min.X+sx, src.Rect.Min.Y+sy)
+			di := dst.PixOffset(x, y)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,360 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"slices"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// PrivacyPolicy is how much of the metadata of an image file is left in
+// it when it's served. Stripping never touches the file in the FileStore,
+// the original keeps everything it was uploaded with.
+type PrivacyPolicy string
+
+const (
+	// PrivacyOff serves files as they were uploaded
+	PrivacyOff PrivacyPolicy = "off"
+	// PrivacyStandard removes everything but the orientation and when the
+	// photo was taken, which the gallery shows anyway. GPS, serial
+	// numbers, camera and lens details, XMP, IPTC and comments all go.
+	PrivacyStandard PrivacyPolicy = "standard"
+	// PrivacyStrict only keeps the orientation so photos are still shown
+	// the right way up
+	PrivacyStrict PrivacyPolicy = "strict"
+)
+
+var UnknownPrivacyPolicy = errors.New("privacy policy must be off, standard or strict")
+
+func ParsePrivacyPolicy(s string) (PrivacyPolicy, error) {
+	p := PrivacyPolicy(s)
+	if !slices.Contains([]PrivacyPolicy{PrivacyOff, PrivacyStandard, PrivacyStrict}, p) {
+		return "", UnknownPrivacyPolicy
+	}
+	return p, nil
+}
+
+// StripMetadata rewrites a JPEG, PNG or WebP file without the metadata the
+// policy doesn't keep, the image data is copied as it is. Files in other
+// formats are returned as they are, renditions are encoded without any
+// metadata and GIFs don't carry EXIF.
+func StripMetadata(file []byte, format string, policy PrivacyPolicy) ([]byte, error) {
+	if policy == PrivacyOff {
+		return file, nil
+	}
+
+	switch format {
+	case JPEG:
+		return stripJPEG(file, keptExif(file, format, policy))
+	case PNG:
+		return stripPNG(file, keptExif(file, format, policy))
+	case WebP:
+		return stripWebP(file, keptExif(file, format, policy))
+	default:
+		return file, nil
+	}
+}
+
+// EXIF tags that can be kept, the rest are never copied
+const (
+	tagOrientation      = 0x0112
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagDateTimeOriginal = 0x9003
+)
+
+// keptExif is a new TIFF of only the EXIF tags of the file the policy
+// keeps, nil if it keeps none of them
+func keptExif(file []byte, format string, policy PrivacyPolicy) []byte {
+	b, err := findExif(file, format)
+	if err != nil || b == nil {
+		return nil
+	}
+	e, err := exif.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil
+	}
+
+	ifd0, exifIFD := []tiffEntry{}, []tiffEntry{}
+	if o := exifOrientation(e); o != orientationUpright {
+		ifd0 = append(ifd0, shortEntry(tagOrientation, o))
+	}
+	if policy == PrivacyStandard {
+		if s, ok := exifString(e, exif.DateTime); ok {
+			ifd0 = append(ifd0, asciiEntry(tagDateTime, s))
+		}
+		if s, ok := exifString(e, exif.DateTimeOriginal); ok {
+			exifIFD = append(exifIFD, asciiEntry(tagDateTimeOriginal, s))
+		}
+	}
+
+	if len(ifd0) == 0 && len(exifIFD) == 0 {
+		return nil
+	}
+	return writeTIFF(ifd0, exifIFD)
+}
+
+func exifString(e *exif.Exif, name exif.FieldName) (string, bool) {
+	tag, err := e.Get(name)
+	if err != nil {
+		return "", false
+	}
+	s, err := tag.StringVal()
+	return s, err == nil && len(s) > 0
+}
+
+type tiffEntry struct {
+	tag   uint16
+	kind  uint16
+	count uint32
+	value []byte
+}
+
+func shortEntry(tag uint16, v int) tiffEntry {
+	return tiffEntry{tag: tag, kind: 3, count: 1, value: binary.LittleEndian.AppendUint16(nil, uint16(v))}
+}
+
+func asciiEntry(tag uint16, s string) tiffEntry {
+	value := append([]byte(s), 0)
+	return tiffEntry{tag: tag, kind: 2, count: uint32(len(value)), value: value}
+}
+
+// writeTIFF lays out a little endian TIFF with the entries in IFD0 and a
+// sub IFD for the Exif entries, entries have to be in tag order
+func writeTIFF(ifd0, exifIFD []tiffEntry) []byte {
+	le := binary.LittleEndian
+	ifdSize := func(entries []tiffEntry) int {
+		return 2 + 12*len(entries) + 4
+	}
+
+	if len(exifIFD) > 0 {
+		ifd0 = append(ifd0, tiffEntry{tag: tagExifIFD, kind: 4, count: 1})
+	}
+	exifOffset := 8 + ifdSize(ifd0)
+	dataOffset := exifOffset
+	if len(exifIFD) > 0 {
+		ifd0[len(ifd0)-1].value = le.AppendUint32(nil, uint32(exifOffset))
+		dataOffset += ifdSize(exifIFD)
+	}
+
+	out := []byte("II*\x00\x08\x00\x00\x00")
+	data := []byte{}
+	writeIFD := func(entries []tiffEntry) {
+		out = le.AppendUint16(out, uint16(len(entries)))
+		for _, e := range entries {
+			out = le.AppendUint16(out, e.tag)
+			out = le.AppendUint16(out, e.kind)
+			out = le.AppendUint32(out, e.count)
+			if len(e.value) <= 4 {
+				out = append(out, e.value...)
+				out = append(out, make([]byte, 4-len(e.value))...)
+				continue
+			}
+			out = le.AppendUint32(out, uint32(dataOffset+len(data)))
+			data = append(data, e.value...)
+			// values start on a word boundary
+			if len(data)%2 == 1 {
+				data = append(data, 0)
+			}
+		}
+		// no next IFD
+		out = le.AppendUint32(out, 0)
+	}
+	writeIFD(ifd0)
+	if len(exifIFD) > 0 {
+		writeIFD(exifIFD)
+	}
+	return append(out, data...)
+}
+
+// JPEG markers of the segments that are kept
+const (
+	markerSOI   = 0xD8
+	markerEOI   = 0xD9
+	markerSOS   = 0xDA
+	markerAPP0  = 0xE0
+	markerAPP1  = 0xE1
+	markerAPP2  = 0xE2
+	markerAPP14 = 0xEE
+	markerAPP15 = 0xEF
+	markerCOM   = 0xFE
+)
+
+// stripJPEG copies the segments of the JPEG that are needed to show it,
+// JFIF, ICC profiles and Adobe's colour transform, and leaves out the
+// other application segments and comments. Anything after the end of the
+// image is left out too, phones put extra images with their own EXIF
+// there. The kept EXIF goes in a new APP1 segment straight after SOI.
+func stripJPEG(file []byte, kept []byte) ([]byte, error) {
+	if len(file) < 4 || file[0] != 0xFF || file[1] != markerSOI {
+		return nil, fmt.Errorf("not a jpeg file")
+	}
+
+	out := []byte{0xFF, markerSOI}
+	if kept != nil {
+		payload := append([]byte("Exif\x00\x00"), kept...)
+		out = append(out, 0xFF, markerAPP1)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(payload)+2))
+		out = append(out, payload...)
+	}
+
+	i := 2
+	for i+1 < len(file) {
+		if file[i] != 0xFF {
+			return nil, fmt.Errorf("jpeg has no marker at %d", i)
+		}
+		marker := file[i+1]
+		if marker == 0xFF {
+			// markers can be padded with fill bytes
+			i++
+			continue
+		}
+		if marker == markerEOI {
+			return append(out, 0xFF, markerEOI), nil
+		}
+		if i+4 > len(file) {
+			break
+		}
+
+		end := i + 2 + int(binary.BigEndian.Uint16(file[i+2:i+4]))
+		if end > len(file) {
+			return nil, fmt.Errorf("jpeg segment at %d is longer than the file", i)
+		}
+		if keepJPEGSegment(marker, file[i+4:end]) {
+			out = append(out, file[i:end]...)
+		}
+		i = end
+
+		if marker == markerSOS {
+			// the scan runs up to the next marker that isn't a stuffed
+			// 0xFF or a restart
+			j := i
+			for j+1 < len(file) {
+				next := file[j+1]
+				if file[j] == 0xFF && next != 0 && next != 0xFF && (next < 0xD0 || next > 0xD7) {
+					break
+				}
+				j++
+			}
+			out = append(out, file[i:j]...)
+			i = j
+		}
+	}
+	return nil, fmt.Errorf("jpeg has no end of image")
+}
+
+func keepJPEGSegment(marker byte, payload []byte) bool {
+	switch {
+	case marker == markerAPP0:
+		return true
+	case marker == markerAPP2:
+		return bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00"))
+	case marker == markerAPP14:
+		return bytes.HasPrefix(payload, []byte("Adobe"))
+	case marker >= markerAPP0 && marker <= markerAPP15:
+		return false
+	case marker == markerCOM:
+		return false
+	default:
+		return true
+	}
+}
+
+// pngMetadataChunks are the ancillary chunks that are left out, text
+// chunks hold XMP as well as free text
+var pngMetadataChunks = []string{"eXIf", "tEXt", "zTXt", "iTXt", "tIME"}
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// stripPNG copies the chunks of the PNG that aren't pngMetadataChunks,
+// the kept EXIF goes in a new eXIf chunk after IHDR
+func stripPNG(file []byte, kept []byte) ([]byte, error) {
+	if !bytes.HasPrefix(file, []byte(pngSignature)) {
+		return nil, fmt.Errorf("not a png file")
+	}
+
+	out := []byte(pngSignature)
+	chunks := file[len(pngSignature):]
+	for len(chunks) >= 12 {
+		size := int(binary.BigEndian.Uint32(chunks[0:4]))
+		if size > len(chunks)-12 {
+			return nil, fmt.Errorf("png chunk is longer than the file")
+		}
+		chunkType := string(chunks[4:8])
+		if !slices.Contains(pngMetadataChunks, chunkType) {
+			out = append(out, chunks[:12+size]...)
+		}
+		if chunkType == "IHDR" && kept != nil {
+			out = appendPNGChunk(out, "eXIf", kept)
+		}
+		if chunkType == "IEND" {
+			return out, nil
+		}
+		chunks = chunks[12+size:]
+	}
+	return nil, fmt.Errorf("png has no end")
+}
+
+func appendPNGChunk(out []byte, chunkType string, data []byte) []byte {
+	out = binary.BigEndian.AppendUint32(out, uint32(len(data)))
+	start := len(out)
+	out = append(out, chunkType...)
+	out = append(out, data...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(out[start:]))
+}
+
+// VP8X flags for metadata chunks
+const (
+	webPFlagEXIF = 0x08
+	webPFlagXMP  = 0x04
+)
+
+// stripWebP copies the chunks of the WebP that aren't EXIF or XMP, the
+// kept EXIF goes in a new EXIF chunk at the end. Only extended WebPs
+// with a VP8X chunk can have metadata, simple ones are copied as they are.
+func stripWebP(file []byte, kept []byte) ([]byte, error) {
+	if len(file) < 12 || string(file[0:4]) != "RIFF" || string(file[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("not a webp file")
+	}
+
+	body := []byte("WEBP")
+	flags := -1
+	chunks := file[12:]
+	for len(chunks) >= 8 {
+		chunkType := string(chunks[0:4])
+		size := int(binary.LittleEndian.Uint32(chunks[4:8]))
+		if size > len(chunks)-8 {
+			return nil, fmt.Errorf("webp %s chunk is longer than the file", chunkType)
+		}
+		// chunks are padded to an even size
+		end := min(len(chunks), 8+size+size%2)
+		if chunkType == "VP8X" {
+			flags = len(body) + 8
+		}
+		if chunkType != "EXIF" && chunkType != "XMP " {
+			body = append(body, chunks[:end]...)
+		}
+		chunks = chunks[end:]
+	}
+
+	if flags >= 0 && flags < len(body) {
+		body[flags] &^= webPFlagEXIF | webPFlagXMP
+		if kept != nil {
+			body[flags] |= webPFlagEXIF
+			body = append(body, "EXIF"...)
+			body = binary.LittleEndian.AppendUint32(body, uint32(len(kept)))
+			body = append(body, kept...)
+			if len(kept)%2 == 1 {
+				body = append(body, 0)
+			}
+		}
+	}
+
+	out := []byte("RIFF")
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(body)))
+	return append(out, body...), nil
+}
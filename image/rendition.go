@@ -0,0 +1,313 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gen2brain/avif"
+	"github.com/gen2brain/webp"
+	"golang.org/x/image/draw"
+)
+
+// RenditionWidths are the widths images can be resized to, from gallery
+// tiles on phones up to the full screen on a 2x display
+var RenditionWidths = []int{240, 480, 960, 1920}
+
+// Formats renditions can be encoded as. WebP and AVIF are encoded with
+// libwebp and libavif, using the shared libraries when they're installed
+// and copies compiled to WASM when they're not.
+const (
+	JPEG = "jpeg"
+	PNG  = "png"
+	WebP = "webp"
+	AVIF = "avif"
+)
+
+// RenditionDir is the folder in the store's root that renditions are
+// cached in
+const RenditionDir = "renditions"
+
+// renditionVersion is part of the name of cached renditions, it goes up
+// whenever renditions are made differently so that the old ones aren't
+// served. Version 2 renditions are turned the right way up.
+const renditionVersion = 2
+
+// renditionJPEGQuality is lower than the default as renditions are only
+// ever shown smaller than the original, the WebP and AVIF qualities are
+// their encoders' defaults
+const renditionJPEGQuality = 80
+
+var InvalidWidth = errors.New("width must be one of the rendition widths")
+var UnsupportedFormat = errors.New("format must be jpeg, png, webp or avif")
+
+// Rendition is a version of an image resized to Width and encoded as
+// Format. A zero Width keeps the size of the image and an empty Format
+// keeps its format, so the zero Rendition is the original file.
+type Rendition struct {
+	Width  int
+	Format string
+}
+
+// MimeType is the content type of a file in the format
+func MimeType(format string) string {
+	return "image/" + format
+}
+
+// Original is what ReadRendition needs to know about an image without
+// reading its file, from the image's row in the catalogue. The format is
+// looked up from the file when it's empty and images with a zero Width
+// are keyed by the width asked for, Render won't enlarge them.
+type Original struct {
+	// Format is the format the image was uploaded in
+	Format string
+	// Width is the width of the image the right way up
+	Width int
+}
+
+// renderSlots bounds how many renditions are encoded at once, the WASM
+// encoders are slow and hold the whole image in memory
+var renderSlots = make(chan struct{}, runtime.GOMAXPROCS(0))
+
+// ReadRendition gets the rendition of an image along with its mime type.
+// Renditions are made the first time they're asked for and cached in the
+// RenditionDir, cached renditions are served without reading the
+// original. Images aren't enlarged, asking for a width wider than the
+// image gets it at its own width. The original file is kept as it was
+// uploaded, HEIC images are always served as a rendition.
+func (s FileStoreImpl) ReadRendition(id string, o Original, r Rendition) ([]byte, string, error) {
+	if r.Width != 0 && !slices.Contains(RenditionWidths, r.Width) {
+		return nil, "", InvalidWidth
+	}
+	if r.Format != "" && !slices.Contains([]string{JPEG, PNG, WebP, AVIF}, r.Format) {
+		return nil, "", UnsupportedFormat
+	}
+
+	if o.Format == "" {
+		filename, ok, err := s.checkFilename(id)
+		if err != nil {
+			return nil, "", fmt.Errorf("could not get image file %s: %w", id, err)
+		}
+		if !ok {
+			return nil, "", notFoundError{id}
+		}
+		o.Format = strings.TrimPrefix(filepath.Ext(filename), ".")
+	}
+
+	if o.Format == GIF {
+		// renditions would only have the first frame of animated GIFs
+		original, err := s.readOriginal(id, o.Format)
+		return original, MimeType(GIF), err
+	}
+	if r.Format == "" {
+		r.Format = displayFormat(o.Format)
+	}
+	if r.Width != 0 && o.Width != 0 && r.Width >= o.Width {
+		r.Width = 0
+	}
+	if r == (Rendition{Format: o.Format}) {
+		original, err := s.readOriginal(id, o.Format)
+		return original, MimeType(o.Format), err
+	}
+
+	path := filepath.Join(s.dir, RenditionDir, r.fileName(id))
+	cached, err := os.ReadFile(path)
+	if err == nil {
+		return cached, MimeType(r.Format), nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, "", fmt.Errorf("could not read rendition %s: %w", path, err)
+	}
+
+	rendered, err := renderOnce(path, func() ([]byte, error) {
+		renderSlots <- struct{}{}
+		defer func() { <-renderSlots }()
+
+		// it may have been made while this request waited for a slot
+		cached, err := os.ReadFile(path)
+		if err == nil {
+			return cached, nil
+		}
+
+		original, err := s.readOriginal(id, o.Format)
+		if err != nil {
+			return nil, err
+		}
+		rendered, err := Render(original, r)
+		if err != nil {
+			return nil, fmt.Errorf("could not render image %s: %w", id, err)
+		}
+
+		err = writeFileAtomic(path, rendered)
+		if err != nil {
+			return nil, fmt.Errorf("could not cache rendition %s: %w", path, err)
+		}
+		return rendered, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return rendered, MimeType(r.Format), nil
+}
+
+// readOriginal reads the file of an image uploaded in the format
+func (s FileStoreImpl) readOriginal(id string, format string) ([]byte, error) {
+	original, err := os.ReadFile(filepath.Join(s.dir, id+"."+format))
+	if os.IsNotExist(err) {
+		return nil, notFoundError{id}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get image file %s: %w", id, err)
+	}
+	return original, nil
+}
+
+// renderCall is a rendition being made, requests for the same rendition
+// wait for it instead of making it again
+type renderCall struct {
+	done     chan struct{}
+	rendered []byte
+	err      error
+}
+
+var renders = struct {
+	sync.Mutex
+	calls map[string]*renderCall
+}{calls: map[string]*renderCall{}}
+
+// renderOnce makes the rendition cached at path with fn, only once however
+// many requests ask for it at the same time
+func renderOnce(path string, fn func() ([]byte, error)) ([]byte, error) {
+	renders.Lock()
+	if c, ok := renders.calls[path]; ok {
+		renders.Unlock()
+		<-c.done
+		return c.rendered, c.err
+	}
+	c := &renderCall{done: make(chan struct{})}
+	renders.calls[path] = c
+	renders.Unlock()
+
+	defer func() {
+		renders.Lock()
+		delete(renders.calls, path)
+		renders.Unlock()
+		close(c.done)
+	}()
+	c.rendered, c.err = fn()
+	return c.rendered, c.err
+}
+
+// displayFormat is the format an image is served in when the browser
+// hasn't asked for one, HEIC is converted to JPEG as most browsers can't
+// show it
+func displayFormat(format string) string {
+	if format == HEIC {
+		return JPEG
+	}
+	return format
+}
+
+func (r Rendition) fileName(id string) string {
+	size := "full"
+	if r.Width != 0 {
+		size = fmt.Sprint(r.Width)
+	}
+	return fmt.Sprintf("%s-%s-v%d.%s", id, size, renditionVersion, r.Format)
+}
+
+// Render turns the image file the right way up, scales it down to the
+// width of the rendition and encodes it in the rendition's format
+func Render(file []byte, r Rendition) ([]byte, error) {
+	img, imgType, err := image.Decode(bytes.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("could not decode image: %w", err)
+	}
+	// renditions don't keep the EXIF of the original so have to be turned
+	// the right way up
+	img = orient(img, fileOrientation(file, imgType))
+
+	b := img.Bounds()
+	if r.Width != 0 && b.Dx() > r.Width {
+		height := max(1, b.Dy()*r.Width/b.Dx())
+		dst := image.NewRGBA(image.Rect(0, 0, r.Width, height))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+		img = dst
+	}
+
+	format := r.Format
+	if format == "" {
+		format = imgType
+	}
+
+	buf := bytes.Buffer{}
+	switch format {
+	case JPEG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: renditionJPEGQuality})
+	case PNG:
+		err = png.Encode(&buf, img)
+	case WebP:
+		err = webp.Encode(&buf, img)
+	case AVIF:
+		err = avif.Encode(&buf, img)
+	default:
+		return nil, UnsupportedFormat
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not encode %s rendition: %w", format, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeFileAtomic writes to a temporary file first so that a rendition
+// being made by two requests at once is never read half written
+func writeFileAtomic(path string, b []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".rendition-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// deleteRenditions removes the cached renditions of an image
+func (s FileStoreImpl) deleteRenditions(id string) error {
+	dir, err := os.ReadDir(filepath.Join(s.dir, RenditionDir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, f := range dir {
+		if strings.HasPrefix(f.Name(), id+"-") {
+			err = os.Remove(filepath.Join(s.dir, RenditionDir, f.Name()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
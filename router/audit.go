@@ -0,0 +1,98 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/wobwainwwight/sa-photos/db"
+)
+
+type AuditPage struct {
+	Events  []AuditItem
+	NextURL string
+}
+
+type AuditItem struct {
+	CreatedAt string
+	Username  string
+	Action    string
+	ImageID   string
+	ImageURL  string
+	Before    string
+	After     string
+}
+
+// audit records a change to an image by the user making the request.
+// The change has already been made by the time it's recorded so failing
+// to record it is logged rather than failing the request, and it's
+// still recorded if the client has gone.
+func (ro *Router) audit(r *http.Request, action, imageID string, before, after *db.Image) {
+	username, _, _ := r.BasicAuth()
+	ctx := context.WithoutCancel(r.Context())
+	err := ro.ImageTable.AddAuditEventContext(ctx, username, action, imageID, before, after)
+	if err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func (ro *Router) adminAudit(w http.ResponseWriter, r *http.Request) {
+	opts := []db.GetListOptsFn{}
+	if cursor := r.URL.Query().Get("cursor"); len(cursor) > 0 {
+		opts = append(opts, db.WithCursorStr(cursor))
+	}
+
+	list, err := ro.ImageTable.GetAuditEventsContext(r.Context(), opts...)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), listErrorCode(err))
+		return
+	}
+
+	tmpl := ro.Templates.Lookup("audit.html")
+	if tmpl == nil {
+		log.Println("audit.html template not found")
+		return
+	}
+
+	page := AuditPage{Events: make([]AuditItem, len(list.Events))}
+	for i, e := range list.Events {
+		page.Events[i] = AuditItem{
+			CreatedAt: e.CreatedAt.Format(time.DateTime),
+			Username:  e.Username,
+			Action:    e.Action,
+			ImageID:   e.ImageID,
+			ImageURL:  fmt.Sprintf("/images/%s", e.ImageID),
+			Before:    indentJSON(e.Before),
+			After:     indentJSON(e.After),
+		}
+	}
+
+	// a full page means there could be more
+	if len(list.Events) > 0 && len(list.Events) == list.Cursor.Opts().Limit {
+		page.NextURL = "/admin/audit?cursor=" + url.QueryEscape(list.Cursor.EncodedString())
+	}
+
+	err = tmpl.Execute(w, page)
+	if err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// indentJSON makes JSON readable for the audit page, null is left blank
+func indentJSON(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	buf := bytes.Buffer{}
+	err := json.Indent(&buf, raw, "", "  ")
+	if err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
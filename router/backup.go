@@ -0,0 +1,105 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/wobwainwwight/sa-photos/db"
+)
+
+// DefaultBackupKeep is how many snapshots are kept when Options doesn't say
+const DefaultBackupKeep = 7
+
+var BackupsNotSupported = errors.New("the catalogue can't be backed up")
+
+func (ro *Router) backupKeep() int {
+	if ro.BackupKeep > 0 {
+		return ro.BackupKeep
+	}
+	return DefaultBackupKeep
+}
+
+// Backup takes a snapshot of the catalogue into the BackupDir, keeping
+// only the newest snapshots
+func (ro *Router) Backup(ctx context.Context, now time.Time) error {
+	bc, ok := ro.ImageTable.(db.BackupCatalogue)
+	if !ok {
+		return BackupsNotSupported
+	}
+
+	path, err := db.Snapshot(ctx, bc, ro.BackupDir, now, ro.backupKeep())
+	if err != nil {
+		return err
+	}
+	log.Println("backed up to: ", path)
+	return nil
+}
+
+// BackupEvery runs Backup straight away and then every interval until
+// the context is done
+func (ro *Router) BackupEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := ro.Backup(ctx, time.Now())
+		if err != nil {
+			log.Printf("could not backup: %s\n", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// adminBackup streams a snapshot of the catalogue taken for the request,
+// it's written to a temporary file first as VACUUM INTO can only write
+// to files
+func (ro *Router) adminBackup(w http.ResponseWriter, r *http.Request) {
+	bc, ok := ro.ImageTable.(db.BackupCatalogue)
+	if !ok {
+		http.Error(w, BackupsNotSupported.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "saws-backup")
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := db.SnapshotPath(dir, time.Now())
+	err = bc.BackupContext(r.Context(), path)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), errorCode(err))
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+	_, err = io.Copy(w, f)
+	if err != nil {
+		log.Printf("could not send backup: %s\n", err.Error())
+	}
+}
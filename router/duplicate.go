@@ -0,0 +1,188 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/wobwainwwight/sa-photos/db"
+	"github.com/wobwainwwight/sa-photos/image"
+)
+
+type DuplicatesPage struct {
+	Distance int
+	Pairs    []DuplicateItem
+}
+
+// DuplicateItem is a pair of images on the duplicates page, either can be
+// kept with the other going to the trash
+type DuplicateItem struct {
+	Distance int
+	Image    DuplicateImageItem
+	Other    DuplicateImageItem
+	// KeepBothVals are the form values that keep both images
+	KeepBothVals string
+}
+
+type DuplicateImageItem struct {
+	ID        string
+	ImageURL  string
+	AltText   string
+	Thumbhash string
+	Width     int
+	Height    int
+	Size      string
+	CreatedAt string
+	// KeepVals are the form values that keep this image and trash the
+	// other one
+	KeepVals string
+}
+
+func (ro *Router) adminDuplicates(w http.ResponseWriter, r *http.Request) {
+	distance := db.DefaultDuplicateDistance
+	if d := r.URL.Query().Get("distance"); len(d) > 0 {
+		var err error
+		distance, err = strconv.Atoi(d)
+		if err != nil || distance < 0 || distance > db.MaxDuplicateDistance {
+			http.Error(w, fmt.Sprintf("distance must be a number from 0 to %d", db.MaxDuplicateDistance), http.StatusBadRequest)
+			return
+		}
+	}
+
+	pairs, err := ro.ImageTable.GetDuplicatesContext(r.Context(), distance)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), errorCode(err))
+		return
+	}
+
+	tmpl := ro.Templates.Lookup("duplicates.html")
+	if tmpl == nil {
+		log.Println("duplicates.html template not found")
+		return
+	}
+
+	page := DuplicatesPage{Distance: distance, Pairs: make([]DuplicateItem, len(pairs))}
+	for i, p := range pairs {
+		page.Pairs[i] = DuplicateItem{
+			Distance:     p.Distance,
+			Image:        duplicateImage(p.Image, p.Other),
+			Other:        duplicateImage(p.Other, p.Image),
+			KeepBothVals: fmt.Sprintf(`{"id": %q, "other": %q}`, p.Image.ID, p.Other.ID),
+		}
+	}
+
+	err = tmpl.Execute(w, page)
+	if err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func duplicateImage(img, other db.Image) DuplicateImageItem {
+	targetHeight := 200
+	return DuplicateImageItem{
+		ID:        img.ID,
+		ImageURL:  fmt.Sprintf("/images/%s", img.ID),
+		AltText:   altText(img),
+		Thumbhash: img.ThumbHash,
+		Width:     image.ResizeWidth(img.Width, img.Height, targetHeight),
+		Height:    targetHeight,
+		Size:      fmt.Sprintf("%dx%d", img.Width, img.Height),
+		CreatedAt: img.CreatedAt.Format("2006-01-02 15:04"),
+		KeepVals:  fmt.Sprintf(`{"keep": %q, "trash": %q}`, img.ID, other.ID),
+	}
+}
+
+// keepOneDuplicate trashes the image that isn't kept, it can be restored
+// from the trash the same as any other
+func (ro *Router) keepOneDuplicate(w http.ResponseWriter, r *http.Request) {
+	keep, trash := r.FormValue("keep"), r.FormValue("trash")
+	if len(keep) == 0 || len(trash) == 0 || keep == trash {
+		http.Error(w, "keep and trash must be two different images", http.StatusBadRequest)
+		return
+	}
+
+	_, err := ro.ImageTable.GetByIDContext(r.Context(), keep)
+	var img db.Image
+	if err == nil {
+		img, err = ro.ImageTable.GetByIDContext(r.Context(), trash)
+	}
+	if err == nil {
+		err = ro.ImageTable.TrashContext(r.Context(), trash)
+	}
+	if err == db.NotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		msg := fmt.Sprintf("could not trash image %s: %s", trash, err.Error())
+		log.Println(msg)
+		http.Error(w, msg, errorCode(err))
+		return
+	}
+
+	ro.audit(r, db.AuditDelete, trash, &img, nil)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (ro *Router) keepBothDuplicates(w http.ResponseWriter, r *http.Request) {
+	id, other := r.FormValue("id"), r.FormValue("other")
+	if len(id) == 0 || len(other) == 0 || id == other {
+		http.Error(w, "id and other must be two different images", http.StatusBadRequest)
+		return
+	}
+
+	err := ro.ImageTable.KeepBothContext(r.Context(), id, other)
+	if err == db.NotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		msg := fmt.Sprintf("could not keep both %s and %s: %s", id, other, err.Error())
+		log.Println(msg)
+		http.Error(w, msg, errorCode(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// BackfillDHashes hashes the images that were uploaded before DHashes
+// were, images whose file can't be read are skipped. It stops between
+// images once the context is done.
+func (ro *Router) BackfillDHashes(ctx context.Context) error {
+	ids, err := ro.ImageTable.GetUnhashedContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	hashed := 0
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		file, err := ro.ImageFileStore.ReadFile(id)
+		if err != nil {
+			log.Printf("could not read image file %s for dhash: %s\n", id, err.Error())
+			continue
+		}
+
+		dhash, err := image.DHashFile(file)
+		if err != nil {
+			log.Printf("could not dhash image %s: %s\n", id, err.Error())
+			continue
+		}
+
+		err = ro.ImageTable.SetDHashContext(ctx, id, dhash)
+		if err != nil {
+			return err
+		}
+		hashed++
+	}
+	if hashed > 0 {
+		log.Printf("backfilled dhashes of %d images\n", hashed)
+	}
+	return nil
+}
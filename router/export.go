@@ -0,0 +1,40 @@
+package router
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/wobwainwwight/sa-photos/db"
+)
+
+// exportContentTypes are the content types of each export format
+var exportContentTypes = map[db.Format]string{
+	db.JSONL: "application/jsonl",
+	db.CSV:   "text/csv",
+}
+
+// adminExport streams every image in the catalogue as JSON Lines, or as
+// CSV with ?format=csv. Errors once the export has started can only be
+// logged as the status has already been sent.
+func (ro *Router) adminExport(w http.ResponseWriter, r *http.Request) {
+	format := db.JSONL
+	if f := r.URL.Query().Get("format"); len(f) > 0 {
+		var err error
+		format, err = db.ParseFormat(f)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", exportContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q",
+		fmt.Sprintf("saws-%s.%s", time.Now().UTC().Format(time.DateOnly), format)))
+
+	err := db.Export(r.Context(), ro.ImageTable, w, format)
+	if err != nil {
+		log.Printf("could not export catalogue: %s\n", err.Error())
+	}
+}
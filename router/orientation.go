@@ -0,0 +1,55 @@
+package router
+
+import (
+	"context"
+	"log"
+
+	"github.com/wobwainwwight/sa-photos/db"
+	"github.com/wobwainwwight/sa-photos/image"
+)
+
+// BackfillOrientation measures the images saved before they were turned
+// the right way up again, so photos taken on their side get the width,
+// height, thumbhash and dhash of the photo as it's shown. Images that
+// can't be read are left for the next run.
+func (ro *Router) BackfillOrientation(ctx context.Context) error {
+	ids, err := ro.ImageTable.GetUnorientedContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	oriented := 0
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		file, err := ro.ImageFileStore.ReadFile(id)
+		if err != nil {
+			log.Printf("could not read image file %s to orient: %s\n", id, err.Error())
+			continue
+		}
+
+		measured, err := image.MeasureFile(file)
+		if err != nil {
+			log.Printf("could not measure image %s: %s\n", id, err.Error())
+			continue
+		}
+
+		err = ro.ImageTable.SetOrientedContext(ctx, db.Image{
+			ID:        id,
+			Width:     measured.Width,
+			Height:    measured.Height,
+			ThumbHash: measured.ThumbHash,
+			DHash:     measured.DHash,
+		})
+		if err != nil {
+			return err
+		}
+		oriented++
+	}
+	if oriented > 0 {
+		log.Printf("backfilled orientation of %d images\n", oriented)
+	}
+	return nil
+}
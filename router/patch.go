@@ -0,0 +1,153 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/wobwainwwight/sa-photos/db"
+)
+
+// invalidPatch is returned for a patch the client got wrong, it is
+// reported back as a 400
+type invalidPatch struct {
+	msg string
+}
+
+func (e invalidPatch) Error() string {
+	return e.msg
+}
+
+// patchField is a string field of an image that can be changed with
+// PATCH /images/{id}
+type patchField struct {
+	field  func(img *db.Image) *string
+	maxLen int
+}
+
+var patchFields = map[string]patchField{
+	"title":    {func(img *db.Image) *string { return &img.Title }, 200},
+	"caption":  {func(img *db.Image) *string { return &img.Caption }, 2000},
+	"altText":  {func(img *db.Image) *string { return &img.AltText }, 1000},
+	"locality": {func(img *db.Image) *string { return &img.Locality }, 200},
+	"country":  {func(img *db.Image) *string { return &img.Country }, 100},
+}
+
+// imagePatch is a JSON merge patch (RFC 7396) of an image.
+//
+// Only the fields in patchFields and "tags" can be patched. Fields left
+// out are not changed and null clears a field, so {"tags": null} removes
+// every tag. As well as replacing the tags, "addTags" and "removeTags"
+// arrays can be sent to change them without knowing the current ones.
+type imagePatch struct {
+	fields     map[string]*string
+	tags       []string
+	setTags    bool
+	addTags    []string
+	removeTags []string
+}
+
+func parseImagePatch(body map[string]json.RawMessage) (imagePatch, error) {
+	p := imagePatch{fields: map[string]*string{}}
+
+	var err error
+	if raw, ok := body["tags"]; ok {
+		p.setTags = true
+		p.tags, err = parsePatchTags("tags", raw)
+		if err != nil {
+			return imagePatch{}, err
+		}
+	}
+	if raw, ok := body["addTags"]; ok {
+		p.addTags, err = parsePatchTags("addTags", raw)
+		if err != nil {
+			return imagePatch{}, err
+		}
+	}
+	if raw, ok := body["removeTags"]; ok {
+		p.removeTags, err = parsePatchTags("removeTags", raw)
+		if err != nil {
+			return imagePatch{}, err
+		}
+	}
+
+	for key, raw := range body {
+		if key == "tags" || key == "addTags" || key == "removeTags" {
+			continue
+		}
+
+		f, ok := patchFields[key]
+		if !ok {
+			return imagePatch{}, invalidPatch{fmt.Sprintf("%s cannot be changed", key)}
+		}
+
+		var value *string
+		err = json.Unmarshal(raw, &value)
+		if err != nil {
+			return imagePatch{}, invalidPatch{fmt.Sprintf("%s must be a string or null", key)}
+		}
+		if value != nil {
+			trimmed := strings.TrimSpace(*value)
+			if utf8.RuneCountInString(trimmed) > f.maxLen {
+				return imagePatch{}, invalidPatch{fmt.Sprintf("%s must be at most %d characters", key, f.maxLen)}
+			}
+			value = &trimmed
+		}
+		p.fields[key] = value
+	}
+
+	return p, nil
+}
+
+func parsePatchTags(key string, raw json.RawMessage) ([]string, error) {
+	var tags []string
+	err := json.Unmarshal(raw, &tags)
+	if err != nil {
+		return nil, invalidPatch{fmt.Sprintf("%s must be an array of strings or null", key)}
+	}
+
+	for i, t := range tags {
+		tags[i], err = db.NormaliseTag(t)
+		if err != nil {
+			return nil, invalidPatch{fmt.Sprintf("%s: %s: %q", key, err.Error(), t)}
+		}
+	}
+	return tags, nil
+}
+
+// apply merges the patch's fields into the image, returning whether any
+// of them changed
+func (p imagePatch) apply(img *db.Image) bool {
+	changed := false
+	for key, value := range p.fields {
+		field := patchFields[key].field(img)
+
+		next := ""
+		if value != nil {
+			next = *value
+		}
+		if *field != next {
+			*field = next
+			changed = true
+		}
+	}
+	return changed
+}
+
+// patchedTags is what the image's tags will be once the patch is applied
+func (p imagePatch) patchedTags(current []string) []string {
+	tags := slices.Clone(current)
+	if p.setTags {
+		tags = slices.Clone(p.tags)
+	}
+	tags = append(tags, p.addTags...)
+	return slices.DeleteFunc(tags, func(t string) bool {
+		return slices.Contains(p.removeTags, t)
+	})
+}
+
+func (p imagePatch) changesTags() bool {
+	return p.setTags || len(p.addTags) > 0 || len(p.removeTags) > 0
+}
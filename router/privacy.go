@@ -0,0 +1,109 @@
+package router
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/wobwainwwight/sa-photos/db"
+	"github.com/wobwainwwight/sa-photos/image"
+)
+
+// DefaultPrivacy is the privacy policy when Options doesn't say
+const DefaultPrivacy = image.PrivacyStandard
+
+func (ro *Router) privacy() image.PrivacyPolicy {
+	if len(ro.Privacy) > 0 {
+		return ro.Privacy
+	}
+	return DefaultPrivacy
+}
+
+// locationsPerDegree is how finely locations are shown to people who
+// aren't admins under the standard policy, a tenth of a degree is about
+// 11km so it's the town the photo was taken in rather than the street
+const locationsPerDegree = 10
+
+// minSearchKm is the radius searches by people who aren't admins are
+// rounded up to, so a shrinking radius can't find a location more finely
+// than it's shown. It's at least the diagonal of a grid square, which is
+// about 15.7km at the equator and shorter everywhere else
+const minSearchKm = 16
+
+// exactLocations is whether the request can see where photos were taken
+// to the metre, the privacy policy is only for people who aren't admins
+func (ro *Router) exactLocations(r *http.Request) bool {
+	return ro.privacy() == image.PrivacyOff || detemineIsAdmin(r, ro.Admins)
+}
+
+// publicLocation applies the privacy policy to the lat and long of an
+// image, standard coarsens them and strict leaves them out
+func (ro *Router) publicLocation(r *http.Request, img *db.Image) {
+	if ro.exactLocations(r) {
+		return
+	}
+	if ro.privacy() == image.PrivacyStrict {
+		img.Lat, img.Long = 0, 0
+		return
+	}
+	img.Lat = math.Round(img.Lat*locationsPerDegree) / locationsPerDegree
+	img.Long = math.Round(img.Long*locationsPerDegree) / locationsPerDegree
+}
+
+// publicBounds widens a search area out to the grid locations are shown
+// on, so every image in a grid square is either found or not
+func publicBounds(b db.Bounds) db.Bounds {
+	return db.Bounds{
+		South: math.Floor(b.South*locationsPerDegree) / locationsPerDegree,
+		West:  math.Floor(b.West*locationsPerDegree) / locationsPerDegree,
+		North: math.Ceil(b.North*locationsPerDegree) / locationsPerDegree,
+		East:  math.Ceil(b.East*locationsPerDegree) / locationsPerDegree,
+	}
+}
+
+// publicRadius moves a search onto the grid locations are shown on and
+// rounds it up to a multiple of minSearchKm
+func publicRadius(r db.Radius) db.Radius {
+	if r.Km > 0 {
+		r.Km = math.Ceil(r.Km/minSearchKm) * minSearchKm
+	}
+	r.Lat = math.Round(r.Lat*locationsPerDegree) / locationsPerDegree
+	r.Long = math.Round(r.Long*locationsPerDegree) / locationsPerDegree
+	return r
+}
+
+// adminOriginal downloads the image file as it was uploaded, with all its
+// metadata
+func (ro *Router) adminOriginal(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	img, err := ro.ImageTable.GetByIDContext(r.Context(), id)
+	if err != nil {
+		if err == db.NotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		msg := fmt.Sprintf("could not get image %s from table: %s", id, err.Error())
+		log.Println(msg)
+		http.Error(w, msg, errorCode(err))
+		return
+	}
+
+	fileBytes, err := ro.ImageFileStore.ReadFile(id)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if image.IsNotFound(err) {
+			code = http.StatusNotFound
+		}
+		log.Println(err.Error())
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	w.Header().Set("Content-Type", img.MimeType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q",
+		id+"."+strings.TrimPrefix(img.MimeType, "image/")))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(fileBytes)
+}
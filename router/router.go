@@ -10,6 +10,7 @@ import (
 	"log"
 	"net/http"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,13 +23,26 @@ import (
 type Services struct {
 	ImageFileStore image.FileStore
 	Templates      *template.Template
-	ImageTable     *db.ImageTable
-	MapsClient     *maps.Client
+	// ImageTable is either a *db.ImageTable or a *db.MemoryCatalogue
+	ImageTable db.FullCatalogue
+	MapsClient *maps.Client
 }
 
 type Options struct {
 	IncludeIndexPage bool
 	Admins           []string
+	// TrashRetention is how long trashed images are kept before they're
+	// purged, it defaults to DefaultTrashRetention
+	TrashRetention time.Duration
+	// BackupDir is where scheduled snapshots of the catalogue are kept
+	BackupDir string
+	// BackupKeep is how many snapshots are kept, it defaults to
+	// DefaultBackupKeep
+	BackupKeep int
+	// Privacy is how much metadata is left in the image files served and
+	// how exact the locations in the api are for people who aren't admins,
+	// it defaults to DefaultPrivacy
+	Privacy image.PrivacyPolicy
 }
 
 func NewRouter(svc Services, opts Options) Router {
@@ -41,29 +55,78 @@ func NewRouter(svc Services, opts Options) Router {
 	}
 
 	mux.HandleFunc("GET /{$}", ro.index)
-	mux.HandleFunc("GET /south-america", ro.southAmerica)
-	mux.HandleFunc("GET /south-america/images/list", ro.southAmericaList)
-	mux.HandleFunc("GET /south-america/images/{id}", ro.southAmericaImage)
-	mux.HandleFunc("PUT /south-america/images", ro.putImages)
+	mux.HandleFunc("GET /albums/{slug}", ro.album)
+	mux.HandleFunc("GET /albums/{slug}/images/list", ro.albumList)
+	mux.HandleFunc("GET /albums/{slug}/images/{id}", ro.albumImage)
+	mux.HandleFunc("PUT /albums/{slug}/images", ro.putImages)
+	mux.HandleFunc("GET /albums/{slug}/stats", ro.albumStats)
+	mux.HandleFunc("GET /albums/{slug}/{country}", ro.album)
+	mux.HandleFunc("GET /albums/{slug}/{country}/{locality}", ro.album)
+	mux.HandleFunc("GET /south-america", inAlbum(SouthAmerica, ro.album))
+	mux.HandleFunc("GET /south-america/images/list", inAlbum(SouthAmerica, ro.albumList))
+	mux.HandleFunc("GET /south-america/images/{id}", inAlbum(SouthAmerica, ro.albumImage))
+	mux.HandleFunc("PUT /south-america/images", inAlbum(SouthAmerica, ro.putImages))
+	mux.HandleFunc("GET /south-america/stats", inAlbum(SouthAmerica, ro.albumStats))
+	mux.HandleFunc("GET /south-america/{country}", inAlbum(SouthAmerica, ro.album))
+	mux.HandleFunc("GET /south-america/{country}/{locality}", inAlbum(SouthAmerica, ro.album))
+	mux.HandleFunc("GET /api/albums", ro.apiListAlbums)
+	mux.HandleFunc("POST /api/albums", ro.adminOnly(ro.apiCreateAlbum))
+	mux.HandleFunc("PATCH /api/albums/{slug}", ro.adminOnly(ro.apiRenameAlbum))
+	mux.HandleFunc("PUT /api/albums/order", ro.adminOnly(ro.apiReorderAlbums))
 	mux.HandleFunc("POST /images", ro.postImage)
 	mux.HandleFunc("GET /images/{id}", ro.getImage)
 	mux.HandleFunc("PATCH /images/{id}", ro.patchImage)
 	mux.HandleFunc("DELETE /images/{id}", ro.deleteImage)
+	mux.HandleFunc("POST /images/{id}/restore", ro.adminOnly(ro.restoreImage))
+	mux.HandleFunc("GET /admin/images/{id}/original", ro.adminOnly(ro.adminOriginal))
+	mux.HandleFunc("GET /admin/trash", ro.adminOnly(ro.adminTrash))
+	mux.HandleFunc("GET /admin/audit", ro.adminOnly(ro.adminAudit))
+	mux.HandleFunc("GET /admin/backup", ro.adminOnly(ro.adminBackup))
+	mux.HandleFunc("GET /admin/export", ro.adminOnly(ro.adminExport))
+	mux.HandleFunc("GET /admin/duplicates", ro.adminOnly(ro.adminDuplicates))
+	mux.HandleFunc("POST /admin/duplicates/keep-one", ro.adminOnly(ro.keepOneDuplicate))
+	mux.HandleFunc("POST /admin/duplicates/keep-both", ro.adminOnly(ro.keepBothDuplicates))
+	mux.HandleFunc("GET /api/images", ro.apiListImages)
 	mux.HandleFunc("GET /api/images/{id}", ro.apiGetImage)
+	mux.HandleFunc("GET /api/stats", ro.apiStats)
 	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 
 	return ro
 }
 
+// SouthAmerica is the slug of the album the site started out with, its
+// routes from before albums existed are still served under /south-america
+const SouthAmerica = "south-america"
+
 type Router struct {
 	*http.ServeMux
 	Services
 	Options
 }
 
+// inAlbum serves a handler that expects a {slug} path value from a route without one
+func inAlbum(slug string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("slug", slug)
+		h(w, r)
+	}
+}
+
+// AlbumURL is the path of an album's page, the album's other routes are beneath it
+func AlbumURL(slug string) string {
+	return fmt.Sprintf("/albums/%s", slug)
+}
+
 func (ro *Router) index(w http.ResponseWriter, r *http.Request) {
-	if !ro.IncludeIndexPage {
-		http.Redirect(w, r, "/south-america", http.StatusFound)
+	albums, err := ro.ImageTable.ListAlbumsContext(r.Context())
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), errorCode(err))
+		return
+	}
+
+	if !ro.IncludeIndexPage && len(albums) > 0 {
+		http.Redirect(w, r, AlbumURL(albums[0].Slug), http.StatusFound)
 		return
 	}
 
@@ -73,10 +136,32 @@ func (ro *Router) index(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tmpl.Execute(w, nil)
+	tmpl.Execute(w, IndexPage{Albums: albums})
 }
 
-func (ro *Router) southAmerica(w http.ResponseWriter, r *http.Request) {
+// getAlbum gets the album for the {slug} path value, responding with an
+// error if it can't
+func (ro *Router) getAlbum(w http.ResponseWriter, r *http.Request) (db.Album, bool) {
+	album, err := ro.ImageTable.GetAlbumContext(r.Context(), r.PathValue("slug"))
+	if err == db.AlbumNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return db.Album{}, false
+	}
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), errorCode(err))
+		return db.Album{}, false
+	}
+	return album, true
+}
+
+func (ro *Router) album(w http.ResponseWriter, r *http.Request) {
+	album, ok := ro.getAlbum(w, r)
+	if !ok {
+		return
+	}
+	albumURL := AlbumURL(album.Slug)
+
 	countriesParam := r.URL.Query().Get("countries")
 
 	var countries []string
@@ -84,6 +169,40 @@ func (ro *Router) southAmerica(w http.ResponseWriter, r *http.Request) {
 		countries = strings.Split(countriesParam, ",")
 	}
 
+	localities := parseLocalities(r.URL.Query().Get("localities"))
+
+	country, locality, ok := ro.getPlace(w, r)
+	if !ok {
+		return
+	}
+	if len(country) > 0 && !slices.Contains(countries, country) {
+		countries = append(countries, country)
+	}
+	place := db.Place{Country: country, Locality: locality}
+	if len(locality) > 0 && !slices.Contains(localities, place) {
+		localities = append(localities, place)
+	}
+
+	tagsParam := r.URL.Query().Get("tags")
+
+	var tags []string
+	if len(tagsParam) > 0 {
+		tags = strings.Split(tagsParam, ",")
+	}
+
+	tagMatch := db.MatchAnyTag
+	if r.URL.Query().Get("tagMatch") == string(db.MatchAllTags) {
+		tagMatch = db.MatchAllTags
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	tmpl := ro.Templates.Lookup("south-america.html")
 	if tmpl == nil {
 		log.Println("south-america.html template not found")
@@ -99,62 +218,64 @@ func (ro *Router) southAmerica(w http.ResponseWriter, r *http.Request) {
 		opts.Order = db.DESC
 	}
 
+	// filters are shared by every list on the page so they carry over in the cursors
+	filters := []db.GetListOptsFn{
+		db.WithCountries(countries...),
+		db.WithLocalities(localities...),
+		db.WithAlbum(album.Slug),
+	}
+	if len(tags) > 0 {
+		filters = append(filters, db.WithTags(tagMatch, tags...))
+	}
+	if len(query) > 0 {
+		filters = append(filters, db.WithQuery(query))
+	}
+	if !from.IsZero() || !to.IsZero() {
+		filters = append(filters, db.WithDateRange(from, to))
+	}
+
 	var previousCursor string
 	var nextCursor string
 	var imgs []db.Image
-	var err error
 	if !r.URL.Query().Has("jumpTo") {
-		list, gerr := ro.ImageTable.GetList(
-			db.WithOrder(opts.Order),
-			db.WithCountries(countries...),
+		list, gerr := ro.ImageTable.GetListContext(r.Context(),
+			append(filters, db.WithOrder(opts.Order))...,
 		)
 
 		imgs = list.Images
 		err = gerr
-		nextCursor = list.Cursor.EncodedString()
+		if gerr == nil {
+			nextCursor = list.Cursor.EncodedString()
+		}
 
 	} else {
-		jumpTo, err := ro.ImageTable.GetByID(r.URL.Query().Get("jumpTo"))
+		jumpTo, err := ro.ImageTable.GetByIDContext(r.Context(), r.URL.Query().Get("jumpTo"))
 		if err != nil {
 			log.Println(err.Error())
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), errorCode(err))
 			return
 		}
 
 		reversedOrder := reverseOrder(opts.Order)
-		pc, err := db.NewCursor(db.GetListOpts{
-			Order:        reversedOrder,
-			Countries:    countries,
-			ExclStartKey: jumpTo.ID,
-			Limit:        6,
-		})
-		if err != nil {
-			log.Println(err.Error())
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		prevList, err := ro.ImageTable.GetList(db.WithCursor(pc))
+		prevList, err := ro.ImageTable.GetListContext(r.Context(), append(filters,
+			db.WithOrder(reversedOrder),
+			db.WithExclStartImage(jumpTo),
+			db.WithLimit(6),
+		)...)
 		if err != nil {
 			log.Println(err.Error())
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), listErrorCode(err))
 			return
 		}
 
-		nc, err := db.NewCursor(db.GetListOpts{
-			Order:        opts.Order,
-			Countries:    countries,
-			ExclStartKey: jumpTo.ID,
-			Limit:        6,
-		})
-		if err != nil {
-			log.Println(err.Error())
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		nextList, err := ro.ImageTable.GetList(db.WithCursor(nc))
+		nextList, err := ro.ImageTable.GetListContext(r.Context(), append(filters,
+			db.WithOrder(opts.Order),
+			db.WithExclStartImage(jumpTo),
+			db.WithLimit(6),
+		)...)
 		if err != nil {
 			log.Println(err.Error())
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), listErrorCode(err))
 			return
 		}
 
@@ -167,11 +288,18 @@ func (ro *Router) southAmerica(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Println(err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), listErrorCode(err))
 		return
 	}
 
-	imgPage := ImagesPage{}
+	imgPage := ImagesPage{
+		Title:       album.Name,
+		AlbumURL:    albumURL,
+		TagMatchAll: tagMatch == db.MatchAllTags,
+		Query:       query,
+		From:        r.URL.Query().Get("from"),
+		To:          r.URL.Query().Get("to"),
+	}
 
 	deleteEnabled := detemineIsAdmin(r, ro.Admins)
 
@@ -181,16 +309,24 @@ func (ro *Router) southAmerica(w http.ResponseWriter, r *http.Request) {
 		imgPage.OrderBy = "oldest"
 	}
 
-	imgPage.Images = ToImageListItems(imgs, deleteEnabled, previousCursor, nextCursor)
+	imgPage.Images = ToImageListItems(imgs, albumURL, deleteEnabled, previousCursor, nextCursor)
 
-	countryFilters := NewCountryFilters()
-	for i, c := range countryFilters {
-		if strings.Contains(countriesParam, c.Value) {
-			countryFilters[i].Checked = true
-		}
+	facets, err := ro.ImageTable.FacetsContext(r.Context(), filters...)
+	if err != nil {
+		log.Println(err.Error())
 	}
+	imgPage.CountryFilters = NewCountryFilters(facets, albumURL, countries, localities)
 
-	imgPage.CountryFilters = countryFilters
+	allTags, err := ro.ImageTable.GetTagsContext(r.Context())
+	if err != nil {
+		log.Println(err.Error())
+	}
+	for _, t := range allTags {
+		imgPage.TagFilters = append(imgPage.TagFilters, TagFilter{
+			Value:   t,
+			Checked: slices.Contains(tags, t),
+		})
+	}
 
 	err = tmpl.Execute(w, imgPage)
 	if err != nil {
@@ -199,7 +335,87 @@ func (ro *Router) southAmerica(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func (ro *Router) southAmericaList(w http.ResponseWriter, r *http.Request) {
+// getPlace gets the country and locality names for the {country} and
+// {locality} path values of links like /south-america/chile/puerto-natales,
+// responding with not found if there are no images there. The names are
+// blank when the path values aren't set.
+func (ro *Router) getPlace(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	countrySlug, localitySlug := r.PathValue("country"), r.PathValue("locality")
+	if len(countrySlug) == 0 {
+		return "", "", true
+	}
+
+	places, err := ro.ImageTable.GetLocalitiesContext(r.Context())
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), errorCode(err))
+		return "", "", false
+	}
+
+	for _, p := range places {
+		if db.Slug(p.Country) != countrySlug {
+			continue
+		}
+		if len(localitySlug) == 0 {
+			return p.Country, "", true
+		}
+		for _, l := range p.Localities {
+			if db.Slug(l) == localitySlug {
+				return p.Country, l, true
+			}
+		}
+	}
+
+	http.Error(w, "place not found", http.StatusNotFound)
+	return "", "", false
+}
+
+// parseDateRange reads the from and to query params, these are dates
+// like 2024-03-01 and to includes the whole of its day. Params that
+// aren't given are returned as the zero time.
+func parseDateRange(r *http.Request) (from time.Time, to time.Time, err error) {
+	if f := r.URL.Query().Get("from"); len(f) > 0 {
+		from, err = time.Parse(time.DateOnly, f)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("from must be a date like 2024-03-01: %w", err)
+		}
+	}
+	if t := r.URL.Query().Get("to"); len(t) > 0 {
+		to, err = time.Parse(time.DateOnly, t)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("to must be a date like 2024-03-01: %w", err)
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
+
+// listErrorCode is the status code for an error from ImageTable.GetList,
+// bad filters are the client's fault
+func listErrorCode(err error) int {
+	if errors.Is(err, db.InvalidTag) || errors.Is(err, db.InvalidCursor) || errors.Is(err, db.InvalidDateRange) ||
+		errors.Is(err, db.InvalidBounds) || errors.Is(err, db.InvalidRadius) {
+		return http.StatusBadRequest
+	}
+	return errorCode(err)
+}
+
+// errorCode is the status code for any other error, queries that run out
+// of time are the database being too busy rather than broken
+func errorCode(err error) int {
+	if db.IsTimeout(err) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func (ro *Router) albumList(w http.ResponseWriter, r *http.Request) {
+	album, ok := ro.getAlbum(w, r)
+	if !ok {
+		return
+	}
+	albumURL := AlbumURL(album.Slug)
+
 	cursor := r.URL.Query().Get("cursor")
 	pagination := r.URL.Query().Get("pagination")
 	if pagination != "reverse" {
@@ -212,12 +428,24 @@ func (ro *Router) southAmericaList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	list, err := ro.ImageTable.GetList(
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := []db.GetListOptsFn{
 		db.WithCursorStr(cursor),
-	)
+		db.WithAlbum(album.Slug),
+	}
+	if !from.IsZero() || !to.IsZero() {
+		opts = append(opts, db.WithDateRange(from, to))
+	}
+
+	list, err := ro.ImageTable.GetListContext(r.Context(), opts...)
 	if err != nil {
 		log.Println(err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), listErrorCode(err))
 		return
 	}
 
@@ -227,9 +455,9 @@ func (ro *Router) southAmericaList(w http.ResponseWriter, r *http.Request) {
 
 	if pagination == "reverse" {
 		slices.Reverse(list.Images)
-		il.Images = ToImageListItems(list.Images, deleteEnabled, list.Cursor.EncodedString(), "")
+		il.Images = ToImageListItems(list.Images, albumURL, deleteEnabled, list.Cursor.EncodedString(), "")
 	} else {
-		il.Images = ToImageListItems(list.Images, deleteEnabled, "", list.Cursor.EncodedString())
+		il.Images = ToImageListItems(list.Images, albumURL, deleteEnabled, "", list.Cursor.EncodedString())
 	}
 
 	err = tmpl.Execute(w, il)
@@ -238,7 +466,7 @@ func (ro *Router) southAmericaList(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (ro *Router) southAmericaImage(w http.ResponseWriter, r *http.Request) {
+func (ro *Router) albumImage(w http.ResponseWriter, r *http.Request) {
 	tmpl := ro.Templates.Lookup("south-america-image.html")
 	if tmpl == nil {
 		log.Println("south-america-image.html template not found")
@@ -246,53 +474,74 @@ func (ro *Router) southAmericaImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	album, ok := ro.getAlbum(w, r)
+	if !ok {
+		return
+	}
+	albumURL := AlbumURL(album.Slug)
+
 	id := r.PathValue("id")
 
-	img, err := ro.ImageTable.GetByID(id)
+	img, err := ro.ImageTable.GetByIDContext(r.Context(), id)
 	if err != nil {
 		log.Println(err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorCode(err))
 		return
 	}
 
+	title := fmt.Sprintf("%s %s", album.Name, img.ID)
+	if len(img.Title) > 0 {
+		title = fmt.Sprintf("%s - %s", img.Title, album.Name)
+	}
+
 	data := ImagePage{
 		ID:        img.ID,
-		Title:     fmt.Sprintf("South America %s", img.ID),
+		Title:     title,
+		Heading:   img.Title,
+		Caption:   img.Caption,
+		AltText:   altText(img),
+		AlbumURL:  albumURL,
 		ImageURL:  fmt.Sprintf("/images/%s", img.ID),
+		SrcSet:    srcSet(img),
 		Width:     img.Width,
 		Height:    img.Height,
 		ThumbHash: img.ThumbHash,
 	}
 
-	prev, err := ro.ImageTable.GetList(db.WithDescOrder(), db.WithLimit(1), db.WithExclStartKey(img.ID))
+	prev, err := ro.ImageTable.GetListContext(r.Context(), db.WithDescOrder(), db.WithLimit(1), db.WithExclStartImage(img), db.WithAlbum(album.Slug))
 	if err != nil {
 		log.Println(err.Error())
 	} else if len(prev.Images) == 1 {
-		data.PrevURL = fmt.Sprintf("/south-america/images/%s", prev.Images[0].ID)
+		data.PrevURL = fmt.Sprintf("%s/images/%s", albumURL, prev.Images[0].ID)
 	}
 
-	next, err := ro.ImageTable.GetList(db.WithAscOrder(), db.WithLimit(1), db.WithExclStartKey(img.ID))
+	next, err := ro.ImageTable.GetListContext(r.Context(), db.WithAscOrder(), db.WithLimit(1), db.WithExclStartImage(img), db.WithAlbum(album.Slug))
 	if err != nil {
 		log.Println(err.Error())
 	} else if len(next.Images) == 1 {
-		data.NextURL = fmt.Sprintf("/south-america/images/%s", next.Images[0].ID)
+		data.NextURL = fmt.Sprintf("%s/images/%s", albumURL, next.Images[0].ID)
 	}
 
 	err = tmpl.Execute(w, data)
 	if err != nil {
 		log.Println(err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorCode(err))
 		return
 	}
 }
 
 func (ro *Router) putImages(w http.ResponseWriter, r *http.Request) {
+	album, ok := ro.getAlbum(w, r)
+	if !ok {
+		return
+	}
+
 	canDelete := detemineIsAdmin(r, ro.Admins)
 
 	mr, err := r.MultipartReader()
 	if err != nil {
 		log.Println(err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorCode(err))
 		return
 	}
 
@@ -310,7 +559,7 @@ func (ro *Router) putImages(w http.ResponseWriter, r *http.Request) {
 		log.Printf("uploaded File: %+v\n", part.FileName())
 		log.Printf("MIME header: %+v\n", part.Header)
 
-		img, err := ro.saveImage(part)
+		img, err := ro.saveImage(r.Context(), part)
 		if err == db.DuplicateImage {
 			log.Println("dupe image")
 			continue
@@ -318,11 +567,20 @@ func (ro *Router) putImages(w http.ResponseWriter, r *http.Request) {
 
 		if err != nil {
 			log.Print(err.Error())
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), errorCode(err))
+			return
+		}
+
+		ro.audit(r, db.AuditCreate, img.ID, nil, &img)
+
+		err = ro.ImageTable.AddToAlbumContext(r.Context(), album.Slug, img.ID)
+		if err != nil {
+			log.Print(err.Error())
+			http.Error(w, err.Error(), errorCode(err))
 			return
 		}
 
-		items = append(items, ToImageListItem(img, canDelete))
+		items = append(items, ToImageListItem(img, AlbumURL(album.Slug), canDelete))
 	}
 
 	w.WriteHeader(http.StatusCreated)
@@ -332,19 +590,29 @@ func (ro *Router) putImages(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func (ro *Router) saveImage(imageFile io.Reader) (db.Image, error) {
+func (ro *Router) saveImage(ctx context.Context, imageFile io.Reader) (db.Image, error) {
 	img, err := ro.ImageFileStore.Save(imageFile)
 	if err != nil {
 		err = fmt.Errorf("could not save image file: %w", err)
 		return db.Image{}, err
 	}
 
+	// skip geocoding images we already have
+	_, err = ro.ImageTable.GetByIDContext(ctx, img.ID)
+	if err == nil {
+		return db.Image{ID: img.ID}, db.DuplicateImage
+	}
+	if err != db.NotFound {
+		return db.Image{}, fmt.Errorf("could not check for image %s: %w", img.ID, err)
+	}
+
 	dbImg := db.Image{
 		ID:         img.ID,
 		MimeType:   img.MimeType,
 		Width:      img.Width,
 		Height:     img.Height,
 		ThumbHash:  img.ThumbHash,
+		DHash:      img.DHash,
 		Lat:        img.Lat,
 		Long:       img.Long,
 		UploadedAt: time.Now(),
@@ -354,7 +622,7 @@ func (ro *Router) saveImage(imageFile io.Reader) (db.Image, error) {
 	if img.Lat != 0 && img.Long != 0 {
 
 		if ro.MapsClient != nil {
-			res, err := ro.MapsClient.Geocode(context.Background(), &maps.GeocodingRequest{
+			res, err := ro.MapsClient.Geocode(ctx, &maps.GeocodingRequest{
 				LatLng: &maps.LatLng{Lat: img.Lat, Lng: img.Long},
 			})
 			if err != nil {
@@ -373,9 +641,9 @@ func (ro *Router) saveImage(imageFile io.Reader) (db.Image, error) {
 
 	}
 
-	err = ro.ImageTable.Save(dbImg)
+	err = ro.ImageTable.InsertContext(ctx, dbImg)
 	if err == db.DuplicateImage {
-		return db.Image{}, err
+		return db.Image{ID: img.ID}, err
 	}
 	if err != nil {
 		err = fmt.Errorf("could not save image %s to table: %w", img.ID, err)
@@ -387,7 +655,12 @@ func (ro *Router) saveImage(imageFile io.Reader) (db.Image, error) {
 func (ro *Router) postImage(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	img, err := ro.saveImage(r.Body)
+	img, err := ro.saveImage(r.Context(), r.Body)
+	if err == db.DuplicateImage {
+		w.Header().Add("Location", fmt.Sprintf("/images/%s", img.ID))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 	if err != nil {
 		var exists image.ErrExist
 		if errors.As(err, &exists) {
@@ -396,26 +669,73 @@ func (ro *Router) postImage(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		log.Print(err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorCode(err))
 		return
 	}
 
+	ro.audit(r, db.AuditCreate, img.ID, nil, &img)
+
+	if slug := r.URL.Query().Get("album"); len(slug) > 0 {
+		err = ro.ImageTable.AddToAlbumContext(r.Context(), slug, img.ID)
+		if err == db.AlbumNotFound {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Print(err.Error())
+			http.Error(w, err.Error(), errorCode(err))
+			return
+		}
+	}
+
 	w.Header().Add("Location", fmt.Sprintf("/images/%s", img.ID))
 	w.WriteHeader(http.StatusCreated)
 	log.Println("created image: ", img.ID)
 }
 
+// getImage serves the image file, resized when the w query param is one
+// of image.RenditionWidths and converted to WebP or AVIF when the Accept
+// header says the browser can show them. Metadata the privacy policy
+// doesn't keep is stripped, admins can get the original from
+// adminOriginal.
 func (ro *Router) getImage(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 
-	fileBytes, err := ro.ImageFileStore.ReadFile(id)
+	rendition := image.Rendition{Format: acceptedFormat(r.Header.Get("Accept"))}
+	if width := r.URL.Query().Get("w"); len(width) > 0 {
+		n, err := strconv.Atoi(width)
+		if err != nil || !slices.Contains(image.RenditionWidths, n) {
+			http.Error(w, fmt.Sprintf("w must be one of %v", image.RenditionWidths), http.StatusBadRequest)
+			return
+		}
+		rendition.Width = n
+	}
+
+	// trashed images aren't in the table, only admins can see them on the
+	// trash page and the file store finds their format itself
+	original := image.Original{}
+	img, err := ro.ImageTable.GetByIDContext(r.Context(), id)
+	switch {
+	case err == nil:
+		original = image.Original{Format: strings.TrimPrefix(img.MimeType, "image/"), Width: img.Width}
+	case err == db.NotFound && !detemineIsAdmin(r, ro.Admins):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != db.NotFound:
+		msg := fmt.Sprintf("could not get image %s from table: %s", id, err.Error())
+		log.Println(msg)
+		http.Error(w, msg, errorCode(err))
+		return
+	}
+
+	fileBytes, mimeType, err := ro.ImageFileStore.ReadRendition(id, original, rendition)
 	if err != nil {
 		code := http.StatusInternalServerError
 		if image.IsNotFound(err) {
 			code = http.StatusNotFound
 
 			// need to keep table consistent
-			delErr := ro.ImageTable.Delete(id)
+			delErr := ro.ImageTable.DeleteContext(r.Context(), id)
 			if delErr != nil {
 				log.Printf("could not delete %s from table: %s\n", id, delErr.Error())
 
@@ -426,56 +746,152 @@ func (ro *Router) getImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fileBytes, err = image.StripMetadata(fileBytes, strings.TrimPrefix(mimeType, "image/"), ro.privacy())
+	if err != nil {
+		log.Printf("could not strip metadata from %s: %s\n", id, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Vary", "Accept")
 	w.Header().Add("Cache-Control", "private, max-age=2628288, immutable")
 	w.Write(fileBytes)
 }
 
+// modernFormats are the formats images are converted to, smallest first
+var modernFormats = []string{image.AVIF, image.WebP}
+
+// acceptedFormat is the first of the modernFormats the Accept header
+// names, or empty to keep the image's own format. Wildcards aren't
+// counted as browsers send image/* whether they can show AVIF or not.
+func acceptedFormat(accept string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && k == "q" {
+				q, _ = strconv.ParseFloat(v, 64)
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(mediaType))] = q > 0
+	}
+
+	for _, format := range modernFormats {
+		if accepted[image.MimeType(format)] {
+			return format
+		}
+	}
+	return ""
+}
+
+// patchImage applies a JSON merge patch to an image and responds with
+// the updated image, see imagePatch for what can be changed
 func (ro *Router) patchImage(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 
-	imgPatch := db.Image{}
+	body := map[string]json.RawMessage{}
 
 	dec := json.NewDecoder(r.Body)
 
-	err := dec.Decode(&imgPatch)
+	err := dec.Decode(&body)
+	if err != nil {
+		http.Error(w, "body must be a JSON object: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	img, err := ro.ImageTable.GetByIDContext(r.Context(), id)
+	if err == db.NotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), errorCode(err))
+		return
+	}
+
+	patch, err := parseImagePatch(body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	imgPatch.ID = id
-	err = ro.ImageTable.Save(imgPatch)
+	before := img
+
+	// the fields and tags are saved together so a patch is either applied
+	// whole or not at all
+	changed := patch.apply(&img)
+	switch {
+	case patch.changesTags():
+		err = ro.ImageTable.UpdateWithTagsContext(r.Context(), img, patch.patchedTags(img.Tags)...)
+	case changed:
+		err = ro.ImageTable.UpdateContext(r.Context(), img)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Println(err.Error())
+		http.Error(w, err.Error(), tagErrorCode(err))
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	img, err = ro.ImageTable.GetByIDContext(r.Context(), id)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), errorCode(err))
+		return
+	}
+
+	if changed || !slices.Equal(before.Tags, img.Tags) {
+		ro.audit(r, db.AuditUpdate, id, &before, &img)
+	}
+
+	ro.publicLocation(r, &img)
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err = enc.Encode(img)
+	if err != nil {
+		log.Println(err.Error())
+	}
 }
 
+func tagErrorCode(err error) int {
+	if errors.Is(err, db.InvalidTag) {
+		return http.StatusBadRequest
+	}
+	if err == db.NotFound {
+		return http.StatusNotFound
+	}
+	return errorCode(err)
+}
+
+// deleteImage moves an image to the trash, its file is kept until the
+// trash is purged so it can be restored
 func (ro *Router) deleteImage(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
-	err := ro.ImageTable.Delete(id)
-	if err != nil {
-		msg := fmt.Sprintf("could not delete image %s from table: %s", id, err.Error())
-		log.Println(msg)
-		http.Error(w, msg, http.StatusInternalServerError)
+	img, err := ro.ImageTable.GetByIDContext(r.Context(), id)
+	if err == nil {
+		err = ro.ImageTable.TrashContext(r.Context(), id)
+	}
+	if err == db.NotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-
-	err = ro.ImageFileStore.Delete(id)
 	if err != nil {
-		msg := fmt.Sprintf("could not delete image file %s: %s", id, err.Error())
+		msg := fmt.Sprintf("could not trash image %s: %s", id, err.Error())
 		log.Println(msg)
-		http.Error(w, msg, http.StatusInternalServerError)
+		http.Error(w, msg, errorCode(err))
 		return
 	}
+
+	ro.audit(r, db.AuditDelete, id, &img, nil)
 	w.WriteHeader(http.StatusOK)
 }
 
 func (ro *Router) apiGetImage(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
-	img, err := ro.ImageTable.GetByID(id)
+	img, err := ro.ImageTable.GetByIDContext(r.Context(), id)
 	if err != nil {
 		if err == db.NotFound {
 			http.Error(w, err.Error(), http.StatusNotFound)
@@ -483,19 +899,233 @@ func (ro *Router) apiGetImage(w http.ResponseWriter, r *http.Request) {
 		}
 		msg := fmt.Sprintf("could not get image %s from table: %s", id, err.Error())
 		log.Println(msg)
-		http.Error(w, msg, http.StatusInternalServerError)
+		http.Error(w, msg, errorCode(err))
 		return
 	}
 
+	ro.publicLocation(r, &img)
 	enc := json.NewEncoder(w)
 	err = enc.Encode(img)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorCode(err))
 	} else {
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
+// ImagesResponse is a page of images from the api, the cursor gets the
+// next page
+type ImagesResponse struct {
+	Images []db.Image `json:"images"`
+	Cursor string     `json:"cursor"`
+}
+
+// defaultAPILimit and maxAPILimit are how many images the api returns
+// at once, a map view wants more than a page of the gallery
+const defaultAPILimit = 100
+const maxAPILimit = 500
+
+// apiListImages lists images in an area for the map view. The area is
+// either bbox=west,south,east,north or near=lat,long with km, and the
+// cursor of the response continues the same list. People who aren't
+// admins can only search as finely as the privacy policy shows locations.
+func (ro *Router) apiListImages(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	exact := ro.exactLocations(r)
+
+	if !exact && ro.privacy() == image.PrivacyStrict && (q.Has("bbox") || q.Has("near")) {
+		http.Error(w, "only admins can search by location", http.StatusForbidden)
+		return
+	}
+
+	opts := []db.GetListOptsFn{}
+	if cursor := q.Get("cursor"); len(cursor) > 0 {
+		opts = append(opts, db.WithCursorStr(cursor))
+	} else {
+		opts = append(opts, db.WithLimit(defaultAPILimit))
+	}
+
+	if album := q.Get("album"); len(album) > 0 {
+		opts = append(opts, db.WithAlbum(album))
+	}
+
+	if q.Has("limit") {
+		limit, err := strconv.Atoi(q.Get("limit"))
+		if err != nil || limit < 1 || limit > maxAPILimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxAPILimit), http.StatusBadRequest)
+			return
+		}
+		opts = append(opts, db.WithLimit(limit))
+	}
+
+	if q.Has("bbox") {
+		fs, err := parseFloats(q.Get("bbox"), 4)
+		if err != nil {
+			http.Error(w, "bbox must be west,south,east,north: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		bounds := db.Bounds{West: fs[0], South: fs[1], East: fs[2], North: fs[3]}
+		if !exact {
+			bounds = publicBounds(bounds)
+		}
+		opts = append(opts, db.WithBounds(bounds))
+	}
+
+	if q.Has("near") {
+		fs, err := parseFloats(q.Get("near"), 2)
+		if err != nil {
+			http.Error(w, "near must be lat,long: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		km, err := strconv.ParseFloat(q.Get("km"), 64)
+		if err != nil {
+			http.Error(w, "km must be a number with near", http.StatusBadRequest)
+			return
+		}
+		radius := db.Radius{Lat: fs[0], Long: fs[1], Km: km}
+		if !exact {
+			radius = publicRadius(radius)
+		}
+		opts = append(opts, db.WithRadius(radius))
+	}
+
+	list, err := ro.ImageTable.GetListContext(r.Context(), opts...)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), listErrorCode(err))
+		return
+	}
+
+	for i := range list.Images {
+		ro.publicLocation(r, &list.Images[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err = enc.Encode(ImagesResponse{
+		Images: list.Images,
+		Cursor: list.Cursor.EncodedString(),
+	})
+	if err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// parseFloats parses n comma separated numbers
+func parseFloats(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("expected %d numbers", n)
+	}
+
+	fs := make([]float64, n)
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, err
+		}
+		fs[i] = f
+	}
+	return fs, nil
+}
+
+func (ro *Router) apiListAlbums(w http.ResponseWriter, r *http.Request) {
+	albums, err := ro.ImageTable.ListAlbumsContext(r.Context())
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), errorCode(err))
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	err = enc.Encode(albums)
+	if err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func (ro *Router) apiCreateAlbum(w http.ResponseWriter, r *http.Request) {
+	body := db.Album{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	album, err := ro.ImageTable.CreateAlbumContext(r.Context(), body.Slug, body.Name)
+	if err == db.InvalidSlug {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == db.DuplicateAlbum {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), errorCode(err))
+		return
+	}
+
+	w.Header().Add("Location", AlbumURL(album.Slug))
+	w.WriteHeader(http.StatusCreated)
+	enc := json.NewEncoder(w)
+	err = enc.Encode(album)
+	if err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func (ro *Router) apiRenameAlbum(w http.ResponseWriter, r *http.Request) {
+	slug := r.PathValue("slug")
+
+	body := db.Album{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = ro.ImageTable.RenameAlbumContext(r.Context(), slug, body.Name)
+	if err == db.AlbumNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), errorCode(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiReorderAlbums takes a JSON array of album slugs in the order they should be shown
+func (ro *Router) apiReorderAlbums(w http.ResponseWriter, r *http.Request) {
+	slugs := []string{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(&slugs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = ro.ImageTable.ReorderAlbumsContext(r.Context(), slugs...)
+	if errors.Is(err, db.AlbumNotFound) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), errorCode(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func printJSON(d any) {
 	b, err := json.MarshalIndent(d, "", "\t")
 	if err != nil {
@@ -504,9 +1134,20 @@ func printJSON(d any) {
 	fmt.Print(string(b))
 }
 
+type IndexPage struct {
+	Albums []db.Album
+}
+
 type ImagesPage struct {
+	Title          string
+	AlbumURL       string
 	OrderBy        string
 	CountryFilters []CountryFilter
+	TagFilters     []TagFilter
+	TagMatchAll    bool
+	Query          string
+	From           string
+	To             string
 	Images         []ImageListItem
 	UploadEnabled  bool
 }
@@ -514,7 +1155,12 @@ type ImagesPage struct {
 type ImagePage struct {
 	ID        string
 	Title     string
+	Heading   string
+	Caption   string
+	AltText   string
+	AlbumURL  string
 	ImageURL  string
+	SrcSet    string
 	Width     int
 	Height    int
 	ThumbHash string
@@ -525,20 +1171,103 @@ type ImagePage struct {
 type CountryFilter struct {
 	Value   string
 	Display string
+	URL     string
+	Count   int
 	Checked bool
+	// Open is whether the country is expanded to show its localities
+	Open       bool
+	Localities []LocalityFilter
+}
+
+type LocalityFilter struct {
+	Value string
+	// Param is the value in the localities parameter, Country|Locality
+	Param   string
+	URL     string
+	Count   int
+	Checked bool
+}
+
+// parseLocalities reads the localities parameter, a comma separated list
+// of Country|Locality. Bare locality names from older links are ignored as
+// they can't be scoped to a country.
+func parseLocalities(param string) []db.Place {
+	var places []db.Place
+	if len(param) == 0 {
+		return places
+	}
+	for _, p := range strings.Split(param, ",") {
+		country, locality, ok := strings.Cut(p, "|")
+		if !ok || len(country) == 0 || len(locality) == 0 {
+			continue
+		}
+		place := db.Place{Country: country, Locality: locality}
+		if !slices.Contains(places, place) {
+			places = append(places, place)
+		}
+	}
+	return places
+}
+
+// countryFlags are shown next to the countries we've been to so far
+var countryFlags = map[string]string{
+	"United States": "🇺🇸",
+	"Chile":         "🇨🇱",
+	"Argentina":     "🇦🇷",
+	"Bolivia":       "🇧🇴",
+	"Peru":          "🇵🇪",
+	"Colombia":      "🇨🇴",
+	"Costa Rica":    "🇨🇷",
+	"Nicaragua":     "🇳🇮",
 }
 
-func NewCountryFilters() []CountryFilter {
-	return []CountryFilter{
-		{"United States", "United States 🇺🇸", false},
-		{"Chile", "Chile 🇨🇱", false},
-		{"Argentina", "Argentina 🇦🇷", false},
-		{"Bolivia", "Bolivia 🇧🇴", false},
-		{"Peru", "Peru 🇵🇪", false},
-		{"Colombia", "Colombia 🇨🇴", false},
-		{"Costa Rica", "Costa Rica 🇨🇷", false},
-		{"Nicaragua", "Nicaragua 🇳🇮", false},
+// NewCountryFilters is a filter for every country in the facets with its
+// localities. Checked countries are kept even when nothing else matches
+// them so that they can be unchecked. URLs are the shareable links to a
+// country or locality in the album.
+func NewCountryFilters(facets db.Facets, albumURL string, checked []string, checkedLocalities []db.Place) []CountryFilter {
+	filters := []CountryFilter{}
+	for _, f := range facets.Countries {
+		cf := newCountryFilter(f.Country, albumURL, f.Count, checked)
+		for _, l := range f.Localities {
+			lf := LocalityFilter{
+				Value:   l.Locality,
+				Param:   f.Country + "|" + l.Locality,
+				URL:     fmt.Sprintf("%s/%s", cf.URL, db.Slug(l.Locality)),
+				Count:   l.Count,
+				Checked: slices.Contains(checkedLocalities, db.Place{Country: f.Country, Locality: l.Locality}),
+			}
+			cf.Open = cf.Open || lf.Checked
+			cf.Localities = append(cf.Localities, lf)
+		}
+		filters = append(filters, cf)
 	}
+	for _, c := range checked {
+		if !slices.ContainsFunc(filters, func(f CountryFilter) bool { return f.Value == c }) {
+			filters = append(filters, newCountryFilter(c, albumURL, 0, checked))
+		}
+	}
+	return filters
+}
+
+func newCountryFilter(country string, albumURL string, count int, checked []string) CountryFilter {
+	display := country
+	if flag, ok := countryFlags[country]; ok {
+		display = country + " " + flag
+	}
+	return CountryFilter{
+		Value:   country,
+		Display: display,
+		URL:     fmt.Sprintf("%s/%s", albumURL, db.Slug(country)),
+		Count:   count,
+		Checked: slices.Contains(checked, country),
+		Open:    slices.Contains(checked, country),
+	}
+}
+
+type TagFilter struct {
+	Value   string
+	Checked bool
 }
 
 type ImageListItem struct {
@@ -546,7 +1275,10 @@ type ImageListItem struct {
 	Width         int
 	Height        int
 	URL           string
+	ListURL       string
 	ImageURL      string
+	SrcSet        string
+	AltText       string
 	Thumbhash     string
 	DeleteEnabled bool
 
@@ -557,10 +1289,10 @@ type ImageListItem struct {
 	NextCursor  string
 }
 
-func ToImageListItems(imgs []db.Image, deleteEnabled bool, previousCursor string, nextCursor string) []ImageListItem {
+func ToImageListItems(imgs []db.Image, albumURL string, deleteEnabled bool, previousCursor string, nextCursor string) []ImageListItem {
 	imgItems := make([]ImageListItem, len(imgs))
 	for i, img := range imgs {
-		il := ToImageListItem(img, deleteEnabled)
+		il := ToImageListItem(img, albumURL, deleteEnabled)
 
 		if i == 0 && len(previousCursor) > 0 {
 			il.GetPreviousPage = true
@@ -578,19 +1310,48 @@ func ToImageListItems(imgs []db.Image, deleteEnabled bool, previousCursor string
 	return imgItems
 }
 
-func ToImageListItem(img db.Image, deleteEnabled bool) ImageListItem {
+func ToImageListItem(img db.Image, albumURL string, deleteEnabled bool) ImageListItem {
 	targetHeight := 350
 	return ImageListItem{
 		ID:            img.ID,
 		Width:         image.ResizeWidth(img.Width, img.Height, targetHeight),
 		Height:        targetHeight,
-		URL:           fmt.Sprintf("/south-america/images/%s", img.ID),
+		URL:           fmt.Sprintf("%s/images/%s", albumURL, img.ID),
+		ListURL:       fmt.Sprintf("%s/images/list", albumURL),
 		ImageURL:      fmt.Sprintf("/images/%s", img.ID),
+		SrcSet:        srcSet(img),
+		AltText:       altText(img),
 		Thumbhash:     img.ThumbHash,
 		DeleteEnabled: deleteEnabled,
 	}
 }
 
+// srcSet lists the renditions narrower than the image and then the
+// original, so browsers can pick the smallest that fills the space
+func srcSet(img db.Image) string {
+	if img.Width <= 0 {
+		return ""
+	}
+
+	sources := []string{}
+	for _, w := range image.RenditionWidths {
+		if w < img.Width {
+			sources = append(sources, fmt.Sprintf("/images/%s?w=%d %dw", img.ID, w, w))
+		}
+	}
+	sources = append(sources, fmt.Sprintf("/images/%s %dw", img.ID, img.Width))
+	return strings.Join(sources, ", ")
+}
+
+// altText describes an image for screen readers, falling back to its
+// title when no alt text has been written
+func altText(img db.Image) string {
+	if len(img.AltText) > 0 {
+		return img.AltText
+	}
+	return img.Title
+}
+
 func reverseOrder(order db.Order) db.Order {
 	if order == db.ASC {
 		return db.DESC
@@ -2,25 +2,34 @@ package router_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
+	goimage "image"
+	"image/jpeg"
 	"io"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"regexp"
 	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/rwcarlsen/goexif/exif"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/wobwainwwight/sa-photos/db"
 	"github.com/wobwainwwight/sa-photos/db/dbtest"
+	"github.com/wobwainwwight/sa-photos/image"
 	"github.com/wobwainwwight/sa-photos/image/imagetest"
 	"github.com/wobwainwwight/sa-photos/router"
 	"github.com/wobwainwwight/sa-photos/templates"
@@ -38,6 +47,16 @@ func TestRouter(t *testing.T) {
 	}
 
 	dbtest.GivenSaved(t, table, dbtest.SpaceByHour(imgs)...)
+	dbtest.GivenInAlbum(t, table, router.SouthAmerica, imgs...)
+
+	// every other image is also in the patagonia album
+	patagonia := []db.Image{}
+	for i := 0; i < len(imgs); i += 2 {
+		patagonia = append(patagonia, imgs[i])
+	}
+	_, err := table.CreateAlbum("patagonia", "Patagonia")
+	require.NoError(t, err)
+	dbtest.GivenInAlbum(t, table, "patagonia", patagonia...)
 
 	tmpl, err := templates.GetTemplates()
 	require.NoError(t, err)
@@ -50,34 +69,77 @@ func TestRouter(t *testing.T) {
 		IncludeIndexPage: false,
 	})
 
+	saURL := router.AlbumURL(router.SouthAmerica)
+	patagoniaURL := router.AlbumURL("patagonia")
+
+	saFacets, err := table.Facets(db.WithAlbum(router.SouthAmerica))
+	require.NoError(t, err)
+	patagoniaFacets, err := table.Facets(db.WithAlbum("patagonia"))
+	require.NoError(t, err)
+
 	scenarios := []scenario{
 		{
 			Method:         http.MethodGet,
 			URL:            "/south-america",
 			ExpectedStatus: 200,
 			ExpectedContent: templateBody(t, tmpl.Lookup("south-america.html"), router.ImagesPage{
+				Title:          "South America",
+				AlbumURL:       saURL,
+				OrderBy:        "oldest",
+				CountryFilters: router.NewCountryFilters(saFacets, saURL, nil, nil),
+				Images: router.ToImageListItems(imgs[:5], saURL, false, "", db.MustNewCursor(db.GetListOpts{
+					Order:              db.ASC,
+					ExclStartKey:       imgs[4].ID,
+					ExclStartCreatedAt: imgs[4].CreatedAt,
+					Limit:              5,
+					Album:              router.SouthAmerica,
+				}).EncodedString()),
+				UploadEnabled: false,
+			}),
+		},
+		{
+			Name:           "Album",
+			Method:         http.MethodGet,
+			URL:            patagoniaURL,
+			ExpectedStatus: 200,
+			ExpectedContent: templateBody(t, tmpl.Lookup("south-america.html"), router.ImagesPage{
+				Title:          "Patagonia",
+				AlbumURL:       patagoniaURL,
 				OrderBy:        "oldest",
-				CountryFilters: router.NewCountryFilters(),
-				Images: router.ToImageListItems(imgs[:5], false, "", db.MustNewCursor(db.GetListOpts{
-					Order:        db.ASC,
-					ExclStartKey: imgs[4].ID,
-					Limit:        5,
+				CountryFilters: router.NewCountryFilters(patagoniaFacets, patagoniaURL, nil, nil),
+				Images: router.ToImageListItems(patagonia[:5], patagoniaURL, false, "", db.MustNewCursor(db.GetListOpts{
+					Order:              db.ASC,
+					ExclStartKey:       patagonia[4].ID,
+					ExclStartCreatedAt: patagonia[4].CreatedAt,
+					Limit:              5,
+					Album:              "patagonia",
 				}).EncodedString()),
 				UploadEnabled: false,
 			}),
 		},
+		{
+			Name:            "AlbumNotFound",
+			Method:          http.MethodGet,
+			URL:             router.AlbumURL("antarctica"),
+			ExpectedStatus:  404,
+			ExpectedContent: "album not found\n",
+		},
 		{
 			Name:           "OrderLatest",
 			Method:         http.MethodGet,
 			URL:            "/south-america?order=latest",
 			ExpectedStatus: 200,
 			ExpectedContent: templateBody(t, tmpl.Lookup("south-america.html"), router.ImagesPage{
+				Title:          "South America",
+				AlbumURL:       saURL,
 				OrderBy:        "latest",
-				CountryFilters: router.NewCountryFilters(),
-				Images: router.ToImageListItems(reverse(imgs[95:]), false, "", db.MustNewCursor(db.GetListOpts{
-					Order:        db.DESC,
-					ExclStartKey: imgs[95].ID,
-					Limit:        5,
+				CountryFilters: router.NewCountryFilters(saFacets, saURL, nil, nil),
+				Images: router.ToImageListItems(reverse(imgs[95:]), saURL, false, "", db.MustNewCursor(db.GetListOpts{
+					Order:              db.DESC,
+					ExclStartKey:       imgs[95].ID,
+					ExclStartCreatedAt: imgs[95].CreatedAt,
+					Limit:              5,
+					Album:              router.SouthAmerica,
 				}).EncodedString()),
 				UploadEnabled: false,
 			}),
@@ -88,10 +150,33 @@ func TestRouter(t *testing.T) {
 			URL:            "/south-america/images/list",
 			ExpectedStatus: 200,
 			ExpectedContent: templateBody(t, tmpl.Lookup("image-list-items"), router.ImagesPage{
-				Images: router.ToImageListItems(imgs[:5], false, "", db.MustNewCursor(db.GetListOpts{
-					Order:        db.ASC,
-					ExclStartKey: imgs[4].ID,
-					Limit:        5,
+				Images: router.ToImageListItems(imgs[:5], saURL, false, "", db.MustNewCursor(db.GetListOpts{
+					Order:              db.ASC,
+					ExclStartKey:       imgs[4].ID,
+					ExclStartCreatedAt: imgs[4].CreatedAt,
+					Limit:              5,
+					Album:              router.SouthAmerica,
+				}).EncodedString()),
+			}),
+		},
+		{
+			Name:   "AlbumListWithCursor",
+			Method: http.MethodGet,
+			URL: fmt.Sprintf("%s/images/list?cursor=%s", patagoniaURL, db.MustNewCursor(db.GetListOpts{
+				ExclStartKey:       patagonia[10].ID,
+				ExclStartCreatedAt: patagonia[10].CreatedAt,
+				Limit:              10,
+				Order:              db.ASC,
+				Album:              "patagonia",
+			}).EncodedString()),
+			ExpectedStatus: 200,
+			ExpectedContent: templateBody(t, tmpl.Lookup("image-list-items"), router.ImagesPage{
+				Images: router.ToImageListItems(patagonia[11:21], patagoniaURL, false, "", db.MustNewCursor(db.GetListOpts{
+					Order:              db.ASC,
+					ExclStartKey:       patagonia[20].ID,
+					ExclStartCreatedAt: patagonia[20].CreatedAt,
+					Limit:              10,
+					Album:              "patagonia",
 				}).EncodedString()),
 			}),
 		},
@@ -99,16 +184,19 @@ func TestRouter(t *testing.T) {
 			Name:   "ListWithCursor",
 			Method: http.MethodGet,
 			URL: fmt.Sprintf("/south-america/images/list?cursor=%s", db.MustNewCursor(db.GetListOpts{
-				ExclStartKey: imgs[50].ID,
-				Limit:        10,
-				Order:        db.ASC,
+				ExclStartKey:       imgs[50].ID,
+				ExclStartCreatedAt: imgs[50].CreatedAt,
+				Limit:              10,
+				Order:              db.ASC,
 			}).EncodedString()),
 			ExpectedStatus: 200,
 			ExpectedContent: templateBody(t, tmpl.Lookup("image-list-items"), router.ImagesPage{
-				Images: router.ToImageListItems(imgs[51:61], false, "", db.MustNewCursor(db.GetListOpts{
-					Order:        db.ASC,
-					ExclStartKey: imgs[60].ID,
-					Limit:        10,
+				Images: router.ToImageListItems(imgs[51:61], saURL, false, "", db.MustNewCursor(db.GetListOpts{
+					Order:              db.ASC,
+					ExclStartKey:       imgs[60].ID,
+					ExclStartCreatedAt: imgs[60].CreatedAt,
+					Limit:              10,
+					Album:              router.SouthAmerica,
 				}).EncodedString()),
 			}),
 		},
@@ -116,16 +204,19 @@ func TestRouter(t *testing.T) {
 			Name:   "ReverseListWithCursor",
 			Method: http.MethodGet,
 			URL: fmt.Sprintf("/south-america/images/list?cursor=%s&pagination=reverse", db.MustNewCursor(db.GetListOpts{
-				ExclStartKey: imgs[50].ID,
-				Limit:        10,
-				Order:        db.ASC,
+				ExclStartKey:       imgs[50].ID,
+				ExclStartCreatedAt: imgs[50].CreatedAt,
+				Limit:              10,
+				Order:              db.ASC,
 			}).EncodedString()),
 			ExpectedStatus: 200,
 			ExpectedContent: templateBody(t, tmpl.Lookup("image-list-items"), router.ImagesPage{
-				Images: router.ToImageListItems(reverse(imgs[51:61]), false, db.MustNewCursor(db.GetListOpts{
-					Order:        db.ASC,
-					ExclStartKey: imgs[60].ID,
-					Limit:        10,
+				Images: router.ToImageListItems(reverse(imgs[51:61]), saURL, false, db.MustNewCursor(db.GetListOpts{
+					Order:              db.ASC,
+					ExclStartKey:       imgs[60].ID,
+					ExclStartCreatedAt: imgs[60].CreatedAt,
+					Limit:              10,
+					Album:              router.SouthAmerica,
 				}).EncodedString(), ""),
 			}),
 		},
@@ -137,14 +228,61 @@ func TestRouter(t *testing.T) {
 			ExpectedContent: templateBody(t, tmpl.Lookup("south-america-image.html"), router.ImagePage{
 				Title:     "South America " + imgs[10].ID,
 				ID:        imgs[10].ID,
+				AlbumURL:  saURL,
+				ImageURL:  fmt.Sprintf("/images/%s", imgs[10].ID),
+				SrcSet:    originalSrcSet(imgs[10]),
+				Width:     imgs[10].Width,
+				Height:    imgs[10].Height,
+				ThumbHash: imgs[10].ThumbHash,
+				PrevURL:   fmt.Sprintf("%s/images/%s", saURL, imgs[9].ID),
+				NextURL:   fmt.Sprintf("%s/images/%s", saURL, imgs[11].ID),
+			}),
+		},
+		{
+			Name:           "AlbumImagePage",
+			Method:         http.MethodGet,
+			URL:            fmt.Sprintf("%s/images/%s", patagoniaURL, imgs[10].ID),
+			ExpectedStatus: 200,
+			ExpectedContent: templateBody(t, tmpl.Lookup("south-america-image.html"), router.ImagePage{
+				Title:     "Patagonia " + imgs[10].ID,
+				ID:        imgs[10].ID,
+				AlbumURL:  patagoniaURL,
 				ImageURL:  fmt.Sprintf("/images/%s", imgs[10].ID),
+				SrcSet:    originalSrcSet(imgs[10]),
 				Width:     imgs[10].Width,
 				Height:    imgs[10].Height,
 				ThumbHash: imgs[10].ThumbHash,
-				PrevURL:   fmt.Sprintf("/south-america/images/%s", imgs[9].ID),
-				NextURL:   fmt.Sprintf("/south-america/images/%s", imgs[11].ID),
+				PrevURL:   fmt.Sprintf("%s/images/%s", patagoniaURL, imgs[8].ID),
+				NextURL:   fmt.Sprintf("%s/images/%s", patagoniaURL, imgs[12].ID),
 			}),
 		},
+		{
+			Name:           "Index",
+			Method:         http.MethodGet,
+			URL:            "/",
+			ExpectedStatus: 302,
+		},
+		{
+			Name:            "ListWithTamperedCursor",
+			Method:          http.MethodGet,
+			URL:             "/south-america/images/list?cursor=" + tamperedCursor(t, db.GetListOpts{Order: db.ASC, Limit: 5}, "o:ASC|l:100000"),
+			ExpectedStatus:  400,
+			ExpectedContent: "invalid cursor: cursor signature does not match\n",
+		},
+		{
+			Name:            "ListWithUnknownCursorVersion",
+			Method:          http.MethodGet,
+			URL:             "/south-america/images/list?cursor=v9.bzpBU0N8bDo1.c2ln",
+			ExpectedStatus:  400,
+			ExpectedContent: "invalid cursor: unknown cursor version v9\n",
+		},
+		{
+			Name:            "ListWithUnsignedCursor",
+			Method:          http.MethodGet,
+			URL:             "/south-america/images/list?cursor=" + base64.URLEncoding.EncodeToString([]byte("o:ASC|l:100000")),
+			ExpectedStatus:  400,
+			ExpectedContent: "invalid cursor: unversioned cursors are no longer accepted\n",
+		},
 		{
 			Name:           "ImageAPI",
 			Method:         http.MethodGet,
@@ -158,7 +296,7 @@ func TestRouter(t *testing.T) {
 				if err != nil {
 					return err
 				}
-				if !cmp.Equal(body, imgs[1], cmpopts.EquateApproxTime(time.Second)) {
+				if !cmp.Equal(body, coarseLocation(imgs[1]), cmpopts.EquateApproxTime(time.Second)) {
 					return errors.New("image body not as expected")
 				}
 				return nil
@@ -202,6 +340,47 @@ func TestRouter(t *testing.T) {
 
 }
 
+func TestAlbumAPI(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imagetest.NewStore(),
+		ImageTable:     table.ImageTable,
+	}, router.Options{
+		Admins: []string{"admin"},
+	})
+
+	do := func(t *testing.T, user, method, url, body string) int {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		require.NoError(t, err)
+		req.SetBasicAuth(user, "")
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr.Result().StatusCode
+	}
+
+	t.Run("should only let admins change albums", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, do(t, "wob", http.MethodPost, "/api/albums", `{"slug": "patagonia", "name": "Patagonia"}`))
+		assert.Equal(t, http.StatusCreated, do(t, "admin", http.MethodPost, "/api/albums", `{"slug": "patagonia", "name": "Patagonia"}`))
+
+		assert.Equal(t, http.StatusForbidden, do(t, "wob", http.MethodPatch, "/api/albums/patagonia", `{"name": "Tierra del Fuego"}`))
+		assert.Equal(t, http.StatusNoContent, do(t, "admin", http.MethodPatch, "/api/albums/patagonia", `{"name": "Patagonia!"}`))
+
+		assert.Equal(t, http.StatusForbidden, do(t, "wob", http.MethodPut, "/api/albums/order", `["south-america", "patagonia"]`))
+		assert.Equal(t, http.StatusNoContent, do(t, "admin", http.MethodPut, "/api/albums/order", `["patagonia", "south-america"]`))
+
+		albums, err := table.ListAlbums()
+		require.NoError(t, err)
+		require.Len(t, albums, 2)
+		assert.Equal(t, "Patagonia!", albums[0].Name)
+	})
+
+	t.Run("should let anyone list albums", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do(t, "wob", http.MethodGet, "/api/albums", ""))
+	})
+}
+
 func TestImageUpload(t *testing.T) {
 
 	table := dbtest.NewTestTable(t)
@@ -247,74 +426,1579 @@ func TestImageUpload(t *testing.T) {
 	})
 }
 
-type scenario struct {
-	Name   string
-	Method string
-	URL    string
+func TestImageTags(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
 
-	ExpectedStatus    int
-	ExpectedContent   string
-	ExpectedContentFn func(io.Reader) error
-}
+	imgs := dbtest.GivenSaved(t, table, dbtest.SpaceByHour([]db.Image{
+		dbtest.GivenImage(t),
+		dbtest.GivenImage(t),
+		dbtest.GivenImage(t),
+	})...)
+	dbtest.GivenInAlbum(t, table, router.SouthAmerica, imgs...)
 
-func (s scenario) TestName() string {
-	if len(s.Name) != 0 {
-		return s.Name
+	tmpl, err := templates.GetTemplates()
+	require.NoError(t, err)
+
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imagetest.NewStore(),
+		Templates:      tmpl,
+		ImageTable:     table.ImageTable,
+	}, router.Options{})
+
+	patch := func(t *testing.T, id string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPatch, "/images/"+id, strings.NewReader(body))
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
 	}
 
-	return fmt.Sprintf("%s:%s", s.Method, s.URL)
-}
+	t.Run("should add and remove tags without changing the image", func(t *testing.T) {
+		rr := patch(t, imgs[0].ID, `{"addTags": ["Food", "market"]}`)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
 
-func templateBody(t *testing.T, tmpl *template.Template, data any) string {
-	buf := &bytes.Buffer{}
-	err := tmpl.Execute(buf, data)
-	require.NoError(t, err, "could not create template body")
-	return buf.String()
-}
+		rr = patch(t, imgs[0].ID, `{"removeTags": ["market"]}`)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
 
-func reverse[S any](s []S) []S {
-	arr := make([]S, len(s))
-	copy(arr, s)
-	slices.Reverse(arr)
-	return arr
+		fetched, err := table.GetByID(imgs[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"food"}, fetched.Tags)
+		assert.Equal(t, imgs[0].Country, fetched.Country)
+	})
+
+	t.Run("should reject bad tags", func(t *testing.T) {
+		rr := patch(t, imgs[1].ID, `{"addTags": "food"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Result().StatusCode)
+
+		rr = patch(t, imgs[1].ID, `{"addTags": [" "]}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Result().StatusCode)
+	})
+
+	t.Run("should filter gallery by tag", func(t *testing.T) {
+		rr := patch(t, imgs[2].ID, `{"addTags": ["mountains"]}`)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+		req, err := http.NewRequest(http.MethodGet, "/south-america?tags=food", nil)
+		require.NoError(t, err)
+		rr = httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+		body := rr.Body.String()
+		assert.Contains(t, body, fmt.Sprintf(`id="%s"`, imgs[0].ID))
+		assert.NotContains(t, body, fmt.Sprintf(`id="%s"`, imgs[1].ID))
+		assert.NotContains(t, body, fmt.Sprintf(`id="%s"`, imgs[2].ID))
+		assert.Contains(t, body, `id="tag-mountains"`)
+	})
 }
 
-func clearFailedTests(t *testing.T) {
-	if _, err := os.Stat("./failed-tests"); os.IsNotExist(err) {
-		return
+func TestImageDescriptions(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	imgs := dbtest.GivenSaved(t, table, dbtest.GivenImage(t))
+	dbtest.GivenInAlbum(t, table, router.SouthAmerica, imgs...)
+
+	tmpl, err := templates.GetTemplates()
+	require.NoError(t, err)
+
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imagetest.NewStore(),
+		Templates:      tmpl,
+		ImageTable:     table.ImageTable,
+	}, router.Options{})
+
+	do := func(t *testing.T, method, url string, body io.Reader) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, body)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
 	}
 
-	err := os.RemoveAll("./failed-tests")
-	require.NoError(t, err, "error while clearing failed tests")
+	t.Run("should edit title, caption and alt text", func(t *testing.T) {
+		rr := do(t, http.MethodPatch, "/images/"+imgs[0].ID, strings.NewReader(`{
+			"title": "Torres del Paine",
+			"caption": "The towers at sunrise",
+			"altText": "Three granite peaks above a lake",
+			"country": "Chile"
+		}`))
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+		fetched, err := table.GetByID(imgs[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Torres del Paine", fetched.Title)
+		assert.Equal(t, "The towers at sunrise", fetched.Caption)
+		assert.Equal(t, "Three granite peaks above a lake", fetched.AltText)
+		assert.Equal(t, "Chile", fetched.Country)
+	})
+
+	t.Run("should render them on the image page", func(t *testing.T) {
+		rr := do(t, http.MethodGet, "/south-america/images/"+imgs[0].ID, nil)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+		body := rr.Body.String()
+		assert.Contains(t, body, "<title>Torres del Paine - South America</title>")
+		assert.Contains(t, body, `alt="Three granite peaks above a lake"`)
+		assert.Contains(t, body, "The towers at sunrise")
+	})
+
+	t.Run("should use alt text in the list", func(t *testing.T) {
+		rr := do(t, http.MethodGet, "/south-america", nil)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+		assert.Contains(t, rr.Body.String(), `alt="Three granite peaks above a lake"`)
+	})
+
+	t.Run("should not create images that don't exist", func(t *testing.T) {
+		rr := do(t, http.MethodPatch, "/images/not-here", strings.NewReader(`{"title": "Nope"}`))
+		assert.Equal(t, http.StatusNotFound, rr.Result().StatusCode)
+
+		_, err := table.GetByID("not-here")
+		assert.Equal(t, db.NotFound, err)
+	})
 }
 
-func saveBodyDiff(t *testing.T, s scenario, res string) {
-	if _, err := os.Stat("./failed-tests"); os.IsNotExist(err) {
-		err = os.MkdirAll("./failed-tests", 0755)
+func TestPatchImage(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	tmpl, err := templates.GetTemplates()
+	require.NoError(t, err)
+
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imagetest.NewStore(),
+		Templates:      tmpl,
+		ImageTable:     table.ImageTable,
+	}, router.Options{})
+
+	givenImage := func(t *testing.T) db.Image {
+		img := dbtest.GivenImage(t)
+		img.Title = "Torres del Paine"
+		img.Locality = "Puerto Natales"
+		img.Country = "Chile"
+		dbtest.GivenSaved(t, table, img)
+		require.NoError(t, table.AddTags(img.ID, "mountains", "sunrise"))
+		return img
+	}
+
+	patch := func(t *testing.T, id string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPatch, "/images/"+id, strings.NewReader(body))
 		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
 	}
 
-	testID := base64.URLEncoding.EncodeToString([]byte(s.TestName()))[:6]
+	t.Run("should only change fields in the patch", func(t *testing.T) {
+		img := givenImage(t)
 
-	t.Errorf("%s body is not as expected, check diff %s", s.TestName(), testID)
+		rr := patch(t, img.ID, `{"locality": "Torres del Paine"}`)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+		assert.Equal(t, "application/json", rr.Result().Header.Get("Content-Type"))
 
-	exp, err := os.Create(fmt.Sprintf("./failed-tests/exp-%s.html", testID))
+		res := db.Image{}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&res))
+		assert.Equal(t, "Torres del Paine", res.Locality)
+		assert.Equal(t, "Chile", res.Country)
+		assert.Equal(t, "Torres del Paine", res.Title)
+		assert.Equal(t, []string{"mountains", "sunrise"}, res.Tags)
+
+		fetched, err := table.GetByID(img.ID)
+		require.NoError(t, err)
+		assertImageJSONEqual(t, res, coarseLocation(fetched))
+	})
+
+	t.Run("should clear fields set to null", func(t *testing.T) {
+		img := givenImage(t)
+
+		rr := patch(t, img.ID, `{"title": null, "tags": null}`)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+		fetched, err := table.GetByID(img.ID)
+		require.NoError(t, err)
+		assert.Empty(t, fetched.Title)
+		assert.Nil(t, fetched.Tags)
+		assert.Equal(t, "Chile", fetched.Country)
+	})
+
+	t.Run("should replace tags", func(t *testing.T) {
+		img := givenImage(t)
+
+		rr := patch(t, img.ID, `{"tags": ["Glacier", "mountains"], "removeTags": ["mountains"]}`)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+		fetched, err := table.GetByID(img.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"glacier"}, fetched.Tags)
+	})
+
+	t.Run("should reject invalid patches without changing anything", func(t *testing.T) {
+		img := givenImage(t)
+
+		tests := []struct {
+			Name string
+			Body string
+		}{
+			{"not json", `{"title": `},
+			{"not an object", `["title"]`},
+			{"field that can't be changed", `{"title": "New", "width": 10}`},
+			{"unknown field", `{"title": "New", "colour": "blue"}`},
+			{"wrong type", `{"title": 10}`},
+			{"too long", `{"title": "` + strings.Repeat("a", 201) + `"}`},
+			{"bad tags", `{"title": "New", "tags": ["food,drink"]}`},
+			{"tags not an array", `{"tags": "food"}`},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.Name, func(t *testing.T) {
+				rr := patch(t, img.ID, tt.Body)
+				assert.Equal(t, http.StatusBadRequest, rr.Result().StatusCode)
+
+				fetched, err := table.GetByID(img.ID)
+				require.NoError(t, err)
+				assert.Equal(t, "Torres del Paine", fetched.Title)
+				assert.Equal(t, []string{"mountains", "sunrise"}, fetched.Tags)
+			})
+		}
+	})
+
+	t.Run("should 404 for unknown images", func(t *testing.T) {
+		rr := patch(t, "not-here", `{"country": "Chile"}`)
+		assert.Equal(t, http.StatusNotFound, rr.Result().StatusCode)
+	})
+}
+
+// tamperedCursor signs a cursor for opts then swaps its contents for body
+func tamperedCursor(t *testing.T, opts db.GetListOpts, body string) string {
+	parts := strings.Split(db.MustNewCursor(opts).EncodedString(), ".")
+	require.Len(t, parts, 3)
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(body))
+	return strings.Join(parts, ".")
+}
+
+// coarseLocation is the image as the api shows it to people who aren't
+// admins under the standard privacy policy
+func coarseLocation(img db.Image) db.Image {
+	img.Lat = math.Round(img.Lat*10) / 10
+	img.Long = math.Round(img.Long*10) / 10
+	return img
+}
+
+func assertImageJSONEqual(t *testing.T, expected db.Image, actual db.Image) {
+	exp, err := json.Marshal(expected)
 	require.NoError(t, err)
-	defer exp.Close()
+	act, err := json.Marshal(actual)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(exp), string(act))
+}
 
-	_, err = exp.WriteString(s.ExpectedContent)
+func TestJumpToWithSameCreatedAt(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	imgs := make([]db.Image, 200)
+	for i := range imgs {
+		imgs[i] = dbtest.GivenImage(t)
+		imgs[i].CreatedAt = time.Unix(0, 0)
+	}
+	dbtest.GivenSaved(t, table, imgs...)
+	dbtest.GivenInAlbum(t, table, router.SouthAmerica, imgs...)
+	slices.SortFunc(imgs, func(a, b db.Image) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	tmpl, err := templates.GetTemplates()
 	require.NoError(t, err)
 
-	act, err := os.Create(fmt.Sprintf("./failed-tests/act-%s.html", testID))
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imagetest.NewStore(),
+		Templates:      tmpl,
+		ImageTable:     table.ImageTable,
+	}, router.Options{})
+
+	req, err := http.NewRequest(http.MethodGet, "/south-america?jumpTo="+imgs[100].ID, nil)
 	require.NoError(t, err)
-	defer act.Close()
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Result().StatusCode)
 
-	_, err = act.WriteString(res)
+	body := rr.Body.String()
+	for i, img := range imgs {
+		if i >= 94 && i <= 106 {
+			assert.Contains(t, body, fmt.Sprintf(`id="%s"`, img.ID), "image %d should be shown", i)
+		} else {
+			assert.NotContains(t, body, fmt.Sprintf(`id="%s"`, img.ID), "image %d should not be shown", i)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	imgs := dbtest.SpaceByHour([]db.Image{
+		dbtest.GivenImage(t),
+		dbtest.GivenImage(t),
+		dbtest.GivenImage(t),
+	})
+	imgs[0].Locality = "Puerto Natales"
+	imgs[1].Locality = "Santiago"
+	imgs[2].Locality = "Puerto Montt"
+	dbtest.GivenSaved(t, table, imgs...)
+	dbtest.GivenInAlbum(t, table, router.SouthAmerica, imgs...)
+
+	tmpl, err := templates.GetTemplates()
 	require.NoError(t, err)
+
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imagetest.NewStore(),
+		Templates:      tmpl,
+		ImageTable:     table.ImageTable,
+	}, router.Options{})
+
+	get := func(t *testing.T, url string) string {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+		return rr.Body.String()
+	}
+
+	t.Run("should only show matching images", func(t *testing.T) {
+		body := get(t, "/south-america?q=puerto")
+		assert.Contains(t, body, fmt.Sprintf(`id="%s"`, imgs[0].ID))
+		assert.NotContains(t, body, fmt.Sprintf(`id="%s"`, imgs[1].ID))
+		assert.Contains(t, body, fmt.Sprintf(`id="%s"`, imgs[2].ID))
+		assert.Contains(t, body, `value="puerto"`)
+	})
+
+	t.Run("should keep query in list cursor", func(t *testing.T) {
+		list, err := table.Search("puerto", db.WithAlbum(router.SouthAmerica), db.WithLimit(1))
+		require.NoError(t, err)
+		require.Len(t, list.Images, 1)
+
+		body := get(t, "/south-america/images/list?cursor="+list.Cursor.EncodedString())
+		assert.NotContains(t, body, fmt.Sprintf(`id="%s"`, imgs[1].ID))
+		assert.Contains(t, body, fmt.Sprintf(`id="%s"`, imgs[2].ID))
+	})
+
+	t.Run("should say when nothing matches", func(t *testing.T) {
+		body := get(t, "/south-america?q=lima")
+		assert.Contains(t, body, `No photos found for "lima"`)
+	})
 }
 
-func toJSON(t *testing.T, data any) []byte {
-	b, err := json.Marshal(data)
+func TestDateRange(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	imgs := []db.Image{
+		dbtest.GivenImage(t),
+		dbtest.GivenImage(t),
+		dbtest.GivenImage(t),
+		dbtest.GivenImage(t),
+	}
+	imgs[0].CreatedAt = day.Add(-time.Hour)
+	imgs[1].CreatedAt = day.Add(time.Hour)
+	imgs[2].CreatedAt = day.Add(47 * time.Hour)
+	imgs[3].CreatedAt = day.Add(49 * time.Hour)
+	dbtest.GivenSaved(t, table, imgs...)
+	dbtest.GivenInAlbum(t, table, router.SouthAmerica, imgs...)
+
+	tmpl, err := templates.GetTemplates()
 	require.NoError(t, err)
-	return b
+
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imagetest.NewStore(),
+		Templates:      tmpl,
+		ImageTable:     table.ImageTable,
+	}, router.Options{})
+
+	get := func(t *testing.T, url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should only show images in range", func(t *testing.T) {
+		rr := get(t, "/south-america?from=2024-03-01&to=2024-03-02")
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+		body := rr.Body.String()
+		assert.NotContains(t, body, fmt.Sprintf(`id="%s"`, imgs[0].ID))
+		assert.Contains(t, body, fmt.Sprintf(`id="%s"`, imgs[1].ID))
+		assert.Contains(t, body, fmt.Sprintf(`id="%s"`, imgs[2].ID))
+		assert.NotContains(t, body, fmt.Sprintf(`id="%s"`, imgs[3].ID))
+		assert.Contains(t, body, `value="2024-03-01"`)
+		assert.Contains(t, body, `value="2024-03-02"`)
+	})
+
+	t.Run("should page list in range", func(t *testing.T) {
+		rr := get(t, "/south-america/images/list?from=2024-03-01")
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+		body := rr.Body.String()
+		assert.NotContains(t, body, fmt.Sprintf(`id="%s"`, imgs[0].ID))
+		assert.Contains(t, body, fmt.Sprintf(`id="%s"`, imgs[3].ID))
+	})
+
+	t.Run("should reject bad dates", func(t *testing.T) {
+		for _, url := range []string{
+			"/south-america?from=yesterday",
+			"/south-america?to=2024-13-01",
+			"/south-america?from=2024-03-02&to=2024-03-01",
+			"/south-america/images/list?from=01/03/2024",
+		} {
+			t.Run(url, func(t *testing.T) {
+				assert.Equal(t, http.StatusBadRequest, get(t, url).Result().StatusCode)
+			})
+		}
+	})
+}
+
+func TestCountryFacets(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	imgs := dbtest.SpaceByHour([]db.Image{
+		dbtest.GivenImage(t), dbtest.GivenImage(t), dbtest.GivenImage(t), dbtest.GivenImage(t),
+	})
+	imgs[0].Country = "Chile"
+	imgs[1].Country = "Chile"
+	imgs[2].Country = "Ecuador"
+	imgs[3].Country = "Peru"
+	dbtest.GivenSaved(t, table, imgs...)
+	dbtest.GivenInAlbum(t, table, router.SouthAmerica, imgs...)
+	require.NoError(t, table.AddTags(imgs[0].ID, "glacier"))
+	require.NoError(t, table.AddTags(imgs[2].ID, "glacier"))
+
+	tmpl, err := templates.GetTemplates()
+	require.NoError(t, err)
+
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imagetest.NewStore(),
+		Templates:      tmpl,
+		ImageTable:     table.ImageTable,
+	}, router.Options{})
+
+	get := func(t *testing.T, url string) string {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+		return rr.Body.String()
+	}
+
+	counts := func(body string) map[string]string {
+		found := map[string]string{}
+		re := regexp.MustCompile(`value="([^"]+)"\s+name="countries"[\s\S]*?class="facet-count[^"]*">(\d+)<`)
+		for _, m := range re.FindAllStringSubmatch(body, -1) {
+			found[m[1]] = m[2]
+		}
+		return found
+	}
+
+	t.Run("should show every country with its count", func(t *testing.T) {
+		body := get(t, "/south-america?countries=Chile")
+		assert.Equal(t, map[string]string{"Chile": "2", "Ecuador": "1", "Peru": "1"}, counts(body))
+		assert.Contains(t, body, "Chile 🇨🇱")
+	})
+
+	t.Run("should count with the other filters", func(t *testing.T) {
+		body := get(t, "/south-america?tags=glacier&countries=Peru")
+		assert.Equal(t, map[string]string{"Chile": "1", "Ecuador": "1", "Peru": "0"}, counts(body))
+	})
+}
+
+func TestLocalityDrillDown(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	imgs := dbtest.SpaceByHour([]db.Image{
+		dbtest.GivenImage(t), dbtest.GivenImage(t), dbtest.GivenImage(t), dbtest.GivenImage(t),
+	})
+	imgs[0].Country, imgs[0].Locality = "Chile", "Puerto Natales"
+	imgs[1].Country, imgs[1].Locality = "Chile", "Santiago"
+	imgs[2].Country, imgs[2].Locality = "Chile", "Puerto Natales"
+	imgs[3].Country, imgs[3].Locality = "Argentina", "Mendoza"
+	dbtest.GivenSaved(t, table, imgs...)
+	dbtest.GivenInAlbum(t, table, router.SouthAmerica, imgs...)
+
+	tmpl, err := templates.GetTemplates()
+	require.NoError(t, err)
+
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imagetest.NewStore(),
+		Templates:      tmpl,
+		ImageTable:     table.ImageTable,
+	}, router.Options{})
+
+	get := func(t *testing.T, url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	shown := func(t *testing.T, url string, want ...db.Image) {
+		rr := get(t, url)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+		body := rr.Body.String()
+		for _, img := range imgs {
+			if slices.ContainsFunc(want, func(w db.Image) bool { return w.ID == img.ID }) {
+				assert.Contains(t, body, fmt.Sprintf(`id="%s"`, img.ID))
+			} else {
+				assert.NotContains(t, body, fmt.Sprintf(`id="%s"`, img.ID))
+			}
+		}
+	}
+
+	t.Run("should filter by locality param", func(t *testing.T) {
+		shown(t, "/south-america?localities=Chile|Puerto%20Natales,Argentina|Mendoza", imgs[0], imgs[2], imgs[3])
+	})
+
+	t.Run("should only narrow the country of the locality", func(t *testing.T) {
+		shown(t, "/south-america?countries=Chile,Argentina&localities=Chile|Puerto%20Natales", imgs[0], imgs[2], imgs[3])
+		shown(t, "/south-america/argentina?localities=Chile|Santiago", imgs[1], imgs[3])
+	})
+
+	t.Run("should ignore localities without a country", func(t *testing.T) {
+		shown(t, "/south-america?localities=Puerto%20Natales", imgs...)
+	})
+
+	t.Run("should filter by shareable links", func(t *testing.T) {
+		shown(t, "/south-america/chile", imgs[0], imgs[1], imgs[2])
+		shown(t, "/south-america/chile/puerto-natales", imgs[0], imgs[2])
+		shown(t, router.AlbumURL(router.SouthAmerica)+"/argentina/mendoza", imgs[3])
+	})
+
+	t.Run("should expand country with checked locality", func(t *testing.T) {
+		body := get(t, "/south-america/chile/puerto-natales").Body.String()
+		assert.Regexp(t, `<details[^>]*open>`, body)
+		assert.Regexp(t, `value="Chile\|Puerto Natales"\s+name="localities"[\s\S]*?checked="true"`, body)
+		assert.Contains(t, body, `href="/albums/south-america/chile/santiago"`)
+		assert.Equal(t, 1, strings.Count(body, `value="Chile|Puerto Natales"`))
+	})
+
+	t.Run("should 404 for unknown places", func(t *testing.T) {
+		for _, url := range []string{"/south-america/peru", "/south-america/chile/mendoza"} {
+			t.Run(url, func(t *testing.T) {
+				assert.Equal(t, http.StatusNotFound, get(t, url).Result().StatusCode)
+			})
+		}
+	})
+}
+
+func TestQueryTimeout(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	imgs := dbtest.GivenSaved(t, table, dbtest.GivenImage(t))
+	dbtest.GivenInAlbum(t, table, router.SouthAmerica, imgs...)
+
+	tmpl, err := templates.GetTemplates()
+	require.NoError(t, err)
+
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imagetest.NewStore(),
+		Templates:      tmpl,
+		ImageTable:     table.ImageTable,
+	}, router.Options{})
+
+	for _, url := range []string{"/south-america", "/api/images", "/api/images/" + imgs[0].ID} {
+		t.Run("should be unavailable when queries time out "+url, func(t *testing.T) {
+			table.QueryTimeout = time.Nanosecond
+			defer func() { table.QueryTimeout = db.DefaultQueryTimeout }()
+
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			srv.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusServiceUnavailable, rr.Result().StatusCode)
+		})
+	}
+
+	t.Run("should be unavailable when the request has run out of time", func(t *testing.T) {
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/api/images", nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Result().StatusCode)
+	})
+}
+
+func TestAPIListImages(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	imgs := dbtest.SpaceByHour([]db.Image{
+		dbtest.GivenImage(t),
+		dbtest.GivenImage(t),
+		dbtest.GivenImage(t),
+	})
+	imgs[0].Lat, imgs[0].Long = -51.7236, -72.5064 // puerto natales
+	imgs[1].Lat, imgs[1].Long = -50.9423, -73.4068 // torres del paine
+	imgs[2].Lat, imgs[2].Long = -33.4489, -70.6693 // santiago
+	dbtest.GivenSaved(t, table, imgs...)
+
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imagetest.NewStore(),
+		ImageTable:     table.ImageTable,
+	}, router.Options{})
+
+	get := func(t *testing.T, url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	list := func(t *testing.T, url string) router.ImagesResponse {
+		rr := get(t, url)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode, rr.Body.String())
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+		res := router.ImagesResponse{}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&res))
+		return res
+	}
+
+	idsOf := func(imgs []db.Image) []string {
+		ids := []string{}
+		for _, img := range imgs {
+			ids = append(ids, img.ID)
+		}
+		return ids
+	}
+
+	t.Run("should list images in bbox", func(t *testing.T) {
+		res := list(t, "/api/images?bbox=-76,-54,-68,-50")
+		assert.Equal(t, []string{imgs[0].ID, imgs[1].ID}, idsOf(res.Images))
+	})
+
+	t.Run("should page through bbox with cursor", func(t *testing.T) {
+		res := list(t, "/api/images?bbox=-76,-54,-68,-50&limit=1")
+		assert.Equal(t, []string{imgs[0].ID}, idsOf(res.Images))
+
+		res = list(t, "/api/images?cursor="+res.Cursor)
+		assert.Equal(t, []string{imgs[1].ID}, idsOf(res.Images))
+
+		res = list(t, "/api/images?cursor="+res.Cursor)
+		assert.Empty(t, res.Images)
+	})
+
+	t.Run("should list images near", func(t *testing.T) {
+		res := list(t, "/api/images?near=-51.7236,-72.5064&km=50")
+		assert.Equal(t, []string{imgs[0].ID}, idsOf(res.Images))
+	})
+
+	t.Run("should reject bad areas", func(t *testing.T) {
+		for _, url := range []string{
+			"/api/images?bbox=-76,-54,-68",
+			"/api/images?bbox=-76,-50,-68,-54",
+			"/api/images?bbox=west,-54,-68,-50",
+			"/api/images?near=-51.7236,-72.5064",
+			"/api/images?near=-51.7236,-72.5064&km=-1",
+			"/api/images?bbox=-76,-54,-68,-50&limit=0",
+			"/api/images?cursor=not-a-cursor",
+		} {
+			t.Run(url, func(t *testing.T) {
+				assert.Equal(t, http.StatusBadRequest, get(t, url).Result().StatusCode)
+			})
+		}
+	})
+}
+
+func TestAPILocationPrivacy(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	img := dbtest.GivenImage(t)
+	img.Lat, img.Long = -51.7236, -72.5064 // puerto natales
+	dbtest.GivenSaved(t, table, img)
+
+	get := func(t *testing.T, srv http.Handler, url string, user string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		if len(user) > 0 {
+			req.SetBasicAuth(user, "")
+		}
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	getImage := func(t *testing.T, srv http.Handler, user string) db.Image {
+		rr := get(t, srv, "/api/images/"+img.ID, user)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode, rr.Body.String())
+		got := db.Image{}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+		return got
+	}
+
+	list := func(t *testing.T, srv http.Handler, url string, user string) []db.Image {
+		rr := get(t, srv, url, user)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode, rr.Body.String())
+		res := router.ImagesResponse{}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&res))
+		return res.Images
+	}
+
+	newRouter := func(privacy image.PrivacyPolicy) http.Handler {
+		return router.NewRouter(router.Services{
+			ImageFileStore: imagetest.NewStore(),
+			ImageTable:     table.ImageTable,
+		}, router.Options{Privacy: privacy, Admins: []string{"admin"}})
+	}
+
+	t.Run("should coarsen locations for gallery users", func(t *testing.T) {
+		srv := newRouter(image.PrivacyStandard)
+
+		got := getImage(t, srv, "guest")
+		assert.Equal(t, -51.7, got.Lat)
+		assert.Equal(t, -72.5, got.Long)
+
+		imgs := list(t, srv, "/api/images?bbox=-76,-54,-68,-50", "guest")
+		require.Len(t, imgs, 1)
+		assert.Equal(t, -51.7, imgs[0].Lat)
+		assert.Equal(t, -72.5, imgs[0].Long)
+	})
+
+	t.Run("should show admins exact locations", func(t *testing.T) {
+		for _, privacy := range []image.PrivacyPolicy{image.PrivacyStandard, image.PrivacyStrict} {
+			got := getImage(t, newRouter(privacy), "admin")
+			assert.Equal(t, img.Lat, got.Lat)
+			assert.Equal(t, img.Long, got.Long)
+		}
+	})
+
+	t.Run("should show exact locations with privacy off", func(t *testing.T) {
+		got := getImage(t, newRouter(image.PrivacyOff), "guest")
+		assert.Equal(t, img.Lat, got.Lat)
+		assert.Equal(t, img.Long, got.Long)
+	})
+
+	t.Run("should leave out locations when strict", func(t *testing.T) {
+		srv := newRouter(image.PrivacyStrict)
+
+		got := getImage(t, srv, "guest")
+		assert.Zero(t, got.Lat)
+		assert.Zero(t, got.Long)
+
+		for _, url := range []string{"/api/images?bbox=-76,-54,-68,-50", "/api/images?near=-51.7,-72.5&km=50"} {
+			assert.Equal(t, http.StatusForbidden, get(t, srv, url, "guest").Result().StatusCode)
+		}
+		assert.Len(t, list(t, srv, "/api/images?bbox=-76,-54,-68,-50", "admin"), 1)
+	})
+
+	t.Run("should only search as finely as locations are shown", func(t *testing.T) {
+		srv := newRouter(image.PrivacyStandard)
+
+		// a tiny box next to the image in the same grid square
+		nextTo := "/api/images?bbox=-72.55,-51.79,-72.54,-51.78"
+		assert.Len(t, list(t, srv, nextTo, "guest"), 1)
+		assert.Empty(t, list(t, srv, nextTo, "admin"))
+
+		nearby := "/api/images?near=-51.73,-72.52&km=0.1"
+		assert.Len(t, list(t, srv, nearby, "guest"), 1)
+		assert.Empty(t, list(t, srv, nearby, "admin"))
+
+		// the centre of the grid square diagonally next to the image's
+		diagonal := "/api/images?near=-51.8,-72.6&km=0.1"
+		assert.Len(t, list(t, srv, diagonal, "guest"), 1)
+		assert.Empty(t, list(t, srv, diagonal, "admin"))
+	})
+}
+
+func TestTrash(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	tmpl, err := templates.GetTemplates()
+	require.NoError(t, err)
+
+	imgStore := imagetest.NewStore()
+	defer imgStore.Close()
+
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imgStore,
+		Templates:      tmpl,
+		ImageTable:     table.ImageTable,
+	}, router.Options{
+		Admins:         []string{"admin"},
+		TrashRetention: 24 * time.Hour,
+	})
+
+	do := func(t *testing.T, method, url string, admin bool) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, nil)
+		require.NoError(t, err)
+		if admin {
+			req.SetBasicAuth("admin", "")
+		}
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "/images", imagetest.FishJPEG())
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+	id := strings.TrimPrefix(rr.Result().Header.Get("Location"), "/images/")
+
+	t.Run("should keep the file of a deleted image", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do(t, http.MethodDelete, "/images/"+id, false).Result().StatusCode)
+		assert.Equal(t, http.StatusNotFound, do(t, http.MethodDelete, "/images/"+id, false).Result().StatusCode)
+		assert.Equal(t, http.StatusNotFound, do(t, http.MethodGet, "/api/images/"+id, false).Result().StatusCode)
+
+		_, err := imgStore.ReadFile(id)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should only serve trashed files to admins", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, do(t, http.MethodGet, "/images/"+id, false).Result().StatusCode)
+		assert.Equal(t, http.StatusOK, do(t, http.MethodGet, "/images/"+id, true).Result().StatusCode)
+		assert.Equal(t, http.StatusOK, do(t, http.MethodGet, "/images/"+id+"?w=240", true).Result().StatusCode)
+
+		trash, err := table.GetTrash()
+		require.NoError(t, err)
+		assert.Len(t, trash, 1, "a gallery user asking for it shouldn't remove it from the table")
+	})
+
+	t.Run("should only show trash to admins", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, do(t, http.MethodGet, "/admin/trash", false).Result().StatusCode)
+
+		rr := do(t, http.MethodGet, "/admin/trash", true)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+		assert.Contains(t, rr.Body.String(), fmt.Sprintf(`id="%s"`, id))
+		assert.Contains(t, rr.Body.String(), fmt.Sprintf(`hx-post="/images/%s/restore"`, id))
+	})
+
+	t.Run("should restore image", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, do(t, http.MethodPost, "/images/"+id+"/restore", false).Result().StatusCode)
+		assert.Equal(t, http.StatusOK, do(t, http.MethodPost, "/images/"+id+"/restore", true).Result().StatusCode)
+		assert.Equal(t, http.StatusNotFound, do(t, http.MethodPost, "/images/"+id+"/restore", true).Result().StatusCode)
+		assert.Equal(t, http.StatusOK, do(t, http.MethodGet, "/api/images/"+id, false).Result().StatusCode)
+
+		rr := do(t, http.MethodGet, "/admin/trash", true)
+		assert.NotContains(t, rr.Body.String(), fmt.Sprintf(`id="%s"`, id))
+	})
+
+	t.Run("should purge after retention", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, do(t, http.MethodDelete, "/images/"+id, false).Result().StatusCode)
+
+		require.NoError(t, srv.PurgeTrash(context.Background(), time.Now()))
+		_, err := imgStore.ReadFile(id)
+		assert.NoError(t, err, "should keep files within retention")
+
+		require.NoError(t, srv.PurgeTrash(context.Background(), time.Now().Add(25*time.Hour)))
+		_, err = imgStore.ReadFile(id)
+		assert.True(t, image.IsNotFound(err), "should delete file after retention")
+
+		trash, err := table.GetTrash()
+		require.NoError(t, err)
+		assert.Empty(t, trash)
+	})
+}
+
+func TestAudit(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	tmpl, err := templates.GetTemplates()
+	require.NoError(t, err)
+
+	imgStore := imagetest.NewStore()
+	defer imgStore.Close()
+
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imgStore,
+		Templates:      tmpl,
+		ImageTable:     table.ImageTable,
+	}, router.Options{
+		Admins: []string{"admin"},
+	})
+
+	do := func(t *testing.T, user string, method, url string, body io.Reader) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, body)
+		require.NoError(t, err)
+		req.SetBasicAuth(user, "")
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do(t, "wob", http.MethodPost, "/images", imagetest.FishJPEG())
+	require.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+	id := strings.TrimPrefix(rr.Result().Header.Get("Location"), "/images/")
+
+	rr = do(t, "wob", http.MethodPost, "/images", imagetest.FishJPEG())
+	require.Equal(t, http.StatusNoContent, rr.Result().StatusCode)
+
+	rr = do(t, "saw", http.MethodPatch, "/images/"+id, strings.NewReader(`{"title": "Fish", "tags": ["sea"]}`))
+	require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	rr = do(t, "saw", http.MethodPatch, "/images/"+id, strings.NewReader(`{"title": "Fish"}`))
+	require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	rr = do(t, "admin", http.MethodDelete, "/images/"+id, nil)
+	require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	t.Run("should record each change with who made it", func(t *testing.T) {
+		list, err := table.GetAuditEvents(db.WithAscOrder())
+		require.NoError(t, err)
+
+		type event struct{ Username, Action, ImageID string }
+		events := []event{}
+		for _, e := range list.Events {
+			events = append(events, event{e.Username, e.Action, e.ImageID})
+		}
+		assert.Equal(t, []event{
+			{"wob", db.AuditCreate, id},
+			{"saw", db.AuditUpdate, id},
+			{"admin", db.AuditDelete, id},
+		}, events, "uploading again and patches that change nothing shouldn't be recorded")
+
+		before, after := db.Image{}, db.Image{}
+		require.NoError(t, json.Unmarshal(list.Events[1].Before, &before))
+		require.NoError(t, json.Unmarshal(list.Events[1].After, &after))
+		assert.Equal(t, "", before.Title)
+		assert.Nil(t, before.Tags)
+		assert.Equal(t, "Fish", after.Title)
+		assert.Equal(t, []string{"sea"}, after.Tags)
+	})
+
+	t.Run("should only show audit log to admins", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, do(t, "wob", http.MethodGet, "/admin/audit", nil).Result().StatusCode)
+
+		rr := do(t, "admin", http.MethodGet, "/admin/audit", nil)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+		body := rr.Body.String()
+		assert.Contains(t, body, "<td class=\"pr-4\">saw</td>")
+		assert.Contains(t, body, fmt.Sprintf(`href="/images/%s"`, id))
+		assert.NotContains(t, body, `id="audit-next"`)
+	})
+
+	t.Run("should page audit log", func(t *testing.T) {
+		list, err := table.GetAuditEvents(db.WithLimit(2))
+		require.NoError(t, err)
+		require.Len(t, list.Events, 2)
+
+		rr := do(t, "admin", http.MethodGet, "/admin/audit?cursor="+list.Cursor.EncodedString(), nil)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+		body := rr.Body.String()
+		assert.Contains(t, body, "<td class=\"pr-4\">wob</td>")
+		assert.NotContains(t, body, "<td class=\"pr-4\">admin</td>")
+
+		rr = do(t, "admin", http.MethodGet, "/admin/audit?cursor=not-a-cursor", nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Result().StatusCode)
+	})
+}
+
+// originalSrcSet is the srcset of an image too narrow for renditions,
+// images without a width have none
+func originalSrcSet(img db.Image) string {
+	if img.Width <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("/images/%s %dw", img.ID, img.Width)
+}
+
+type scenario struct {
+	Name   string
+	Method string
+	URL    string
+
+	ExpectedStatus    int
+	ExpectedContent   string
+	ExpectedContentFn func(io.Reader) error
+}
+
+func (s scenario) TestName() string {
+	if len(s.Name) != 0 {
+		return s.Name
+	}
+
+	return fmt.Sprintf("%s:%s", s.Method, s.URL)
+}
+
+func templateBody(t *testing.T, tmpl *template.Template, data any) string {
+	buf := &bytes.Buffer{}
+	err := tmpl.Execute(buf, data)
+	require.NoError(t, err, "could not create template body")
+	return buf.String()
+}
+
+func reverse[S any](s []S) []S {
+	arr := make([]S, len(s))
+	copy(arr, s)
+	slices.Reverse(arr)
+	return arr
+}
+
+func clearFailedTests(t *testing.T) {
+	if _, err := os.Stat("./failed-tests"); os.IsNotExist(err) {
+		return
+	}
+
+	err := os.RemoveAll("./failed-tests")
+	require.NoError(t, err, "error while clearing failed tests")
+}
+
+func saveBodyDiff(t *testing.T, s scenario, res string) {
+	if _, err := os.Stat("./failed-tests"); os.IsNotExist(err) {
+		err = os.MkdirAll("./failed-tests", 0755)
+		require.NoError(t, err)
+	}
+
+	testID := base64.URLEncoding.EncodeToString([]byte(s.TestName()))[:6]
+
+	t.Errorf("%s body is not as expected, check diff %s", s.TestName(), testID)
+
+	exp, err := os.Create(fmt.Sprintf("./failed-tests/exp-%s.html", testID))
+	require.NoError(t, err)
+	defer exp.Close()
+
+	_, err = exp.WriteString(s.ExpectedContent)
+	require.NoError(t, err)
+
+	act, err := os.Create(fmt.Sprintf("./failed-tests/act-%s.html", testID))
+	require.NoError(t, err)
+	defer act.Close()
+
+	_, err = act.WriteString(res)
+	require.NoError(t, err)
+}
+
+func toJSON(t *testing.T, data any) []byte {
+	b, err := json.Marshal(data)
+	require.NoError(t, err)
+	return b
+}
+
+func TestBackup(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	img := dbtest.GivenSaved(t, table, dbtest.GivenImage(t))[0]
+
+	dir := t.TempDir()
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imagetest.NewStore(),
+		ImageTable:     table.ImageTable,
+	}, router.Options{
+		Admins:     []string{"admin"},
+		BackupDir:  dir,
+		BackupKeep: 1,
+	})
+
+	get := func(t *testing.T, user string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/admin/backup", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth(user, "")
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should only backup for admins", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, get(t, "wob").Result().StatusCode)
+	})
+
+	t.Run("should stream a snapshot", func(t *testing.T) {
+		rr := get(t, "admin")
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode, rr.Body.String())
+		assert.Equal(t, "application/vnd.sqlite3", rr.Header().Get("Content-Type"))
+		assert.Regexp(t, `^attachment; filename="saws-\d{8}T\d{6}Z\.sqlite"$`, rr.Header().Get("Content-Disposition"))
+
+		path := filepath.Join(t.TempDir(), "download.sqlite")
+		require.NoError(t, os.WriteFile(path, rr.Body.Bytes(), 0o644))
+
+		backup, err := db.NewImageTable("file:" + path)
+		require.NoError(t, err)
+		defer backup.Close()
+
+		got, err := backup.GetByID(img.ID)
+		require.NoError(t, err)
+		assert.Equal(t, img.ID, got.ID)
+	})
+
+	t.Run("should keep scheduled snapshots in the backup dir", func(t *testing.T) {
+		now := time.Now()
+		require.NoError(t, srv.Backup(context.Background(), now.Add(-time.Hour)))
+		require.NoError(t, srv.Backup(context.Background(), now))
+
+		snapshots, err := db.Snapshots(dir)
+		require.NoError(t, err)
+		assert.Equal(t, []string{db.SnapshotPath(dir, now)}, snapshots)
+	})
+
+	t.Run("should not backup catalogues kept in memory", func(t *testing.T) {
+		mem := router.NewRouter(router.Services{ImageTable: db.NewMemoryCatalogue()}, router.Options{BackupDir: dir})
+		assert.ErrorIs(t, mem.Backup(context.Background(), time.Now()), router.BackupsNotSupported)
+	})
+}
+
+func TestExport(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	imgs := dbtest.GivenSaved(t, table, dbtest.SpaceByHour([]db.Image{dbtest.GivenImage(t), dbtest.GivenImage(t)})...)
+
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imagetest.NewStore(),
+		ImageTable:     table.ImageTable,
+	}, router.Options{
+		Admins: []string{"admin"},
+	})
+
+	get := func(t *testing.T, user string, url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		req.SetBasicAuth(user, "")
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should only export for admins", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, get(t, "wob", "/admin/export").Result().StatusCode)
+	})
+
+	t.Run("should export as json lines by default", func(t *testing.T) {
+		rr := get(t, "admin", "/admin/export")
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+		assert.Equal(t, "application/jsonl", rr.Header().Get("Content-Type"))
+
+		dec := json.NewDecoder(rr.Body)
+		for _, img := range imgs {
+			rec := db.ExportRecord{}
+			require.NoError(t, dec.Decode(&rec))
+			assert.Equal(t, img.ID, rec.ID)
+		}
+		assert.False(t, dec.More())
+	})
+
+	t.Run("should export as csv", func(t *testing.T) {
+		rr := get(t, "admin", "/admin/export?format=csv")
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+		assert.Equal(t, "text/csv", rr.Header().Get("Content-Type"))
+		assert.Regexp(t, `filename="saws-\d{4}-\d{2}-\d{2}\.csv"`, rr.Header().Get("Content-Disposition"))
+
+		lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+		require.Len(t, lines, 3)
+		assert.True(t, strings.HasPrefix(lines[0], "id,mimeType,"))
+		assert.True(t, strings.HasPrefix(lines[1], imgs[0].ID+","))
+	})
+
+	t.Run("should reject unknown formats", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, get(t, "admin", "/admin/export?format=xml").Result().StatusCode)
+	})
+}
+
+func TestDuplicates(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	tmpl, err := templates.GetTemplates()
+	require.NoError(t, err)
+
+	imgStore := imagetest.NewStore()
+	defer imgStore.Close()
+
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imgStore,
+		Templates:      tmpl,
+		ImageTable:     table.ImageTable,
+	}, router.Options{
+		Admins: []string{"admin"},
+	})
+
+	do := func(t *testing.T, method, url string, body io.Reader, admin bool) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, body)
+		require.NoError(t, err)
+		if method == http.MethodPost && body != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if admin {
+			req.SetBasicAuth("admin", "")
+		}
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	upload := func(t *testing.T, f io.Reader) string {
+		rr := do(t, http.MethodPost, "/images", f, false)
+		require.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+		return strings.TrimPrefix(rr.Result().Header.Get("Location"), "/images/")
+	}
+
+	// copies of the fish saved again at lower qualities
+	fish, _, err := goimage.Decode(imagetest.FishJPEG())
+	require.NoError(t, err)
+	reencoded := func(quality int) io.Reader {
+		buf := &bytes.Buffer{}
+		require.NoError(t, jpeg.Encode(buf, fish, &jpeg.Options{Quality: quality}))
+		return buf
+	}
+
+	fishID := upload(t, imagetest.FishJPEG())
+	copyID := upload(t, reencoded(50))
+	otherCopyID := upload(t, reencoded(30))
+	nyID := upload(t, imagetest.NYJPEG())
+
+	t.Run("should only show duplicates to admins", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, do(t, http.MethodGet, "/admin/duplicates", nil, false).Result().StatusCode)
+		assert.Equal(t, http.StatusForbidden, do(t, http.MethodPost, "/admin/duplicates/keep-both", nil, false).Result().StatusCode)
+		assert.Equal(t, http.StatusBadRequest, do(t, http.MethodGet, "/admin/duplicates?distance=x", nil, true).Result().StatusCode)
+		assert.Equal(t, http.StatusBadRequest, do(t, http.MethodGet, "/admin/duplicates?distance=64", nil, true).Result().StatusCode)
+		assert.Equal(t, http.StatusOK, do(t, http.MethodGet, "/admin/duplicates?distance=24", nil, true).Result().StatusCode)
+
+		rr := do(t, http.MethodGet, "/admin/duplicates", nil, true)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+		for _, id := range []string{fishID, copyID, otherCopyID} {
+			assert.Contains(t, rr.Body.String(), fmt.Sprintf(`id="%s"`, id))
+		}
+		assert.NotContains(t, rr.Body.String(), fmt.Sprintf(`id="%s"`, nyID))
+	})
+
+	t.Run("should stop pairing images kept together", func(t *testing.T) {
+		form := fmt.Sprintf("id=%s&other=%s", copyID, fishID)
+		require.Equal(t, http.StatusOK, do(t, http.MethodPost, "/admin/duplicates/keep-both", strings.NewReader(form), true).Result().StatusCode)
+		form = fmt.Sprintf("id=%s&other=%s", copyID, "missing")
+		assert.Equal(t, http.StatusNotFound, do(t, http.MethodPost, "/admin/duplicates/keep-both", strings.NewReader(form), true).Result().StatusCode)
+
+		pairs, err := table.GetDuplicates(db.DefaultDuplicateDistance)
+		require.NoError(t, err)
+		require.Len(t, pairs, 2)
+		for _, p := range pairs {
+			assert.Contains(t, []string{p.Image.ID, p.Other.ID}, otherCopyID)
+		}
+	})
+
+	t.Run("should trash the image that isn't kept", func(t *testing.T) {
+		form := fmt.Sprintf("keep=%s&trash=%s", fishID, otherCopyID)
+		require.Equal(t, http.StatusOK, do(t, http.MethodPost, "/admin/duplicates/keep-one", strings.NewReader(form), true).Result().StatusCode)
+		assert.Equal(t, http.StatusNotFound, do(t, http.MethodPost, "/admin/duplicates/keep-one", strings.NewReader(form), true).Result().StatusCode)
+
+		trash, err := table.GetTrash()
+		require.NoError(t, err)
+		require.Len(t, trash, 1)
+		assert.Equal(t, otherCopyID, trash[0].ID)
+
+		events, err := table.GetAuditEvents()
+		require.NoError(t, err)
+		require.NotEmpty(t, events.Events)
+		assert.Equal(t, db.AuditDelete, events.Events[0].Action)
+		assert.Equal(t, otherCopyID, events.Events[0].ImageID)
+
+		rr := do(t, http.MethodGet, "/admin/duplicates", nil, true)
+		assert.Contains(t, rr.Body.String(), "No duplicates found")
+	})
+
+	t.Run("should backfill missing dhashes", func(t *testing.T) {
+		img, err := table.GetByID(nyID)
+		require.NoError(t, err)
+		require.NotEmpty(t, img.DHash)
+		require.NoError(t, table.SetDHash(nyID, ""))
+
+		require.NoError(t, srv.BackfillDHashes(context.Background()))
+
+		backfilled, err := table.GetByID(nyID)
+		require.NoError(t, err)
+		assert.Equal(t, img.DHash, backfilled.DHash)
+	})
+}
+
+func TestBackfillOrientation(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	imgStore := imagetest.NewStore()
+	defer imgStore.Close()
+
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imgStore,
+		ImageTable:     table.ImageTable,
+	}, router.Options{})
+
+	req, err := http.NewRequest(http.MethodPost, "/images", imagetest.RotatedFishJPEGs()[6])
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+	id := strings.TrimPrefix(rr.Result().Header.Get("Location"), "/images/")
+
+	oriented, err := table.GetByID(id)
+	require.NoError(t, err)
+	require.NotEqual(t, oriented.Width, oriented.Height)
+
+	// as it was saved before photos were turned the right way up
+	_, err = table.DB.Exec(`UPDATE image SET width = height, height = width, thumbhash = '', dhash = '' WHERE id = (?);`, id)
+	require.NoError(t, err)
+	_, err = table.DB.Exec(`INSERT INTO image_unoriented (image_id) VALUES (?);`, id)
+	require.NoError(t, err)
+
+	require.NoError(t, srv.BackfillOrientation(context.Background()))
+
+	backfilled, err := table.GetByID(id)
+	require.NoError(t, err)
+	assert.Equal(t, oriented.Width, backfilled.Width)
+	assert.Equal(t, oriented.Height, backfilled.Height)
+	assert.Equal(t, oriented.ThumbHash, backfilled.ThumbHash)
+	assert.Equal(t, oriented.DHash, backfilled.DHash)
+
+	unoriented, err := table.GetUnoriented()
+	require.NoError(t, err)
+	assert.Empty(t, unoriented)
+}
+
+func TestStats(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	tmpl, err := templates.GetTemplates()
+	require.NoError(t, err)
+
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imagetest.NewStore(),
+		Templates:      tmpl,
+		ImageTable:     table.ImageTable,
+	}, router.Options{})
+
+	day := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	imgs := []db.Image{dbtest.GivenImage(t), dbtest.GivenImage(t), dbtest.GivenImage(t)}
+	imgs[0].Country, imgs[0].Locality, imgs[0].CreatedAt, imgs[0].Lat, imgs[0].Long = "Chile", "Santiago", day, 1, 0
+	imgs[1].Country, imgs[1].Locality, imgs[1].CreatedAt, imgs[1].Lat, imgs[1].Long = "Chile", "Valparaíso", day.Add(time.Hour), 1, 1
+	imgs[2].Country, imgs[2].Locality, imgs[2].CreatedAt, imgs[2].Lat, imgs[2].Long = "Peru", "Cusco", day.Add(48*time.Hour), 0, 0
+	dbtest.GivenSaved(t, table, imgs...)
+	dbtest.GivenInAlbum(t, table, "south-america", imgs[:2]...)
+
+	get := func(t *testing.T, url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should get stats as json", func(t *testing.T) {
+		rr := get(t, "/api/stats")
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+		assert.Equal(t, "application/json", rr.Result().Header.Get("Content-Type"))
+
+		var stats db.Stats
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&stats))
+		assert.Equal(t, 3, stats.Total)
+		assert.Len(t, stats.Days, 2)
+		assert.Len(t, stats.Countries, 2)
+		assert.InDelta(t, 111.2, stats.Km, 0.1)
+
+		rr = get(t, "/api/stats?album=south-america")
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&stats))
+		assert.Equal(t, 2, stats.Total)
+		assert.Len(t, stats.Countries, 1)
+	})
+
+	t.Run("should show stats page of album", func(t *testing.T) {
+		for _, url := range []string{"/south-america/stats", "/albums/south-america/stats"} {
+			rr := get(t, url)
+			require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+			body := rr.Body.String()
+			assert.Contains(t, body, `href="/albums/south-america/chile"`)
+			assert.Contains(t, body, `href="/albums/south-america/chile/valparaiso"`)
+			assert.Contains(t, body, `href="/albums/south-america?from=2024-03-01&to=2024-03-01"`)
+			assert.Contains(t, body, "111km")
+			assert.NotContains(t, body, "Peru")
+		}
+
+		assert.Equal(t, http.StatusNotFound, get(t, "/albums/missing/stats").Result().StatusCode)
+	})
+}
+
+func TestRenditions(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	tmpl, err := templates.GetTemplates()
+	require.NoError(t, err)
+
+	imgStore := imagetest.NewStore()
+	defer imgStore.Close()
+
+	srv := router.NewRouter(router.Services{
+		ImageFileStore: imgStore,
+		Templates:      tmpl,
+		ImageTable:     table.ImageTable,
+	}, router.Options{})
+
+	do := func(t *testing.T, method, url string, body io.Reader) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, body)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do(t, http.MethodPost, "/images", imagetest.NYJPEG())
+	require.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+	id := strings.TrimPrefix(rr.Result().Header.Get("Location"), "/images/")
+	require.NoError(t, table.AddToAlbum(router.SouthAmerica, id))
+
+	t.Run("should serve renditions by width", func(t *testing.T) {
+		rr := do(t, http.MethodGet, "/images/"+id+"?w=240", nil)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+		assert.Equal(t, "image/jpeg", rr.Result().Header.Get("Content-Type"))
+		cfg, _, err := goimage.DecodeConfig(rr.Body)
+		require.NoError(t, err)
+		assert.Equal(t, 240, cfg.Width)
+
+		assert.Equal(t, http.StatusBadRequest, do(t, http.MethodGet, "/images/"+id+"?w=241", nil).Result().StatusCode)
+		assert.Equal(t, http.StatusBadRequest, do(t, http.MethodGet, "/images/"+id+"?w=big", nil).Result().StatusCode)
+	})
+
+	t.Run("should serve heic uploads as jpeg", func(t *testing.T) {
+		rr := do(t, http.MethodPost, "/images", imagetest.DogsHEIC())
+		require.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+		heicID := strings.TrimPrefix(rr.Result().Header.Get("Location"), "/images/")
+
+		for _, url := range []string{"/images/" + heicID, "/images/" + heicID + "?w=240"} {
+			rr = do(t, http.MethodGet, url, nil)
+			require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+			assert.Equal(t, "image/jpeg", rr.Result().Header.Get("Content-Type"))
+			_, format, err := goimage.DecodeConfig(rr.Body)
+			require.NoError(t, err)
+			assert.Equal(t, "jpeg", format)
+		}
+	})
+
+	t.Run("should serve the format the browser accepts", func(t *testing.T) {
+		get := func(t *testing.T, url, accept string) *httptest.ResponseRecorder {
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			require.NoError(t, err)
+			req.Header.Set("Accept", accept)
+			rr := httptest.NewRecorder()
+			srv.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+			assert.Equal(t, "Accept", rr.Result().Header.Get("Vary"))
+			return rr
+		}
+
+		accepts := map[string]string{
+			"image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8": "avif",
+			"image/webp,*/*":              "webp",
+			"image/avif;q=0,image/webp":   "webp",
+			"image/png,image/*;q=0.8,*/*": "jpeg",
+			"":                            "jpeg",
+		}
+		for accept, format := range accepts {
+			rr := get(t, "/images/"+id+"?w=240", accept)
+			assert.Equal(t, "image/"+format, rr.Result().Header.Get("Content-Type"), accept)
+
+			_, decoded, err := goimage.DecodeConfig(rr.Body)
+			require.NoError(t, err)
+			assert.Equal(t, format, decoded, accept)
+		}
+
+		rr := get(t, "/images/"+id, "image/webp")
+		assert.Equal(t, "image/webp", rr.Result().Header.Get("Content-Type"))
+	})
+
+	t.Run("should list renditions in srcset", func(t *testing.T) {
+		srcset := fmt.Sprintf(`srcset="/images/%[1]s?w=240 240w, /images/%[1]s?w=480 480w, /images/%[1]s?w=960 960w, /images/%[1]s 1089w"`, id)
+		for _, url := range []string{"/south-america", "/south-america/images/" + id} {
+			rr := do(t, http.MethodGet, url, nil)
+			require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+			assert.Contains(t, rr.Body.String(), srcset)
+		}
+	})
+}
+
+func TestPrivacy(t *testing.T) {
+	table := dbtest.NewTestTable(t)
+	defer table.Close()
+
+	tmpl, err := templates.GetTemplates()
+	require.NoError(t, err)
+
+	imgStore := imagetest.NewStore()
+	defer imgStore.Close()
+
+	newServer := func(privacy image.PrivacyPolicy) router.Router {
+		return router.NewRouter(router.Services{
+			ImageFileStore: imgStore,
+			Templates:      tmpl,
+			ImageTable:     table.ImageTable,
+		}, router.Options{
+			Admins:  []string{"admin"},
+			Privacy: privacy,
+		})
+	}
+	srv := newServer("")
+
+	do := func(t *testing.T, srv router.Router, method, url string, body io.Reader, admin bool) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, body)
+		require.NoError(t, err)
+		if admin {
+			req.SetBasicAuth("admin", "")
+		}
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	original, err := io.ReadAll(imagetest.DogsJPEG())
+	require.NoError(t, err)
+	rr := do(t, srv, http.MethodPost, "/images", bytes.NewReader(original), false)
+	require.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+	id := strings.TrimPrefix(rr.Result().Header.Get("Location"), "/images/")
+
+	t.Run("should strip gps from served files by default", func(t *testing.T) {
+		rr := do(t, srv, http.MethodGet, "/images/"+id, nil, false)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+		assert.Equal(t, "image/jpeg", rr.Result().Header.Get("Content-Type"))
+
+		served := rr.Body.Bytes()
+		assert.NotEqual(t, original, served)
+		e, err := exif.Decode(bytes.NewReader(served))
+		require.NoError(t, err)
+		_, _, err = image.GetLatLongFromExif(e)
+		assert.Error(t, err)
+		_, err = e.Get(exif.Model)
+		assert.Error(t, err)
+
+		_, _, err = goimage.Decode(bytes.NewReader(served))
+		require.NoError(t, err)
+	})
+
+	t.Run("should serve files as they are when privacy is off", func(t *testing.T) {
+		rr := do(t, newServer(image.PrivacyOff), http.MethodGet, "/images/"+id, nil, false)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+		assert.Equal(t, original, rr.Body.Bytes())
+	})
+
+	t.Run("should let admins download the original", func(t *testing.T) {
+		rr := do(t, srv, http.MethodGet, "/admin/images/"+id+"/original", nil, true)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+		assert.Equal(t, original, rr.Body.Bytes())
+		assert.Equal(t, "image/jpeg", rr.Result().Header.Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="`+id+`.jpeg"`, rr.Result().Header.Get("Content-Disposition"))
+
+		assert.Equal(t, http.StatusForbidden, do(t, srv, http.MethodGet, "/admin/images/"+id+"/original", nil, false).Result().StatusCode)
+		assert.Equal(t, http.StatusNotFound, do(t, srv, http.MethodGet, "/admin/images/missing/original", nil, true).Result().StatusCode)
+	})
 }
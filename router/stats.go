@@ -0,0 +1,145 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/wobwainwwight/sa-photos/db"
+)
+
+type StatsPage struct {
+	Title     string
+	AlbumURL  string
+	Total     int
+	Undated   int
+	Km        string
+	MaxCount  int
+	Days      []DayStatsItem
+	Countries []CountryStatsItem
+}
+
+// DayStatsItem is a bar of the photos per day chart, Percent is of the
+// day with the most photos
+type DayStatsItem struct {
+	Date    string
+	Count   int
+	Km      string
+	Percent int
+}
+
+type CountryStatsItem struct {
+	Country    string
+	URL        string
+	Count      int
+	First      string
+	Last       string
+	Localities []LocalityStatsItem
+}
+
+type LocalityStatsItem struct {
+	Locality string
+	URL      string
+	Count    int
+}
+
+func (ro *Router) apiStats(w http.ResponseWriter, r *http.Request) {
+	opts := []db.GetListOptsFn{}
+	if album := r.URL.Query().Get("album"); len(album) > 0 {
+		opts = append(opts, db.WithAlbum(album))
+	}
+
+	stats, err := ro.ImageTable.GetStatsContext(r.Context(), opts...)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), errorCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(stats)
+	if err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func (ro *Router) albumStats(w http.ResponseWriter, r *http.Request) {
+	album, ok := ro.getAlbum(w, r)
+	if !ok {
+		return
+	}
+	albumURL := AlbumURL(album.Slug)
+
+	stats, err := ro.ImageTable.GetStatsContext(r.Context(), db.WithAlbum(album.Slug))
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), errorCode(err))
+		return
+	}
+
+	tmpl := ro.Templates.Lookup("stats.html")
+	if tmpl == nil {
+		log.Println("stats.html template not found")
+		return
+	}
+
+	page := StatsPage{
+		Title:     album.Name,
+		AlbumURL:  albumURL,
+		Total:     stats.Total,
+		Undated:   stats.Undated,
+		Km:        formatKm(stats.Km),
+		Days:      make([]DayStatsItem, len(stats.Days)),
+		Countries: make([]CountryStatsItem, len(stats.Countries)),
+	}
+
+	for _, d := range stats.Days {
+		page.MaxCount = max(page.MaxCount, d.Count)
+	}
+	for i, d := range stats.Days {
+		page.Days[i] = DayStatsItem{
+			Date:    d.Date,
+			Count:   d.Count,
+			Km:      formatKm(d.Km),
+			Percent: d.Count * 100 / page.MaxCount,
+		}
+	}
+
+	for i, c := range stats.Countries {
+		countryURL := fmt.Sprintf("%s/%s", albumURL, db.Slug(c.Country))
+		item := CountryStatsItem{
+			Country:    c.Country,
+			URL:        countryURL,
+			Count:      c.Count,
+			First:      formatStatsTime(c.First),
+			Last:       formatStatsTime(c.Last),
+			Localities: make([]LocalityStatsItem, len(c.Localities)),
+		}
+		for j, l := range c.Localities {
+			item.Localities[j] = LocalityStatsItem{
+				Locality: l.Locality,
+				URL:      fmt.Sprintf("%s/%s", countryURL, db.Slug(l.Locality)),
+				Count:    l.Count,
+			}
+		}
+		page.Countries[i] = item
+	}
+
+	err = tmpl.Execute(w, page)
+	if err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func formatKm(km float64) string {
+	return fmt.Sprintf("%.0fkm", km)
+}
+
+func formatStatsTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2 Jan 2006 15:04")
+}
@@ -0,0 +1,159 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/wobwainwwight/sa-photos/db"
+	"github.com/wobwainwwight/sa-photos/image"
+)
+
+// DefaultTrashRetention is how long trashed images are kept before they
+// are purged when Options doesn't say
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+type TrashPage struct {
+	Images []TrashItem
+}
+
+type TrashItem struct {
+	ID         string
+	ImageURL   string
+	RestoreURL string
+	AltText    string
+	Thumbhash  string
+	Width      int
+	Height     int
+	DeletedAt  string
+	PurgeAt    string
+}
+
+// adminOnly responds with forbidden unless the request is from an admin
+func (ro *Router) adminOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !detemineIsAdmin(r, ro.Admins) {
+			http.Error(w, "only admins can do this", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (ro *Router) trashRetention() time.Duration {
+	if ro.TrashRetention > 0 {
+		return ro.TrashRetention
+	}
+	return DefaultTrashRetention
+}
+
+func (ro *Router) adminTrash(w http.ResponseWriter, r *http.Request) {
+	imgs, err := ro.ImageTable.GetTrashContext(r.Context())
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), errorCode(err))
+		return
+	}
+
+	tmpl := ro.Templates.Lookup("trash.html")
+	if tmpl == nil {
+		log.Println("trash.html template not found")
+		return
+	}
+
+	targetHeight := 200
+	page := TrashPage{Images: make([]TrashItem, len(imgs))}
+	for i, img := range imgs {
+		page.Images[i] = TrashItem{
+			ID:         img.ID,
+			ImageURL:   fmt.Sprintf("/images/%s", img.ID),
+			RestoreURL: fmt.Sprintf("/images/%s/restore", img.ID),
+			AltText:    altText(img),
+			Thumbhash:  img.ThumbHash,
+			Width:      image.ResizeWidth(img.Width, img.Height, targetHeight),
+			Height:     targetHeight,
+			DeletedAt:  img.DeletedAt.Format(time.DateOnly),
+			PurgeAt:    img.DeletedAt.Add(ro.trashRetention()).Format(time.DateOnly),
+		}
+	}
+
+	err = tmpl.Execute(w, page)
+	if err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func (ro *Router) restoreImage(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := ro.ImageTable.RestoreContext(r.Context(), id)
+	if err == db.NotFound {
+		http.Error(w, "image is not in the trash", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		msg := fmt.Sprintf("could not restore image %s: %s", id, err.Error())
+		log.Println(msg)
+		http.Error(w, msg, errorCode(err))
+		return
+	}
+
+	img, err := ro.ImageTable.GetByIDContext(r.Context(), id)
+	if err != nil {
+		log.Println(err.Error())
+	} else {
+		ro.audit(r, db.AuditRestore, id, nil, &img)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// PurgeTrash deletes the rows and files of images that have been in the
+// trash for longer than the retention period. The row goes first and
+// only if the image is still in the trash, so an image restored while
+// the trash is being purged keeps its file.
+func (ro *Router) PurgeTrash(ctx context.Context, now time.Time) error {
+	before := now.Add(-ro.trashRetention())
+	imgs, err := ro.ImageTable.GetTrashedBeforeContext(ctx, before)
+	if err != nil {
+		return err
+	}
+
+	for _, img := range imgs {
+		err = ro.ImageTable.PurgeContext(ctx, img.ID, before)
+		if err == db.NotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		err = ro.ImageFileStore.Delete(img.ID)
+		if err != nil && !image.IsNotFound(err) {
+			log.Printf("could not delete file of purged image %s: %s\n", img.ID, err.Error())
+			continue
+		}
+		log.Println("purged image: ", img.ID)
+	}
+	return nil
+}
+
+// PurgeTrashEvery runs PurgeTrash straight away and then every interval
+// until the context is done
+func (ro *Router) PurgeTrashEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := ro.PurgeTrash(ctx, time.Now())
+		if err != nil {
+			log.Printf("could not purge trash: %s\n", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 )
@@ -18,18 +19,27 @@ func main() {
 
 	args := flag.Args()
 	if len(args) != 1 {
-		os.Stderr.WriteString("usage: add-loc --country Chile --locality Santiago <image>\n")
+		os.Stderr.WriteString("usage: add-loc [--country Chile] [--locality Santiago] <image>\n")
 		os.Exit(1)
 		return
 	}
 
-	if len(*cFlag) == 0 {
-		os.Stderr.WriteString("country must be provided\n")
+	// only send the flags that were given so the other field is left as it is
+	patch := map[string]string{}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "locality":
+			patch["locality"] = *lFlag
+		case "country":
+			patch["country"] = *cFlag
+		}
+	})
+
+	if len(patch) == 0 {
+		os.Stderr.WriteString("country or locality must be provided\n")
 		os.Exit(1)
 		return
 	}
-	locality := *lFlag
-	country := *cFlag
 
 	file, err := os.Open(args[0])
 	if err != nil {
@@ -48,15 +58,7 @@ func main() {
 
 	id := fmt.Sprintf("%x", h.Sum(nil))[:12]
 
-	type loc struct {
-		Locality string `json:"locality"`
-		Country  string `json:"country"`
-	}
-
-	b, err := json.Marshal(loc{
-		Locality: locality,
-		Country:  country,
-	})
+	b, err := json.Marshal(patch)
 	if err != nil {
 		os.Stderr.WriteString(err.Error())
 		os.Exit(1)
@@ -73,6 +75,7 @@ func main() {
 	}
 
 	req.Header.Add("Authorization", os.Getenv("SAWS_AUTH"))
+	req.Header.Add("Content-Type", "application/merge-patch+json")
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -81,5 +84,27 @@ func main() {
 		return
 	}
 
-	fmt.Fprintf(os.Stdout, "%d %s %s %s\n", resp.StatusCode, country, locality, id)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "%d %s %s", resp.StatusCode, id, msg)
+		os.Exit(1)
+		return
+	}
+
+	type loc struct {
+		Locality string `json:"locality"`
+		Country  string `json:"country"`
+	}
+
+	updated := loc{}
+	err = json.NewDecoder(resp.Body).Decode(&updated)
+	if err != nil {
+		os.Stderr.WriteString(err.Error())
+		os.Exit(1)
+		return
+	}
+
+	fmt.Fprintf(os.Stdout, "%d %s %s %s\n", resp.StatusCode, updated.Country, updated.Locality, id)
 }
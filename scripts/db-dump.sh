@@ -1,3 +1,5 @@
 #!/bin/bash
 
-flyctl ssh sftp get -a saws-world /app/saws_world_data/saws.sqlite ./sw_dump_$(date +%d_%m_%Y).sqlite
+# needs SAWS_ADMIN and SAWS_PASSWORD, the snapshot is taken by the server
+# so it's consistent even while the site is in use
+curl -fsS -u "$SAWS_ADMIN:$SAWS_PASSWORD" https://saws.world/admin/backup -o ./sw_dump_$(date +%d_%m_%Y).sqlite
@@ -3,15 +3,22 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Usage: upload-imgs <dir / file>")
+	if len(os.Args) != 2 && len(os.Args) != 3 {
+		fmt.Println("Usage: upload-imgs <dir / file> [album]")
 		return
 	}
+
+	album := "south-america"
+	if len(os.Args) == 3 {
+		album = os.Args[2]
+	}
 	inf, err := os.Stat(os.Args[1])
 	if err != nil {
 		errorOut(err)
@@ -20,9 +27,9 @@ func main() {
 
 	if inf.IsDir() {
 		fmt.Fprintf(os.Stdout, "uploading files in: %s\n", os.Args[1])
-		err = uploadImagesInDir(os.Args[1])
+		err = uploadImagesInDir(os.Args[1], album)
 	} else {
-		err = uploadFile(os.Args[1])
+		err = uploadFile(os.Args[1], album)
 	}
 
 	if err != nil {
@@ -30,7 +37,18 @@ func main() {
 	}
 }
 
-func uploadImagesInDir(dir string) error {
+// mimeTypes are the extensions of the files that can be uploaded
+var mimeTypes = map[string]string{
+	".jpeg": "image/jpeg",
+	".jpg":  "image/jpeg",
+	".png":  "image/png",
+	".heic": "image/heic",
+	".heif": "image/heif",
+	".webp": "image/webp",
+	".gif":  "image/gif",
+}
+
+func uploadImagesInDir(dir string, album string) error {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return err
@@ -40,15 +58,15 @@ func uploadImagesInDir(dir string) error {
 			continue
 		}
 
-		ext := filepath.Ext(e.Name())
-		if ext == ".jpeg" || ext == ".jpg" {
+		mimeType, ok := mimeTypes[strings.ToLower(filepath.Ext(e.Name()))]
+		if ok {
 			path := filepath.Join(dir, e.Name())
 
 			f, err := os.Open(path)
 			if err != nil {
 				return err
 			}
-			resp, err := http.Post("http://localhost:8080/images", "image/jpeg", f)
+			resp, err := http.Post("http://localhost:8080/images?album="+url.QueryEscape(album), mimeType, f)
 			if err != nil {
 				return err
 			}
@@ -59,12 +77,12 @@ func uploadImagesInDir(dir string) error {
 	return nil
 }
 
-func uploadFile(path string) error {
+func uploadFile(path string, album string) error {
 	f, err := os.Open(path)
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest(http.MethodPost, "https://saws.world/images", f)
+	req, err := http.NewRequest(http.MethodPost, "https://saws.world/images?album="+url.QueryEscape(album), f)
 	if err != nil {
 		return err
 	}
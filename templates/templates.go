@@ -5,11 +5,11 @@ import (
 	"html/template"
 )
 
-//go:embed index.html south-america.html south-america-image.html
+//go:embed index.html south-america.html south-america-image.html trash.html audit.html duplicates.html stats.html
 var fs embed.FS
 
 func GetTemplates() (*template.Template, error) {
-	tmps, err := template.ParseFS(fs, "index.html", "south-america.html", "south-america-image.html")
+	tmps, err := template.ParseFS(fs, "index.html", "south-america.html", "south-america-image.html", "trash.html", "audit.html", "duplicates.html", "stats.html")
 	if err != nil {
 		return nil, err
 	}
@@ -14,6 +14,10 @@ func TestGetTemplates(t *testing.T) {
 		tempNames := []string{
 			"index.html",
 			"south-america.html",
+			"trash.html",
+			"audit.html",
+			"duplicates.html",
+			"stats.html",
 		}
 
 		tmps, err := templates.GetTemplates()